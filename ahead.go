@@ -0,0 +1,82 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"sync"
+)
+
+// parsedDir is the result of parsing a directory ahead of its generation.
+type parsedDir struct {
+	fset     *token.FileSet
+	packages map[string]*ast.Package
+	err      error
+}
+
+// ahead holds the directories parsed ahead by -j, the pending parses of a
+// directory listed twice in order.
+var ahead struct {
+	sync.Mutex
+	dirs map[string][]chan parsedDir
+}
+
+// parseAhead parses dirs in the background, in order, while the packages
+// before them are generated. At most -j of them hold their syntax trees at
+// once: done(i) releases the slot of dirs[i] once its code is produced,
+// whether its generation took the parsed files or not.
+func parseAhead(dirs []string) (done func(i int)) {
+	if *jobs <= 1 {
+		return func(int) {}
+	}
+	futures := make([]chan parsedDir, len(dirs))
+	ahead.dirs = make(map[string][]chan parsedDir, len(dirs))
+	for i, dir := range dirs {
+		futures[i] = make(chan parsedDir, 1)
+		ahead.dirs[dir] = append(ahead.dirs[dir], futures[i])
+	}
+	slots := make(chan struct{}, *jobs)
+	go func() {
+		for i, dir := range dirs {
+			slots <- struct{}{}
+			go func(dir string, future chan<- parsedDir) {
+				fset, packages, err := parseFiles(dir)
+				future <- parsedDir{fset, packages, err}
+			}(dir, futures[i])
+		}
+	}()
+	return func(i int) {
+		if dropParsed(dirs[i], futures[i]) {
+			// wait for the parse to end, holding its slot until then
+			<-futures[i]
+		}
+		<-slots
+	}
+}
+
+// takeParsed returns the first pending parse of dir, or nil if it isn't
+// parsed ahead.
+func takeParsed(dir string) <-chan parsedDir {
+	ahead.Lock()
+	defer ahead.Unlock()
+	futures := ahead.dirs[dir]
+	if len(futures) == 0 {
+		return nil
+	}
+	ahead.dirs[dir] = futures[1:]
+	return futures[0]
+}
+
+// dropParsed removes the parse future of dir if it's pending, reporting
+// whether it was.
+func dropParsed(dir string, future chan parsedDir) bool {
+	ahead.Lock()
+	defer ahead.Unlock()
+	futures := ahead.dirs[dir]
+	for i, f := range futures {
+		if f == future {
+			ahead.dirs[dir] = append(futures[:i:i], futures[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseAheadBound checks that -j parses the next directories ahead,
+// holding at most -j of them parsed until their generation is done.
+func TestParseAheadBound(t *testing.T) {
+	root := t.TempDir()
+	files := make(map[string]string)
+	var dirs []string
+	for i := 0; i < 6; i++ {
+		files[fmt.Sprintf("p%d/p.go", i)] = fmt.Sprintf("package p%d\n\nconst N = %d\n", i, i)
+		dirs = append(dirs, filepath.Join(root, fmt.Sprintf("p%d", i)))
+	}
+	writeFiles(t, root, files)
+	*jobs = 3
+	defer func() { *jobs = 1 }()
+	done := parseAhead(dirs)
+
+	futures := append([]chan parsedDir(nil), ahead.dirs[dirs[0]]...)
+	for _, dir := range dirs[1:] {
+		futures = append(futures, ahead.dirs[dir]...)
+	}
+	count := func() int {
+		n := 0
+		for _, f := range futures {
+			n += len(f)
+		}
+		return n
+	}
+	// parsed waits for want parses, and a little more for extra ones
+	parsed := func(want int) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); count() < want; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d directories are parsed ahead, want %d", count(), want)
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		if n := count(); n != want {
+			t.Fatalf("%d directories are parsed ahead, want %d", n, want)
+		}
+	}
+	parsed(3)
+
+	// the generation of the first directory takes its parse
+	fset, packages, err := parseDir(dirs[0])
+	if err != nil || fset == nil || packages["p0"] == nil {
+		t.Fatalf("parseDir(%s) = %v, %v", dirs[0], packages, err)
+	}
+	parsed(2)
+	done(0)
+	parsed(3)
+	// the second one is skipped without parsing, releasing its slot
+	done(1)
+	parsed(3)
+	for i := 2; i < len(dirs); i++ {
+		if _, packages, err := parseDir(dirs[i]); err != nil || packages[fmt.Sprintf("p%d", i)] == nil {
+			t.Fatalf("parseDir(%s) = %v, %v", dirs[i], packages, err)
+		}
+		done(i)
+	}
+	if future := takeParsed(dirs[1]); future != nil {
+		t.Errorf("the parse of the skipped %s is still pending", dirs[1])
+	}
+}
+
+// TestParseAhead checks that the packages parsed ahead by -j generate the
+// same code, a directory listed twice included.
+func TestParseAhead(t *testing.T) {
+	cache := writeModule(t, "ahead", map[string]string{
+		"ahead.go":     "package ahead\n\nfunc Run() {}\n",
+		"a/a.go":       "package a\n\nconst A = 1\n",
+		"b/b.go":       "package b\n\nvar B = 2\n",
+		"b/c/c.go":     "package c\n\ntype C struct{}\n",
+		"d/d_linux.go": "package d\n\nfunc D() {}\n",
+	})
+	dir := filepath.Join(cache, "example.com", "ahead@v1.0.0")
+	config := fmt.Sprintf(`{"packages": [{"dir": %[1]q, "path": "example.com/ahead/b"}, {"dir": %[1]q, "path": "example.com/ahead/b"}, {"dir": %[2]q, "path": "example.com/ahead/a"}]}`,
+		filepath.Join(dir, "b"), filepath.Join(dir, "a"))
+	for _, args := range [][]string{nil, {"-config", "ahead.json"}} {
+		var want map[string]string
+		for _, j := range []string{"1", "2", "8"} {
+			files := generate(t, cache, "ahead", map[string]string{"ahead.json": config}, append([]string{"-j", j}, args...)...)
+			for name, src := range files {
+				// without the command line
+				files[name] = src[strings.IndexByte(src, '\n'):]
+			}
+			if want == nil {
+				want = files
+				continue
+			}
+			for _, name := range sortedNames(want) {
+				if files[name] != want[name] {
+					t.Errorf("-j %s %s: %s differs from -j 1:\n%s\nwant:\n%s", j, strings.Join(args, " "), name, files[name], want[name])
+				}
+			}
+		}
+		if len(mapEntries(t, want, "Packages", "example.com/ahead/b")) != 1 {
+			t.Errorf("%s: example.com/ahead/b isn't bound once:\n%s", strings.Join(args, " "), want["ahead.go"])
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// loadArchive adds the Go files of the zip or tar.gz archive to the overlay
+// under root, for -archive, keeping the files of -overlay. The root of the
+// module is the directory of the top go.mod, like the path@version/ of a
+// module zip, or else the top directory shared by all the files, like the
+// one of a GitHub tarball. The directories holding a go.mod of their own
+// are other modules and are left out, like go build does. It returns the
+// directories holding Go files, relative to root and sorted, and the module
+// path declared by go.mod, if any.
+func loadArchive(name, root string) ([]string, string, error) {
+	files, err := readArchive(name)
+	if err != nil {
+		return nil, "", err
+	}
+	prefix := sharedTop(files)
+	if mod := topGoMod(files); mod != "" {
+		prefix = path.Dir(mod)
+	}
+	rels := make(map[string][]byte, len(files))
+	for file, src := range files {
+		rel := file
+		if prefix != "" && prefix != "." {
+			if !strings.HasPrefix(file, prefix+"/") {
+				continue
+			}
+			rel = file[len(prefix)+1:]
+		}
+		rels[rel] = src
+	}
+	var nested []string
+	for rel := range rels {
+		if path.Base(rel) == "go.mod" && rel != "go.mod" {
+			nested = append(nested, path.Dir(rel)+"/")
+		}
+	}
+	if overlay == nil {
+		overlay = make(map[string][]byte)
+	}
+	dirs := make(map[string]bool)
+	modPath := ""
+	for rel, src := range rels {
+		if rel == "go.mod" {
+			modPath = moduleLine(src)
+			continue
+		}
+		if !strings.HasSuffix(rel, ".go") || inNestedModule(rel, nested) {
+			continue
+		}
+		overlay[filepath.Join(root, filepath.FromSlash(rel))] = src
+		dirs[path.Dir(rel)] = true
+	}
+	s := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		s = append(s, filepath.FromSlash(dir))
+	}
+	sort.Strings(s)
+	return s, modPath, nil
+}
+
+// inNestedModule reports whether the file rel is below one of the nested
+// module directories, given with a trailing slash.
+func inNestedModule(rel string, nested []string) bool {
+	for _, dir := range nested {
+		if strings.HasPrefix(rel, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// readArchive returns the contents of the Go files and go.mod files of the
+// archive, by slash-separated name.
+func readArchive(name string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	keep := func(file string) bool {
+		return strings.HasSuffix(file, ".go") || path.Base(file) == "go.mod"
+	}
+	if strings.HasSuffix(name, ".zip") {
+		r, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if f.FileInfo().IsDir() || !keep(f.Name) {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			src, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			files[path.Clean(f.Name)] = src
+		}
+		return files, nil
+	}
+	if !strings.HasSuffix(name, ".tar.gz") && !strings.HasSuffix(name, ".tgz") {
+		return nil, fmt.Errorf("%s: unknown archive format, want .zip, .tar.gz or .tgz", name)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if h.Typeflag != tar.TypeReg || !keep(h.Name) {
+			continue
+		}
+		src, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		files[path.Clean(h.Name)] = src
+	}
+	return files, nil
+}
+
+// topGoMod returns the name of the go.mod closest to the top of files, or ""
+// if there is none or it doesn't hold all the files, like the go.mod of a
+// nested module in a repository without a root one.
+func topGoMod(files map[string][]byte) string {
+	top := ""
+	for file := range files {
+		if path.Base(file) != "go.mod" {
+			continue
+		}
+		if n, m := strings.Count(file, "/"), strings.Count(top, "/"); top == "" || n < m || n == m && file < top {
+			top = file
+		}
+	}
+	if dir := path.Dir(top); top != "" && dir != "." {
+		for file := range files {
+			if !strings.HasPrefix(file, dir+"/") {
+				return ""
+			}
+		}
+	}
+	return top
+}
+
+// sharedTop returns the top directory of all the files, or "" if they don't
+// share one.
+func sharedTop(files map[string][]byte) string {
+	top := ""
+	for file := range files {
+		i := strings.IndexByte(file, '/')
+		if i < 0 || top != "" && file[:i] != top {
+			return ""
+		}
+		top = file[:i]
+	}
+	return top
+}
+
+// moduleLine returns the module path declared by the go.mod src.
+func moduleLine(src []byte) string {
+	for _, line := range strings.Split(string(src), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			if p, err := strconv.Unquote(fields[1]); err == nil {
+				return p
+			}
+			return fields[1]
+		}
+	}
+	return ""
+}
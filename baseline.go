@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// baselineSymbols returns the symbols exported in this run as sorted
+// "path.Name" entries.
+func baselineSymbols() []string {
+	var s []string
+	for _, d := range descriptors {
+		for _, names := range [][]string{d.Constants, d.Variables, d.Functions, d.Types} {
+			for _, name := range names {
+				s = append(s, d.Path+"."+name)
+			}
+		}
+	}
+	sort.Strings(s)
+	return s
+}
+
+// checkBaseline fails when symbols not approved in the baseline file are
+// exported, or records the current symbols as approved when update is set.
+func checkBaseline(name string, update bool) error {
+	current := baselineSymbols()
+	if update {
+		buf := new(bytes.Buffer)
+		for _, sym := range current {
+			fmt.Fprintln(buf, sym)
+		}
+		return writeFile(name, buf.Bytes())
+	}
+	approved, err := readBaseline(name)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, sym := range current {
+		if _, ok := approved[sym]; !ok {
+			log.Printf("not in baseline: %s", sym)
+			n++
+		}
+	}
+	if n > 0 {
+		return fmt.Errorf("%d symbols not in baseline %s, review them and rerun with -update-baseline", n, name)
+	}
+	return nil
+}
+
+// readBaseline returns the "path.Name" entries of the baseline file.
+func readBaseline(name string) (map[string]struct{}, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	approved := make(map[string]struct{})
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			approved[line] = struct{}{}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return approved, nil
+}
+
+// approvedSymbols holds the baseline entries with -deny-by-default, the only
+// symbols exported then.
+var approvedSymbols map[string]struct{}
+
+// dropUnapproved drops the symbols of the package missing from
+// approvedSymbols.
+func dropUnapproved(path string, m map[string]*symbol) {
+	for _, sym := range m {
+		if _, ok := approvedSymbols[path+"."+sym.name]; !ok && sym.dropped == "" {
+			sym.dropped = "not approved"
+		}
+	}
+}
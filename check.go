@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// outdated is set by -check when a generated file differs from the one on
+// disk.
+var outdated bool
+
+// checkSink compares the files with the ones saved in the directory,
+// printing a diff when they differ, for -check.
+type checkSink string
+
+func (dir checkSink) Write(file string, src []byte) error {
+	filename := filepath.Join(string(dir), file)
+	old, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		outdated = true
+		fmt.Printf("%s: missing\n", filename)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(old, src) {
+		return nil
+	}
+	outdated = true
+	fmt.Printf("%s: out of date\n", filename)
+	d, err := diff(filename, src)
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(d)
+	return nil
+}
+
+// diff returns the unified diff from the file to src, by the diff command.
+func diff(filename string, src []byte) ([]byte, error) {
+	f, err := os.CreateTemp("", "anko-package-gen2")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(src); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	output, err := exec.Command("diff", "-u", "--label", filename, "--label", filename+" (generated)", filename, f.Name()).Output()
+	// diff exits with 1 when the files differ
+	if e, ok := err.(*exec.ExitError); ok && e.ExitCode() == 1 {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("diff: %v", err)
+	}
+	return output, nil
+}
+
+// runArgs returns the arguments recorded in the headers of the generated
+// files. -check is left out so that checking doesn't change them.
+func runArgs() string {
+	var args []string
+	for _, arg := range os.Args[1:] {
+		if name := strings.TrimLeft(arg, "-"); name != arg && (name == "check" || strings.HasPrefix(name, "check=")) {
+			continue
+		}
+		args = append(args, arg)
+	}
+	return strings.Join(args, " ")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCheckWritesNothing checks that -check compares the files given by
+// -index, -coverage and -baseline with -update-baseline, like the generated
+// ones, leaving them as they are.
+func TestCheckWritesNothing(t *testing.T) {
+	cache := writeModule(t, "checked", map[string]string{
+		"checked.go": "package checked\n\nconst Version = \"1\"\n\nfunc Run() {}\n",
+	})
+	args := []string{"-pkg", "example.com/checked", "-v", "v1.0.0", "-name", "checked", "-quiet",
+		"-index", "index.json", "-coverage", "coverage.json", "-baseline", "baseline.txt", "-update-baseline"}
+	r := runGenerator(t, cache, nil, nil, args...)
+	if r.err != nil {
+		t.Fatalf("%v\n%s", r.err, r.stderr)
+	}
+	files := []string{"index.json", "coverage.json", "baseline.txt", "anko-packages/checked.go"}
+	saved := make(map[string]string)
+	for _, name := range files {
+		b, err := os.ReadFile(filepath.Join(r.dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved[name] = string(b)
+	}
+
+	tests := []struct {
+		name     string
+		modify   string // the saved file changed before checking, if any
+		outdated bool
+	}{
+		{"up to date", "", false},
+		{"outdated index", "index.json", true},
+		{"outdated coverage", "coverage.json", true},
+		{"outdated baseline", "baseline.txt", true},
+		{"outdated bindings", "anko-packages/checked.go", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := make(map[string]string)
+			for name, src := range saved {
+				work[name] = src
+			}
+			if tt.modify != "" {
+				work[tt.modify] += "\n"
+			}
+			r := runGenerator(t, cache, work, nil, append(args, "-check")...)
+			if outdated := r.err != nil; outdated != tt.outdated {
+				t.Errorf("outdated = %v, want %v (%v)\n%s", outdated, tt.outdated, r.err, r.stderr)
+			}
+			for name, src := range work {
+				b, err := os.ReadFile(filepath.Join(r.dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != src {
+					t.Errorf("%s is written by -check", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// config holds the optional settings read from the file given by -config.
+type config struct {
+	// Instantiations maps an import path to the concrete instantiations of
+	// its generic types and functions to export, e.g.
+	// {"Set[string]": "StringSet", "New[int]": "NewInt"}.
+	Instantiations map[string]map[string]string `json:"instantiations"`
+
+	// GenericFunctions maps an import path to generic functions exported at
+	// each of the given type arguments, under the name of the function
+	// followed by them, e.g. [{"func": "Min", "instantiations": ["int"]}]
+	// exports Min[int] as MinInt. They are added to Instantiations.
+	GenericFunctions map[string][]genericFunction `json:"generic_functions"`
+
+	// FunctionTypes maps an import path to the functions whose type is
+	// registered into env.PackageTypes under their name, beside their value,
+	// e.g. ["Compare"].
+	FunctionTypes map[string][]string `json:"function_types"`
+
+	// ValueFormats replaces reflect.ValueOf(%s), or the bare reference with
+	// -value-kind interface, in the env.Packages entries of a kind ("const",
+	// "var" or "func") by another expression of the reference, e.g.
+	// {"func": "vm.WrapValue(%s)"}.
+	ValueFormats map[string]string `json:"value_formats"`
+
+	// Imports are added to the imports of the generated file, for the
+	// packages used by ValueFormats.
+	Imports []string `json:"imports"`
+
+	// Packages lists the directories to generate, instead of the module of
+	// -pkg, with their import path and optional init suffix, e.g.
+	// [{"dir": "foo", "path": "example.com/foo", "init": "Foo"}]. Relative
+	// directories are relative to the config file.
+	Packages []packageEntry `json:"packages"`
+
+	// Interfaces replaces the interfaces -with-docs notes the types
+	// implementing, by method name and signature, e.g.
+	// {"io.Reader": {"Read": "func([]byte) (int, error)"}}.
+	Interfaces map[string]map[string]string `json:"interfaces"`
+}
+
+type genericFunction struct {
+	Func           string   `json:"func"`
+	Instantiations []string `json:"instantiations"`
+}
+
+type packageEntry struct {
+	Dir  string `json:"dir"`
+	Path string `json:"path"`
+	Init string `json:"init"`
+}
+
+var cfg config
+
+// loadConfig reads the config file, reporting all its problems at once.
+func loadConfig(name string) error {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	var problems []string
+	problem := func(format string, a ...interface{}) {
+		problems = append(problems, name+": "+fmt.Sprintf(format, a...))
+	}
+	for path, fns := range cfg.GenericFunctions {
+		for _, fn := range fns {
+			if !token.IsIdentifier(fn.Func) || len(fn.Instantiations) == 0 {
+				problem("generic_functions: %s: %q needs a function name and instantiations", path, fn.Func)
+				continue
+			}
+			for _, args := range fn.Instantiations {
+				expr := fn.Func + "[" + args + "]"
+				alias := fn.Func + initSuffix(strings.Title(args))
+				if typeArgCount(expr) < 0 {
+					problem("generic_functions: %s: %s: %q aren't type arguments like int", path, fn.Func, args)
+					continue
+				}
+				if cfg.Instantiations == nil {
+					cfg.Instantiations = make(map[string]map[string]string)
+				}
+				if cfg.Instantiations[path] == nil {
+					cfg.Instantiations[path] = make(map[string]string)
+				}
+				if prev, ok := cfg.Instantiations[path][expr]; ok && prev != alias {
+					problem("generic_functions: %s: %s is instantiated as %s already", path, expr, prev)
+					continue
+				}
+				cfg.Instantiations[path][expr] = alias
+			}
+		}
+	}
+	for path, instances := range cfg.Instantiations {
+		for expr, alias := range instances {
+			if typeArgCount(expr) < 0 {
+				problem("instantiations: %s: %q isn't an instantiation like Set[string]", path, expr)
+			}
+			if !token.IsIdentifier(alias) {
+				problem("instantiations: %s: %q isn't an identifier", path, alias)
+			}
+		}
+	}
+	for path, fns := range cfg.FunctionTypes {
+		for _, fn := range fns {
+			if !token.IsIdentifier(fn) {
+				problem("function_types: %s: %q isn't an identifier", path, fn)
+			}
+		}
+	}
+	for i, p := range cfg.Packages {
+		if p.Dir == "" || p.Path == "" {
+			problem("packages: entry %d needs a dir and a path", i+1)
+			continue
+		}
+		if !filepath.IsAbs(p.Dir) {
+			cfg.Packages[i].Dir = filepath.Join(filepath.Dir(name), p.Dir)
+		}
+		if fi, err := os.Stat(cfg.Packages[i].Dir); err != nil || !fi.IsDir() {
+			problem("packages: entry %d: %s isn't a directory", i+1, p.Dir)
+		}
+		if p.Init != "" && !token.IsIdentifier(p.Init) {
+			problem("packages: entry %d: init %q isn't an identifier", i+1, p.Init)
+		}
+	}
+	for iface, methods := range cfg.Interfaces {
+		for m, sig := range methods {
+			// normalized like the signatures of the methods
+			x, err := parser.ParseExpr(sig)
+			ft, ok := x.(*ast.FuncType)
+			if err != nil || !ok {
+				problem("interfaces: %s.%s: %q isn't a function type", iface, m, sig)
+				continue
+			}
+			methods[m] = funcTypeString(ft)
+		}
+	}
+	for kind, format := range cfg.ValueFormats {
+		switch kind {
+		case "const", "var", "func":
+		default:
+			problem("value_formats: unknown kind %q, want const, var or func", kind)
+		}
+		if strings.Count(format, "%") != 1 || strings.Count(format, "%s") != 1 {
+			problem("value_formats: %q must contain %%s once", format)
+		}
+	}
+	if len(problems) > 0 {
+		// the maps are iterated in random order
+		sort.Strings(problems)
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// validateConfigFiles loads the files of -config, -overlay, -template,
+// -header-file and -footer-file for -validate-config, logging the problems
+// of all of them, and returns the exit code.
+func validateConfigFiles() int {
+	code := 0
+	for _, f := range []struct {
+		name string
+		load func(string) error
+	}{
+		{*conf, loadConfig},
+		{*ovl, loadOverlay},
+		{*tmpl, loadTemplate},
+		{*headerFile, readable},
+		{*footerFile, readable},
+	} {
+		if f.name == "" {
+			continue
+		}
+		if err := f.load(f.name); err != nil {
+			log.Print(err)
+			code = 1
+		}
+	}
+	if code == 0 {
+		infof("config ok")
+	}
+	return code
+}
+
+func readable(name string) error {
+	_, err := readLines(name)
+	return err
+}
+
+// valueFormat returns the format of the env.Packages entries of kind.
+func valueFormat(kind string) string {
+	if format, ok := cfg.ValueFormats[kind]; ok {
+		return tabs + `"%s": ` + format + ","
+	}
+	return kindFormat(valFormat, interfaceValFormat)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"go/build/constraint"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	constraintFileTemplate = `
+//go:build %s
+
+// Code generated by anko-package-gen2 %s. DO NOT EDIT.
+
+package %s
+
+import (
+	"reflect"
+
+%s)
+
+func init%s() {
+%s}
+`
+
+	otherConstraintFileTemplate = `
+//go:build %s
+
+// Code generated by anko-package-gen2 %s. DO NOT EDIT.
+
+package %s
+
+func init%s() {}
+`
+)
+
+// fileFilter replaces the build constraints of the target in matchFile, if
+// set.
+var fileFilter func(dir, name string) bool
+
+// The known GOOS and GOARCH values, implied by file name suffixes.
+var (
+	knownOS = map[string]bool{
+		"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true, "hurd": true,
+		"illumos": true, "ios": true, "js": true, "linux": true, "nacl": true, "netbsd": true,
+		"openbsd": true, "plan9": true, "solaris": true, "wasip1": true, "windows": true, "zos": true,
+	}
+	knownArch = map[string]bool{
+		"386": true, "amd64": true, "amd64p32": true, "arm": true, "armbe": true, "arm64": true,
+		"arm64be": true, "loong64": true, "mips": true, "mipsle": true, "mips64": true, "mips64le": true,
+		"mips64p32": true, "mips64p32le": true, "ppc": true, "ppc64": true, "ppc64le": true, "riscv": true,
+		"riscv64": true, "s390": true, "s390x": true, "sparc": true, "sparc64": true, "wasm": true,
+	}
+)
+
+// constraints records the build constraints of the source files met in
+// -by-constraint mode, in order, with the imports and code of their files.
+var constraints struct {
+	exprs   []string
+	imports []string
+	srcs    []string
+}
+
+// constraintIndex returns the index of the constraint expr, adding it.
+func constraintIndex(expr string) int {
+	for i, e := range constraints.exprs {
+		if e == expr {
+			return i
+		}
+	}
+	constraints.exprs = append(constraints.exprs, expr)
+	constraints.imports = append(constraints.imports, "")
+	constraints.srcs = append(constraints.srcs, "")
+	return len(constraints.exprs) - 1
+}
+
+// fileConstraint returns the build constraint of the file, from its
+// //go:build line and the GOOS and GOARCH suffixes of its name, or "" if it
+// has none.
+func fileConstraint(dir, name string) (string, error) {
+	filename := filepath.Join(dir, name)
+	src, err := readFile(filename)
+	if err != nil {
+		return "", err
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), filename, src, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+	var exprs []string
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if constraint.IsGoBuild(c.Text) {
+				expr, err := constraint.Parse(c.Text)
+				if err != nil {
+					return "", fmt.Errorf("%s: %v", filename, err)
+				}
+				exprs = append(exprs, expr.String())
+			}
+		}
+	}
+	elems := strings.Split(strings.TrimSuffix(name, ".go"), "_")
+	n := len(elems)
+	switch {
+	case n > 2 && knownOS[elems[n-2]] && knownArch[elems[n-1]]:
+		exprs = append(exprs, elems[n-2]+" && "+elems[n-1])
+	case n > 1 && (knownOS[elems[n-1]] || knownArch[elems[n-1]]):
+		exprs = append(exprs, elems[n-1])
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	for i, expr := range exprs {
+		exprs[i] = "(" + expr + ")"
+	}
+	return strings.Join(exprs, " && "), nil
+}
+
+// exportConstraints collects the package in dir once per build constraint of
+// its files. The symbols of the unconstrained files are generated like
+// exportDeclaration does, the others are added to the code of their
+// constraint, registered by the constraint files.
+func exportConstraints(root, path, dir, init, fileName string) (string, error) {
+	dir = filepath.Join(root, dir)
+	names, err := readDirNames(dir)
+	if err != nil {
+		return "", err
+	}
+	groups := make(map[string]map[string]bool)
+	for _, name := range names {
+		if !isGoFile(name) {
+			continue
+		}
+		expr, err := fileConstraint(dir, name)
+		if err != nil {
+			return "", err
+		}
+		if groups[expr] == nil {
+			groups[expr] = make(map[string]bool)
+		}
+		groups[expr][name] = true
+	}
+	exprs := make([]string, 0, len(groups))
+	for expr := range groups {
+		exprs = append(exprs, expr)
+	}
+	sort.Strings(exprs)
+
+	defer func() {
+		fileFilter = nil
+	}()
+	var src string
+	for _, expr := range exprs {
+		files := groups[expr]
+		fileFilter = func(_, name string) bool {
+			return files[name]
+		}
+		d, err := collectDeclaration(dir, path, ".", init)
+		if err != nil {
+			return "", err
+		}
+		if d == nil || d.empty() {
+			continue
+		}
+		if err := d.record(); err != nil {
+			return "", err
+		}
+		if expr == "" {
+			if src, err = d.generate(); err != nil {
+				return "", err
+			}
+			continue
+		}
+		i := constraintIndex(expr)
+		constraints.imports[i] += importSpec(path)
+		constraints.srcs[i] += d.addCode(fileName)
+	}
+	return src, nil
+}
+
+// writeConstraintFiles writes a file per constraint registering its
+// symbols, and one defining its init function for the other builds. inits
+// are the names of the init functions, without their init prefix.
+func writeConstraintFiles(inits []string) error {
+	args := runArgs()
+	for i, expr := range constraints.exprs {
+		other, err := negate(expr)
+		if err != nil {
+			return err
+		}
+		files := []struct {
+			name, code string
+		}{
+			{fmt.Sprintf("%s_constraint%d.go", *name, i+1), fmt.Sprintf(constraintFileTemplate[1:], expr, args, *pkgClause, constraints.imports[i], inits[i], constraints.srcs[i])},
+			{fmt.Sprintf("%s_constraint%d_other.go", *name, i+1), fmt.Sprintf(otherConstraintFileTemplate[1:], other, args, *pkgClause, inits[i])},
+		}
+		for _, f := range files {
+			src, err := format.Source([]byte(f.code))
+			if err != nil {
+				return err
+			}
+			if err := writeOutput(f.name, src); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// negate returns the negation of the constraint expr. gofmt drops the
+// parentheses of !(!tag), which go vet rejects as a double negation.
+func negate(expr string) (string, error) {
+	x, err := constraint.Parse("//go:build " + expr)
+	if err != nil {
+		return "", err
+	}
+	if not, ok := x.(*constraint.NotExpr); ok {
+		return not.X.String(), nil
+	}
+	return "!(" + x.String() + ")", nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// depEntry is a bound constant referring to constants of other packages,
+// in the -with-deps file.
+type depEntry struct {
+	Path string   `json:"path"`
+	Name string   `json:"name"`
+	Deps []string `json:"deps"`
+}
+
+// depEntries records the constants of this run with dependencies.
+var depEntries []depEntry
+
+func addDeps(d *declaration) {
+	for _, syms := range [][]*symbol{d.constants, d.deprecated[0]} {
+		for _, c := range syms {
+			if len(c.deps) == 0 {
+				continue
+			}
+			var deps []string
+			seen := make(map[string]bool)
+			for _, dep := range c.deps {
+				if !seen[dep] {
+					seen[dep] = true
+					deps = append(deps, dep)
+				}
+			}
+			sort.Strings(deps)
+			depEntries = append(depEntries, depEntry{Path: d.path, Name: c.name, Deps: deps})
+		}
+	}
+}
+
+// writeDeps writes the constants of this run depending on other packages
+// to filename, sorted by package and name.
+func writeDeps(filename string) error {
+	entries := append([]depEntry{}, depEntries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Path != entries[j].Path {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	b, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFile(filename, append(b, '\n'))
+}
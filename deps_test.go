@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestConstantDeps checks that the constants defined from the constants of
+// other packages are bound like the others, and that -with-deps records
+// what they refer to.
+func TestConstantDeps(t *testing.T) {
+	cache := writeModule(t, "limits", map[string]string{
+		"other/other.go": "package other\n\nconst (\n\tMax = 10\n\tMin = 1\n)\n",
+		"limits.go": `package limits
+
+import (
+	"time"
+
+	"example.com/limits/other"
+	o "example.com/limits/other"
+)
+
+const Limit = other.Max
+
+const (
+	Double = other.Max * iota
+	Triple
+)
+
+const Span = o.Max - o.Min + other.Max
+
+const Timeout = 3 * time.Second
+
+const Local = 3
+
+const NotDep = len("other.Max")
+`,
+	})
+	r := runGenerator(t, cache, nil, nil, "-pkg", "example.com/limits", "-v", "v1.0.0", "-name", "limits", "-quiet", "-with-deps", "deps.json")
+	if r.err != nil {
+		t.Fatalf("%v\n%s", r.err, r.stderr)
+	}
+	files := r.output(t)
+	bound := values(mapEntries(t, files, "Packages", "example.com/limits"))
+	for _, key := range []string{"Limit", "Double", "Triple", "Span", "Timeout", "Local", "NotDep"} {
+		if want := "reflect.ValueOf(limits." + key + ")"; bound[key] != want {
+			t.Errorf("%s is registered as %q, want %q", key, bound[key], want)
+		}
+	}
+	compile(t, files, "anko", cache, []string{"limits"})
+
+	b, err := os.ReadFile(filepath.Join(r.dir, "deps.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []depEntry
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []depEntry{
+		{"example.com/limits", "Double", []string{"example.com/limits/other.Max"}},
+		{"example.com/limits", "Limit", []string{"example.com/limits/other.Max"}},
+		{"example.com/limits", "Span", []string{"example.com/limits/other.Max", "example.com/limits/other.Min"}},
+		{"example.com/limits", "Timeout", []string{"time.Second"}},
+		{"example.com/limits", "Triple", []string{"example.com/limits/other.Max"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("deps.json holds %+v, want %+v", got, want)
+	}
+}
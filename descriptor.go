@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// packageDescriptor lists the symbols bound for a package, by kind.
+type packageDescriptor struct {
+	Path      string   `json:"path"`
+	Name      string   `json:"name"`
+	Constants []string `json:"constants,omitempty"`
+	Variables []string `json:"variables,omitempty"`
+	Functions []string `json:"functions,omitempty"`
+	Types     []string `json:"types,omitempty"`
+}
+
+// descriptors records every package exported in this run.
+var descriptors []packageDescriptor
+
+func symbolNames(syms []*symbol) []string {
+	if len(syms) == 0 {
+		return nil
+	}
+	s := make([]string, len(syms))
+	for i, sym := range syms {
+		s[i] = sym.name
+	}
+	return s
+}
+
+func addDescriptor(path, name string, constants, vars, types, fns []*symbol) {
+	descriptors = append(descriptors, packageDescriptor{
+		Path:      path,
+		Name:      name,
+		Constants: symbolNames(constants),
+		Variables: symbolNames(vars),
+		Functions: symbolNames(fns),
+		Types:     symbolNames(types),
+	})
+}
+
+// marshalDescriptors returns the -format json output.
+func marshalDescriptors() ([]byte, error) {
+	return json.MarshalIndent(descriptors, "", "\t")
+}
+
+func (d packageDescriptor) count() int {
+	return len(d.Constants) + len(d.Variables) + len(d.Functions) + len(d.Types)
+}
+
+// logLargest logs the n packages exporting the most symbols.
+func logLargest(n int) {
+	s := append([]packageDescriptor(nil), descriptors...)
+	sort.SliceStable(s, func(i, j int) bool {
+		return s[i].count() > s[j].count()
+	})
+	if len(s) > n {
+		s = s[:n]
+	}
+	infof("largest packages:")
+	for _, d := range s {
+		infof("\t%s: %d symbols", d.Path, d.count())
+	}
+}
+
+// packageCoverage compares the exported symbols of a package in the source
+// with the ones bound, for -coverage.
+type packageCoverage struct {
+	Path    string          `json:"path"`
+	Total   int             `json:"total"`
+	Emitted int             `json:"emitted"`
+	Skipped string          `json:"skipped,omitempty"`
+	Dropped []droppedSymbol `json:"dropped,omitempty"`
+
+	// exported only by files excluded by the build constraints of the target
+	Filtered int `json:"filtered,omitempty"`
+
+	// the numbers of constants, variables, types and functions bound
+	counts [4]int
+}
+
+var coverage []packageCoverage
+
+func addCoverage(d *declaration) {
+	emitted := len(d.constants) + len(d.variables) + len(d.types) + len(d.functions)
+	coverage = append(coverage, packageCoverage{
+		Path:    d.path,
+		Total:   emitted + len(d.dropped),
+		Emitted: emitted,
+		Skipped: d.skipped,
+		Dropped: d.dropped,
+
+		Filtered: d.filtered,
+
+		counts: [4]int{len(d.constants), len(d.variables), len(d.types), len(d.functions)},
+	})
+}
+
+// writeSummary writes the numbers of symbols bound per package, and their
+// totals, for -summary.
+func writeSummary(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+	var total [4]int
+	for _, c := range coverage {
+		fmt.Fprintf(tw, "%s:\t%d consts,\t%d vars,\t%d types,\t%d funcs", c.Path, c.counts[0], c.counts[1], c.counts[2], c.counts[3])
+		if c.Skipped != "" {
+			fmt.Fprintf(tw, " (skipped: %s)", c.Skipped)
+		}
+		fmt.Fprintln(tw)
+		for i, n := range c.counts {
+			total[i] += n
+		}
+	}
+	fmt.Fprintf(tw, "total (%d packages):\t%d consts,\t%d vars,\t%d types,\t%d funcs\n", len(coverage), total[0], total[1], total[2], total[3])
+	return tw.Flush()
+}
+
+// filteredCount returns the number of symbols only exported on other
+// platforms than the target.
+func filteredCount() int {
+	n := 0
+	for _, c := range coverage {
+		n += c.Filtered
+	}
+	return n
+}
+
+func marshalCoverage() ([]byte, error) {
+	return json.MarshalIndent(coverage, "", "\t")
+}
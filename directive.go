@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// pathFlags take file paths, which are made relative to the output
+// directory where go generate runs the directive.
+var pathFlags = map[string]bool{
+	"archive":     true,
+	"baseline":    true,
+	"config":      true,
+	"coverage":    true,
+	"footer-file": true,
+	"header-file": true,
+	"index":       true,
+	"overlay":     true,
+	"template":    true,
+	"verify":      true,
+}
+
+// writeGenerateFile writes generate.go to the output directory, holding the
+// //go:generate directive reproducing this run.
+func writeGenerateFile() error {
+	dir, err := filepath.Abs(*o)
+	if err != nil {
+		return err
+	}
+	// the output directory is the working directory of go generate
+	args := []string{"anko-package-gen2", "-o=."}
+	flag.Visit(func(f *flag.Flag) {
+		value := f.Value.String()
+		switch {
+		case f.Name == "o" || f.Name == "check":
+			return
+		case pathFlags[f.Name] && value != "":
+			if abs, err := filepath.Abs(value); err == nil {
+				if rel, err := filepath.Rel(dir, abs); err == nil {
+					value = filepath.ToSlash(rel)
+				}
+			}
+		}
+		arg := "-" + f.Name + "=" + value
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() && value == "true" {
+			arg = "-" + f.Name
+		}
+		if strings.ContainsAny(arg, " \t\"") {
+			arg = strconv.Quote(arg)
+		}
+		args = append(args, arg)
+	})
+	src := fmt.Sprintf("package %s\n\n//go:generate %s\n", *pkgClause, strings.Join(args, " "))
+	return output().Write("generate.go", []byte(src))
+}
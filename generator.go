@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	"go/ast"
+	"go/build"
 	"go/parser"
+	"go/scanner"
 	"go/token"
-	"os"
+	"go/types"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -15,73 +17,614 @@ import (
 const (
 	initTemplate = `
 func init%s() {
-	env.Packages["%s"] = map[string]reflect.Value{
-		// constants
+%s%s%s%s%s%s}
+`
+
+	packagesTemplate = `	env.Packages["%s"] = map[string]%s{
+%s	}
+`
+
+	packageTypesTemplate = `	env.PackageTypes["%s"] = map[string]reflect.Type{
+%s	}
+`
+
+	packageConvertersTemplate = `	env.PackageConverters["%s"] = map[string]%s{
+%s	}
+`
+
+	packageNewTemplate = `	env.PackageNew["%s"] = map[string]%s{
+%s	}
+`
+
+	deprecatedPackagesTemplate = `	env.DeprecatedPackages["%s"] = map[string]%s{
+%s	}
+`
+
+	deprecatedPackageTypesTemplate = `	env.DeprecatedPackageTypes["%s"] = map[string]reflect.Type{
+%s	}
+`
+
+	// body of env.Packages, unless in compact mode
+	valuesTemplate = `		// constants
 %s
 		// variables
 %s
 		// functions
-%s	}
-	env.PackageTypes["%s"] = map[string]reflect.Type{
-%s	}
-}
-`
+%s`
 
 	tabs = "\t\t"
 
 	// "Compare": reflect.ValueOf(bytes.Compare),
-	valFormat = tabs + `"%s": reflect.ValueOf(%s.%s),` + "\n"
+	valFormat = tabs + `"%s": reflect.ValueOf(%s),`
+
+	// "Compare": bytes.Compare, with -value-kind interface
+	interfaceValFormat = tabs + `"%s": %s,`
 
 	// "Conn": reflect.TypeOf(&conn).Elem(),
-	typeFormat = tabs + `"%s": reflect.TypeOf((*%s.%s)(nil)).Elem(),` + "\n"
+	typeFormat = tabs + `"%s": reflect.TypeOf((*%s)(nil)).Elem(),`
+
+	// "Compare": reflect.TypeOf(bytes.Compare),
+	funcTypeFormat = tabs + `"%s": reflect.TypeOf(%s.%s),`
+
+	// "Buffer": reflect.ValueOf(func() interface{} { return new(bytes.Buffer) }),
+	newFormat = tabs + `"%s": reflect.ValueOf(func() interface{} { return new(%s.%s) }),`
+
+	// "Buffer": func() interface{} { return new(bytes.Buffer) },
+	interfaceNewFormat = tabs + `"%s": func() interface{} { return new(%s.%s) },`
+
+	// env.TypeNames[reflect.TypeOf((*bytes.Buffer)(nil)).Elem()] = "bytes.Buffer"
+	typeNameFormat = "\tenv.TypeNames[reflect.TypeOf((*%s)(nil)).Elem()] = \"%s.%s\"\n"
+
+	// "Month": reflect.ValueOf(func(x int64) time.Month { return time.Month(x) }),
+	convertFormat = tabs + `"%s": reflect.ValueOf(func(x %s) %s.%s { return %s.%s(x) }),`
+
+	// "Month": func(x int64) time.Month { return time.Month(x) },
+	interfaceConvertFormat = tabs + `"%s": func(x %s) %s.%s { return %s.%s(x) },`
 )
 
-func exportDeclaration(root, path, dir, init string) (string, error) {
-	packages, err := parseDir(filepath.Join(root, dir))
+// symbol is an exported declaration emitted as an entry of a binding map.
+type symbol struct {
+	name  string   // map key
+	expr  string   // expression qualified by the package name, e.g. "Set[string]"
+	node  ast.Node // declaring FuncDecl or spec, if any
+	notes []string // emitted as a trailing comment
+	docs  []string // emitted as comment lines above the entry
+	group string   // sub-section of the map literal, if any
+
+	dropped     string   // reason the symbol isn't exported, if any
+	deprecation string   // the "Deprecated:" paragraph of deprecated symbols
+	signature   string   // declaration of functions, for -index
+	deps        []string // constants of other packages the value refers to, for -with-deps
+	addr        bool     // registered by address, so scripts see assignments
+	typ         ast.Expr // declared type of constants and variables, if any
+
+	convert string // parameter type of the converter of a numeric type, if any
+	conv    string // type the value is converted to, e.g. uint64 for untyped constants overflowing int
+	pos     string // source position of the declaration, if any
+
+	funcType bool // the function's type is registered into env.PackageTypes too
+	ptr      bool // the pointer type is registered, for types
+
+	origin *ast.TypeSpec // generic type instantiated by an alias, like Set for IntSet = Set[int]
+}
+
+func newSymbol(name string, node ast.Node) *symbol {
+	return &symbol{name: name, expr: name, node: node}
+}
+
+func (s *symbol) note(format string, a ...interface{}) {
+	s.notes = append(s.notes, fmt.Sprintf(format, a...))
+}
+
+// declaration holds the sorted symbols exported by a package.
+type declaration struct {
+	path string // import path
+	name string // package name
+	init string // init function suffix
+
+	constants []*symbol
+	variables []*symbol
+	types     []*symbol
+	functions []*symbol
+
+	// the deprecated constants, variables, types and functions bound
+	// separately with -emit-deprecated-separately
+	deprecated [4][]*symbol
+
+	// the parsed source, kept with -template to type-check its output
+	fset  *token.FileSet
+	files []*ast.File
+
+	dropped  []droppedSymbol // exported in the source but not bound
+	skipped  string          // reason the whole package is skipped, if any
+	filtered int             // exported names only declared by files excluded by build constraints
+}
+
+// droppedSymbol is an exported symbol left out of the bindings.
+type droppedSymbol struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Reason string `json:"reason"`
+}
+
+// takeDeprecated removes the symbols of m only dropped for being deprecated
+// and returns them, documented with their deprecation notice.
+func takeDeprecated(m map[string]*symbol) []*symbol {
+	taken := make(map[string]*symbol)
+	for _, sym := range m {
+		if sym.dropped == "deprecated" {
+			sym.dropped = ""
+			sym.docs = append(sym.docs, sym.deprecation)
+			taken[sym.name] = sym
+			delete(m, sym.name)
+		}
+	}
+	return sortSymbols(taken)
+}
+
+// deprecation returns the first "Deprecated:" paragraph of the docs, joined
+// on one line.
+func deprecation(docs ...*ast.CommentGroup) string {
+	for _, doc := range docs {
+		for _, para := range strings.Split(doc.Text(), "\n\n") {
+			if para = strings.TrimSpace(para); strings.HasPrefix(para, "Deprecated:") || strings.HasPrefix(para, "Deprecated.") {
+				return strings.Join(strings.Fields(para), " ")
+			}
+		}
+	}
+	return ""
+}
+
+// groupDirective returns the group named by the first //anko:group
+// directive of the docs, e.g. "group: network" for //anko:group network, or
+// "" if there is none. Docs are given from the innermost, so a spec's
+// directive wins over its block's.
+func groupDirective(docs ...*ast.CommentGroup) string {
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		for _, c := range doc.List {
+			if !strings.HasPrefix(c.Text, "//anko:group ") {
+				continue
+			}
+			if group := strings.TrimSpace(strings.TrimPrefix(c.Text, "//anko:group ")); group != "" {
+				return "group: " + group
+			}
+		}
+	}
+	return ""
+}
+
+// removeDropped removes the dropped symbols from m and returns them.
+func removeDropped(kind string, m map[string]*symbol) []droppedSymbol {
+	removed := make(map[string]*symbol)
+	for _, sym := range m {
+		if sym.dropped != "" {
+			removed[sym.name] = sym
+			delete(m, sym.name)
+		}
+	}
+	var s []droppedSymbol
+	for _, sym := range sortSymbols(removed) {
+		s = append(s, droppedSymbol{Name: sym.name, Kind: kind, Reason: sym.dropped})
+	}
+	return s
+}
+
+// empty reports whether nothing is registered for the package.
+func (d *declaration) empty() bool {
+	return d.skipped != "" || len(d.constants) == 0 && len(d.variables) == 0 && len(d.types) == 0 && len(d.functions) == 0 &&
+		len(d.deprecated[0]) == 0 && len(d.deprecated[1]) == 0 && len(d.deprecated[2]) == 0 && len(d.deprecated[3]) == 0 &&
+		len(manualEntries["Packages"][d.path]) == 0 && len(manualEntries["PackageTypes"][d.path]) == 0
+}
+
+// exportDeclaration returns the code registering the package, and with
+// -shard or -split-by-kind the code of the split files, adding the symbols
+// through the helpers named after fileName.
+func exportDeclaration(root, path, dir, init, fileName string) (string, []string, error) {
+	d, err := collectDeclaration(root, path, dir, init)
+	if err != nil || d == nil {
+		return "", nil, err
+	}
+	if sinceTree != "" {
+		if err := keepAdded(d, root, dir); err != nil {
+			return "", nil, err
+		}
+	}
+	if intersectModule != "" {
+		if err := keepCommon(d, root, dir); err != nil {
+			return "", nil, err
+		}
+	}
+	addCoverage(d)
+	if d.empty() {
+		return "", nil, nil
+	}
+	if err := d.record(); err != nil {
+		return "", nil, err
+	}
+	var split []*declaration
+	switch {
+	case *splitKinds:
+		split = d.splitByKind()
+	case *shardCount > 1:
+		split = d.shard(*shardCount)
+	}
+	shards := make([]string, len(split))
+	for i, s := range split {
+		shards[i] = s.addCode(fileName)
+	}
+	if d.empty() {
+		return "", shards, nil
+	}
+	src, err := d.generate()
+	return src, shards, err
+}
+
+// collectDeclaration collects the exported symbols of the package in dir. It
+// returns nil when the directory has no package, e.g. when it only holds
+// _test.go and example_ files.
+func collectDeclaration(root, path, dir, init string) (*declaration, error) {
+	fset, packages, err := parseDir(filepath.Join(root, dir))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	name := getPackageName(packages)
 	pak := packages[name]
 	if pak == nil {
-		return "", nil
+		filtered, err := filteredExports(filepath.Join(root, dir), "")
+		if err != nil || len(filtered) == 0 {
+			return nil, err
+		}
+		return &declaration{path: path, init: init, skipped: "excluded by build constraints", filtered: len(filtered)}, nil
 	}
-	constants := make(map[string]struct{})
-	variables := make(map[string]struct{})
-	types := make(map[string]struct{})
-	functions := make(map[string]struct{})
-	for _, file := range pak.Files {
+	if *skipDeprecatedPackages && isDeprecatedPackage(filepath.Join(root, dir), pak) {
+		infof("skipping deprecated package %s", path)
+		return &declaration{path: path, name: name, init: init, skipped: "deprecated package"}, nil
+	}
+	if *checkImports {
+		warnUnresolvedImports(filepath.Join(root, dir), path, pak)
+	}
+	info := typeCheck(fset, path, pak)
+	files := sortedFiles(pak)
+	counts := countDecls(files)
+	constants := make(map[string]*symbol, counts[token.CONST])
+	variables := make(map[string]*symbol, counts[token.VAR])
+	types := make(map[string]*symbol, counts[token.TYPE])
+	functions := make(map[string]*symbol, counts[token.FUNC])
+	generics := make(map[string]*ast.TypeSpec)
+	opaque := make(map[string]struct{})
+	errorTypes := make(map[string]struct{})
+	receivers := make(map[string]*receiverKinds)
+	methods := make(map[string]map[string]method)
+	internalFuncs := make(map[string]string)
+	internalVars := make(map[string]string)
+	cgoRefs := make(map[string]string)
+	envVars := make(map[string]string)
+	pkgFuncs := make(map[string]struct{})
+	importedRefs := make(map[string]string)
+	for _, file := range files {
 		for _, decl := range file.Decls {
 			switch decl := decl.(type) {
 			case *ast.GenDecl:
 				switch decl.Tok {
 				case token.CONST:
 					exportValues(decl, constants)
+					if *withDeps != "" {
+						constantDeps(file, decl, constants)
+					}
 				case token.VAR:
 					exportValues(decl, variables)
+					for _, spec := range decl.Specs {
+						vs, ok := spec.(*ast.ValueSpec)
+						if !ok {
+							continue
+						}
+						for i, id := range vs.Names {
+							if vs.Type != nil {
+								internalRef(file, vs.Type, id.Name, internalVars)
+								cgoRef(file, vs.Type, id.Name, cgoRefs)
+							}
+							if len(vs.Values) == 1 && len(vs.Names) > 1 {
+								// the results of a call, like `var Host, _ = os.Hostname()`
+								envRef(file, vs.Values[0], id.Name, envVars)
+							}
+							if len(vs.Values) == len(vs.Names) {
+								if vs.Type == nil {
+									cgoRef(file, initType(vs.Values[i]), id.Name, cgoRefs)
+								}
+								envRef(file, vs.Values[i], id.Name, envVars)
+								importedRef(file, vs.Values[i], id.Name, importedRefs)
+							}
+						}
+					}
 				case token.TYPE:
-					exportTypes(decl, types)
+					exportTypes(decl, types, generics)
+					opaqueStructs(decl, opaque)
+					dropMigrationAliases(file, decl, types)
 				}
 			case *ast.FuncDecl:
 				exportFunction(decl, functions)
+				errorMethod(decl, errorTypes)
+				countReceiver(decl, receivers)
+				collectMethod(decl, methods)
+				if decl.Recv == nil {
+					pkgFuncs[decl.Name.Name] = struct{}{}
+					internalRef(file, decl.Type, decl.Name.Name, internalFuncs)
+					cgoRef(file, decl.Type, decl.Name.Name, cgoRefs)
+				}
+			}
+		}
+	}
+	if !*keepLinkname {
+		for _, file := range files {
+			dropLinknamed(file, functions)
+		}
+	}
+	filtered, err := filteredExports(filepath.Join(root, dir), name)
+	if err != nil {
+		return nil, err
+	}
+	warnCollisions(path, filtered, constants, variables, types, functions)
+	for key := range filtered {
+		for _, m := range []map[string]*symbol{constants, variables, types, functions} {
+			if _, ok := m[key]; ok {
+				delete(filtered, key)
+			}
+		}
+	}
+	resolveGenericAliases(pak, types, opaque)
+	if *instantiateAny {
+		exportAnyInstantiations(types, generics)
+	}
+	exportInstantiations(cfg.Instantiations[path], types, functions, generics)
+	if err := checkInstantiations(fset, path, pak, cfg.Instantiations[path], functions); err != nil {
+		return nil, err
+	}
+	if !*strictSignatures {
+		warnUninstantiatedResults(path, functions, types, generics)
+	}
+	for _, m := range []map[string]*symbol{constants, variables, functions} {
+		dropManual("Packages", path, m)
+	}
+	dropManual("PackageTypes", path, types)
+	for _, m := range []map[string]*symbol{constants, variables, functions, types} {
+		handleNonASCII(m)
+	}
+	consts := localConstants(fset, path, pak, constants)
+	big := bigConstants(consts)
+	for _, c := range constants {
+		// keyed by identifier, unlike constants with -non-ascii ascii
+		c.conv = big[c.expr]
+		if lc, ok := consts[c.expr]; ok && *skipComplex && isComplex(lc) && c.dropped == "" {
+			c.dropped = "complex"
+		}
+	}
+	keepSignatureTypes(path, types, variables, functions)
+	dropInternalRefs(path, "function", functions, internalFuncs)
+	dropInternalRefs(path, "variable", variables, internalVars)
+	for _, m := range []map[string]*symbol{variables, functions} {
+		for key, ref := range cgoRefs {
+			if sym, ok := m[key]; ok && sym.dropped == "" {
+				sym.dropped = "cgo type " + ref
+			}
+		}
+	}
+	if *strictSignatures {
+		dropUnnameableSignatures(path, functions, types, internalFuncs)
+	}
+	for kind, m := range map[string]map[string]*symbol{"const": constants, "var": variables, "type": types, "func": functions} {
+		if exportKinds[kind] {
+			continue
+		}
+		for _, sym := range m {
+			if sym.dropped == "" {
+				sym.dropped = "kind not selected"
+			}
+		}
+	}
+	if *indexFile != "" {
+		for _, fn := range functions {
+			if decl, ok := fn.node.(*ast.FuncDecl); ok {
+				fn.signature = signature(info, path, decl)
+			}
+		}
+	}
+	if approvedSymbols != nil {
+		for _, m := range []map[string]*symbol{constants, variables, types, functions} {
+			dropUnapproved(path, m)
+		}
+	}
+	var deprecated [4][]*symbol
+	if *emitDeprecated {
+		for k, m := range []map[string]*symbol{constants, variables, types, functions} {
+			deprecated[k] = takeDeprecated(m)
+		}
+	}
+	var dropped []droppedSymbol
+	for _, kind := range []struct {
+		name string
+		m    map[string]*symbol
+	}{{"const", constants}, {"var", variables}, {"type", types}, {"func", functions}} {
+		dropped = append(dropped, removeDropped(kind.name, kind.m)...)
+	}
+	if *warnCase {
+		warnCaseCollisions(path, "value", constants, variables, functions)
+		warnCaseCollisions(path, "type", types)
+	}
+	warnUnexportedTypes(path, constants)
+	noteOpaqueParams(functions, opaque)
+	if *noteChannels {
+		noteChannelResults(functions)
+	}
+	addressNilVars(variables, types)
+	if !*arraysByValue {
+		addressArrays(variables, types)
+	}
+	if !*envByValue {
+		for key := range envVars {
+			if v, ok := variables[key]; ok {
+				v.addr = true
+			}
+		}
+	}
+	if *classifyVars {
+		classifyVariables(info, variables, functions, methods, pkgFuncs, importedRefs)
+	}
+	for _, key := range cfg.FunctionTypes[path] {
+		if fn, ok := functions[key]; ok {
+			fn.funcType = true
+		} else {
+			infof("warning: %s: %s is not an exported function, skipping its type", path, key)
+		}
+	}
+	if *constructors {
+		groupConstructors(functions, types)
+	}
+	if *groupFallible {
+		groupFallibleFunctions(functions)
+	}
+	if *groupErrors {
+		groupErrorTypes(types, errorTypes)
+	}
+	if *groupConstants {
+		groupConstantsByType(constants)
+	}
+	if *converters {
+		addConverters(constants, types)
+	}
+	if *withValues {
+		noteLiteralValues(constants)
+	}
+	if *iotaValues {
+		noteIotaValues(info, constants, consts)
+	}
+	for _, m := range []map[string]*symbol{constants, variables, types, functions} {
+		for _, sym := range m {
+			if sym.node == nil {
+				continue
+			}
+			pos := fset.Position(sym.node.Pos())
+			sym.pos = pos.String()
+			if *withPositions {
+				sym.docs = append(sym.docs, fmt.Sprintf("defined at %s:%d", filepath.Base(pos.Filename), pos.Line))
+			}
+		}
+	}
+	pointerOnlyTypes(path, types, receivers)
+	if *withDocs {
+		for _, fn := range functions {
+			if decl, ok := fn.node.(*ast.FuncDecl); ok {
+				fn.docs = append(fn.docs, signature(info, path, decl))
+			}
+		}
+		noteInterfaces(types, methods)
+		documentCompositeTypes(types)
+	}
+	d := &declaration{
+		deprecated: deprecated,
+		dropped:    dropped,
+		filtered:   len(filtered),
+		path:       path,
+		name:       name,
+		init:       init,
+		constants:  sortSymbols(constants),
+		variables:  sortSymbols(variables),
+		types:      sortSymbols(types),
+		functions:  sortSymbols(functions),
+	}
+	if userTemplate != nil {
+		d.fset, d.files = fset, files
+	}
+	return d, nil
+}
+
+// countDecls returns the number of package-level names declared by the
+// files by token, the functions under token.FUNC, to size the maps of the
+// symbols.
+func countDecls(files []*ast.File) map[token.Token]int {
+	counts := make(map[token.Token]int, 4)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.ValueSpec:
+						counts[decl.Tok] += len(spec.Names)
+					case *ast.TypeSpec:
+						counts[decl.Tok]++
+					}
+				}
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					counts[token.FUNC]++
+				}
+			}
+		}
+	}
+	return counts
+}
+
+// record adds the declaration to the descriptors of this run and applies
+// -max-symbols.
+func (d *declaration) record() error {
+	addDescriptor(d.path, d.name, d.constants, d.variables, d.types, d.functions)
+	if *indexFile != "" {
+		addIndexEntries(d)
+	}
+	if *withDeps != "" {
+		addDeps(d)
+	}
+	if n := len(d.constants) + len(d.variables) + len(d.types) + len(d.functions); *maxSymbols > 0 && n > *maxSymbols {
+		if !*warnMaxSymbols {
+			return fmt.Errorf("%s exports %d symbols, more than -max-symbols %d", d.path, n, *maxSymbols)
+		}
+		infof("warning: %s exports %d symbols, more than -max-symbols %d", d.path, n, *maxSymbols)
+	}
+	return nil
+}
+
+// generate returns the code registering the declaration.
+func (d *declaration) generate() (string, error) {
+	if err := checkUniqueValues(d.path, d.constants, d.variables, d.functions); err != nil {
+		return "", err
+	}
+	name := qualify(d.path, d.name)
+	if userTemplate != nil {
+		return executeTemplate(d.path, name, d.init, d.constants, d.variables, d.types, d.functions, d.fset, d.files)
+	}
+	return generateCode(d.path, name, d.init, d.constants, d.variables, d.types, d.functions, d.deprecated), nil
+}
+
+// checkUniqueValues fails when constants, variables and functions, which
+// share the env.Packages map, have a name in common. That can't happen
+// within one set of files, but would be a duplicate key of the map literal.
+func checkUniqueValues(path string, groups ...[]*symbol) error {
+	seen := make(map[string]*symbol)
+	for _, syms := range groups {
+		for _, sym := range syms {
+			if prev, ok := seen[sym.name]; ok {
+				return fmt.Errorf("%s: %s is declared twice, at %s and %s", path, sym.name, location(prev), location(sym))
 			}
+			seen[sym.name] = sym
 		}
 	}
-	if len(constants) == 0 && len(variables) == 0 && len(types) == 0 && len(functions) == 0 {
-		return "", nil
+	return nil
+}
+
+func location(sym *symbol) string {
+	if sym.pos == "" {
+		return "an unknown position"
 	}
-	cs := sortStringMap(constants)
-	vs := sortStringMap(variables)
-	ts := sortStringMap(types)
-	fs := sortStringMap(functions)
-	return generateCode(path, name, init, cs, vs, ts, fs), nil
+	return sym.pos
 }
 
-func isGoFile(info os.FileInfo) bool {
-	if info.IsDir() {
+func isGoFile(name string) bool {
+	if !strings.HasSuffix(name, ".go") {
 		return false
 	}
-	name := info.Name()
 	if name == "fuzz.go" {
 		return false
 	}
@@ -94,121 +637,2120 @@ func isGoFile(info os.FileInfo) bool {
 	return true
 }
 
-func parseDir(dir string) (map[string]*ast.Package, error) {
-	return parser.ParseDir(token.NewFileSet(), dir, isGoFile, parser.ParseComments)
+// buildContext evaluates build constraints, reading files through the overlay.
+var buildContext = func() build.Context {
+	ctxt := build.Default
+	ctxt.OpenFile = openFile
+	return ctxt
+}()
+
+// matchFile reports whether the file satisfies the build constraints
+// (GOOS, GOARCH, build tags) of the current build context.
+func matchFile(dir, name string) bool {
+	if fileFilter != nil {
+		return fileFilter(dir, name)
+	}
+	ok, err := buildContext.MatchFile(dir, name)
+	return err == nil && ok && !untagged(dir, name)
 }
 
-func getPackageName(packages map[string]*ast.Package) string {
-	var pkgName string
-loop:
-	for pn := range packages {
-		switch {
-		case pn == "main":
-		case strings.HasSuffix(pn, "_test"):
-		default:
-			pkgName = pn
-			break loop
+// untagged reports whether the file is built without the tag of
+// -require-tag, so its declarations are left out. Only the files requiring
+// the tag, like //go:build anko, are exported then.
+func untagged(dir, name string) bool {
+	if *requireTag == "" {
+		return false
+	}
+	ctxt := buildContext
+	ctxt.BuildTags = nil
+	for _, tag := range buildContext.BuildTags {
+		if tag != *requireTag {
+			ctxt.BuildTags = append(ctxt.BuildTags, tag)
 		}
 	}
-	return pkgName
+	ok, err := ctxt.MatchFile(dir, name)
+	return err == nil && ok
 }
 
-func isDeprecated(text string) bool {
-	for _, item := range [...]string{
-		"Deprecated:",
-		"Deprecated.",
-	} {
-		if strings.Contains(text, item) {
-			return true
-		}
+// parseDir parses the Go files of dir like parser.ParseDir, but reads them
+// through the overlay, or returns them as parsed ahead by -j.
+func parseDir(dir string) (*token.FileSet, map[string]*ast.Package, error) {
+	if future := takeParsed(dir); future != nil {
+		p := <-future
+		return p.fset, p.packages, p.err
 	}
-	return false
+	return parseFiles(dir)
 }
 
-func exportValues(decl *ast.GenDecl, m map[string]struct{}) {
-	if isDeprecated(decl.Doc.Text()) {
-		return
+func parseFiles(dir string) (*token.FileSet, map[string]*ast.Package, error) {
+	names, err := readDirNames(dir)
+	if err != nil {
+		return nil, nil, err
 	}
-	for _, spec := range decl.Specs {
-		vs := spec.(*ast.ValueSpec)
-		if isDeprecated(vs.Doc.Text()) {
+	fset := token.NewFileSet()
+	packages := make(map[string]*ast.Package)
+	for _, name := range names {
+		if !isGoFile(name) || !matchFile(dir, name) {
 			continue
 		}
-		for _, name := range vs.Names {
-			// skip some special variables
-			if name.Name == "ErrTrailingComma" {
+		filename := filepath.Join(dir, name)
+		src, err := readFile(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+		if err != nil {
+			if !*bestEffort {
+				return nil, nil, err
+			}
+			if !recoverFile(fset, file, err) {
+				infof("warning: %v, skipping the file", err)
 				continue
 			}
-			if name.IsExported() {
-				m[name.Name] = struct{}{}
+		}
+		if *noCgo && usesCgo(file) {
+			continue
+		}
+		pak := packages[file.Name.Name]
+		if pak == nil {
+			pak = &ast.Package{
+				Name:  file.Name.Name,
+				Files: make(map[string]*ast.File),
 			}
+			packages[file.Name.Name] = pak
 		}
+		pak.Files[filename] = file
 	}
+	return fset, packages, nil
 }
 
-func exportTypes(decl *ast.GenDecl, m map[string]struct{}) {
-	if isDeprecated(decl.Doc.Text()) {
-		return
+// recoverFile warns about the syntax errors of the file, for -best-effort,
+// dropping the declarations that don't parse, holding an error or a bad
+// node, so the others are exported. It reports whether the file can be
+// kept, which isn't the case when its package clause doesn't parse: the
+// whole file is skipped then.
+func recoverFile(fset *token.FileSet, file *ast.File, err error) bool {
+	list, ok := err.(scanner.ErrorList)
+	if !ok || file == nil || file.Name == nil || file.Name.Name == "" || file.Name.Name == "_" {
+		return false
 	}
-	for _, spec := range decl.Specs {
-		ts := spec.(*ast.TypeSpec)
-		if isDeprecated(ts.Doc.Text()) {
-			continue
+	for _, e := range list {
+		infof("warning: %s", e)
+	}
+	decls := file.Decls[:0]
+	for i, decl := range file.Decls {
+		// up to the next declaration: the end of a declaration the parser
+		// didn't find, like the ')' of a signature, is before its errors
+		end := fset.File(decl.Pos()).Size()
+		if i+1 < len(file.Decls) {
+			end = fset.Position(file.Decls[i+1].Pos()).Offset
 		}
-		if ts.Name.IsExported() {
-			m[ts.Name.Name] = struct{}{}
+		if !hasSyntaxError(fset, decl, end, list) {
+			decls = append(decls, decl)
 		}
 	}
+	file.Decls = decls
+	return true
 }
 
-func exportFunction(decl *ast.FuncDecl, m map[string]struct{}) {
-	if isDeprecated(decl.Doc.Text()) {
-		return
-	}
-	if decl.Recv != nil {
-		return
-	}
-	if decl.Name.IsExported() {
-		m[decl.Name.Name] = struct{}{}
+// hasSyntaxError reports whether one of the errors is located in n, from
+// its start to the offset end, or the parser replaced some syntax of n it
+// couldn't parse with a bad node.
+func hasSyntaxError(fset *token.FileSet, n ast.Node, end int, list scanner.ErrorList) bool {
+	start := fset.Position(n.Pos()).Offset
+	for _, e := range list {
+		if e.Pos.Offset >= start && e.Pos.Offset < end {
+			return true
+		}
 	}
+	bad := false
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.BadDecl, *ast.BadExpr, *ast.BadStmt:
+			bad = true
+		}
+		return !bad
+	})
+	return bad
 }
 
-func sortStringMap(m map[string]struct{}) []string {
-	s := make([]string, 0, len(m))
-	for k := range m {
-		s = append(s, k)
+// usesCgo reports whether the file imports "C". Only the import spec is
+// looked at: the preamble comment is optional and an import path merely
+// ending in C, like "example.com/C", isn't cgo.
+func usesCgo(file *ast.File) bool {
+	for _, spec := range file.Imports {
+		if p, ok := stringLit(spec.Path); ok && p == "C" {
+			return true
+		}
 	}
-	sort.Strings(s)
-	return s
+	return false
 }
 
-func generateCode(path, name, init string, constants, vars, types, fns []string) string {
-	// constants
-	buf := new(bytes.Buffer)
-	for _, c := range constants {
-		fmt.Fprintf(buf, valFormat, c, name, c)
+// filteredExports returns the exported names declared by the files of dir
+// that build constraints exclude, in package name, or in any package but
+// main if name is "", with the kinds they are declared as. Files that don't
+// parse are ignored, as they may use syntax of another Go version.
+func filteredExports(dir, name string) (map[string][]string, error) {
+	names, err := readDirNames(dir)
+	if err != nil {
+		return nil, err
 	}
-	cs := buf.String()
-
-	// variables
-	buf.Reset()
-	for _, v := range vars {
-		fmt.Fprintf(buf, valFormat, v, name, v)
+	m := make(map[string][]string)
+	add := func(id *ast.Ident, kind string) {
+		if id.IsExported() && !contains(m[id.Name], kind) {
+			m[id.Name] = append(m[id.Name], kind)
+		}
 	}
-	vs := buf.String()
-
-	// functions
-	buf.Reset()
-	for _, fn := range fns {
-		fmt.Fprintf(buf, valFormat, fn, name, fn)
+	for _, fn := range names {
+		if !isGoFile(fn) || matchFile(dir, fn) || untagged(dir, fn) {
+			continue
+		}
+		filename := filepath.Join(dir, fn)
+		src, err := readFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), filename, src, 0)
+		if err != nil {
+			continue
+		}
+		if pn := file.Name.Name; pn == "main" && name != pn || strings.HasSuffix(pn, "_test") || name != "" && pn != name {
+			continue
+		}
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					add(decl.Name, "func")
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.ValueSpec:
+						for _, id := range spec.Names {
+							add(id, strings.ToLower(decl.Tok.String()))
+						}
+					case *ast.TypeSpec:
+						add(spec.Name, "type")
+					}
+				}
+			}
+		}
 	}
-	fs := buf.String()
+	return m, nil
+}
+
+// getPackageName picks the package name from the files that survived build
+// filtering, so it always matches the declarations being exported. Only the
+// primary package is chosen: an external foo_test package is only built by
+// go test and can't be imported by the generated bindings. A main package
+// is only chosen with -allow-main, when there's no other. -package-name
+// forces the choice. Packages without files are never chosen, whether
+// parseDir left them out or kept them empty, and "" is returned when none
+// remains.
+func getPackageName(packages map[string]*ast.Package) string {
+	if *packageName != "" {
+		if pak := packages[*packageName]; pak != nil && len(pak.Files) > 0 {
+			return *packageName
+		}
+		return ""
+	}
+	names := make([]string, 0, len(packages))
+	for pn, pak := range packages {
+		if len(pak.Files) == 0 {
+			continue
+		}
+		names = append(names, pn)
+	}
+	sort.Strings(names)
+	main := false
+	for _, pn := range names {
+		switch {
+		case pn == "main":
+			main = true
+		case strings.HasSuffix(pn, "_test"):
+		default:
+			return pn
+		}
+	}
+	if main && *allowMain {
+		return "main"
+	}
+	return ""
+}
+
+func isDeprecated(text string) bool {
+	for _, item := range [...]string{
+		"Deprecated:",
+		"Deprecated.",
+	} {
+		if strings.Contains(text, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// warnUnresolvedImports warns about the imports of pak that don't resolve
+// on the module graph, which would otherwise only surface as a confusing
+// build error of the generated bindings.
+func warnUnresolvedImports(dir, path string, pak *ast.Package) {
+	seen := make(map[string]struct{})
+	var imports []string
+	for _, file := range sortedFiles(pak) {
+		for _, spec := range file.Imports {
+			p, ok := stringLit(spec.Path)
+			if _, dup := seen[p]; !ok || dup || p == "C" {
+				continue
+			}
+			seen[p] = struct{}{}
+			imports = append(imports, p)
+		}
+	}
+	if len(imports) == 0 {
+		return
+	}
+	sort.Strings(imports)
+	errs, err := listErrors(dir, imports)
+	if err != nil {
+		infof("warning: %s: checking imports: %v", path, err)
+		return
+	}
+	for _, e := range errs {
+		infof("warning: %s: unresolved import %s", path, e)
+	}
+}
+
+func isExperimental(text string) bool {
+	for _, item := range []string{"Experimental:", *betaMarker} {
+		if item != "" && strings.Contains(text, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// unstable returns why a symbol documented by text is excluded at the
+// -stability level, or "" if it's included: stable excludes deprecated and
+// experimental (or beta) symbols, beta excludes deprecated ones only and all
+// excludes none.
+func unstable(text string) string {
+	switch {
+	case *stability == "all":
+	case isDeprecated(text):
+		return "deprecated"
+	case *stability == "stable" && isExperimental(text):
+		return "experimental"
+	}
+	return ""
+}
+
+// isDeprecatedPackage reports whether the package documentation, the doc
+// comment on the package clause of any file, marks the package deprecated.
+// The conventional doc.go of dir is read even when excluded from the build,
+// e.g. by //go:build ignore, since it holds the documentation only.
+func isDeprecatedPackage(dir string, pak *ast.Package) bool {
+	filename := filepath.Join(dir, "doc.go")
+	doc, ok := pak.Files[filename]
+	if !ok {
+		if src, err := readFile(filename); err == nil {
+			if file, err := parser.ParseFile(token.NewFileSet(), filename, src, parser.PackageClauseOnly|parser.ParseComments); err == nil {
+				doc = file
+			}
+		}
+	}
+	if doc != nil && doc.Name.Name == pak.Name && isDeprecated(doc.Doc.Text()) {
+		return true
+	}
+	for _, file := range sortedFiles(pak) {
+		if isDeprecated(file.Doc.Text()) {
+			return true
+		}
+	}
+	return false
+}
+
+// warnUnexpectedSpec warns about a spec of an unexpected kind, as future
+// syntax could bring, which is skipped rather than crashing the run.
+func warnUnexpectedSpec(decl *ast.GenDecl, spec ast.Spec) {
+	infof("warning: skipping unexpected %T in %s declaration", spec, decl.Tok)
+}
+
+// exportValues collects the exported constants and variables of decl, a
+// top-level declaration: the ones declared in the bodies of generic
+// functions and methods are local, never walked. A constant or variable
+// typed at an instantiation of a generic type, like Num[int], is bound like
+// any other.
+func exportValues(decl *ast.GenDecl, m map[string]*symbol) {
+	blockReason := unstable(decl.Doc.Text())
+	// constants without type and values repeat the previous ones
+	var typ ast.Expr
+	for _, spec := range decl.Specs {
+		vs, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			warnUnexpectedSpec(decl, spec)
+			continue
+		}
+		if vs.Type != nil || len(vs.Values) > 0 || decl.Tok != token.CONST {
+			typ = vs.Type
+		}
+		for _, name := range vs.Names {
+			if !name.IsExported() {
+				continue
+			}
+			sym := newSymbol(name.Name, vs)
+			sym.typ = typ
+			switch {
+			case blockReason != "":
+				sym.dropped = blockReason
+			case unstable(vs.Doc.Text()) != "":
+				sym.dropped = unstable(vs.Doc.Text())
+			// skip some special variables
+			case name.Name == "ErrTrailingComma":
+				sym.dropped = "special variable"
+			}
+			sym.deprecation = deprecation(vs.Doc, decl.Doc)
+			sym.group = groupDirective(vs.Doc, decl.Doc)
+			m[name.Name] = sym
+		}
+	}
+}
+
+// exportTypes collects the exported types of decl. Generic types can't be
+// referenced without type arguments, so they are recorded in generics
+// instead and only exported through configured instantiations. Only the
+// type parameters of the spec make it generic: a struct embedding an
+// instantiation, like `struct{ cache[string] }`, is an ordinary type.
+func exportTypes(decl *ast.GenDecl, m map[string]*symbol, generics map[string]*ast.TypeSpec) {
+	blockReason := unstable(decl.Doc.Text())
+	for _, spec := range decl.Specs {
+		ts, ok := spec.(*ast.TypeSpec)
+		if !ok {
+			warnUnexpectedSpec(decl, spec)
+			continue
+		}
+		if !ts.Name.IsExported() {
+			continue
+		}
+		sym := newSymbol(ts.Name.Name, ts)
+		switch {
+		case blockReason != "":
+			sym.dropped = blockReason
+		case unstable(ts.Doc.Text()) != "":
+			sym.dropped = unstable(ts.Doc.Text())
+		case ts.TypeParams != nil:
+			generics[ts.Name.Name] = ts
+			sym.dropped = "generic"
+		case isConstraint(ts.Type):
+			sym.dropped = "constraint"
+		}
+		sym.deprecation = deprecation(ts.Doc, decl.Doc)
+		sym.group = groupDirective(ts.Doc, decl.Doc)
+		m[ts.Name.Name] = sym
+	}
+}
+
+// isConstraint reports whether expr is an interface with type elements, like
+// cmp.Ordered, which can only be used as a type constraint. Constraints
+// embedded from other packages aren't detected.
+func isConstraint(expr ast.Expr) bool {
+	it, ok := expr.(*ast.InterfaceType)
+	if !ok {
+		return false
+	}
+	for _, field := range it.Methods.List {
+		if len(field.Names) > 0 {
+			continue
+		}
+		switch x := field.Type.(type) {
+		case *ast.BinaryExpr, *ast.UnaryExpr:
+			return true
+		case *ast.Ident:
+			// a predeclared type other than error, or comparable
+			if x.Obj == nil && x.Name != "error" && types.Universe.Lookup(x.Name) != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dropMigrationAliases drops the aliases of decl re-exporting a type of a
+// package generated in this run, like `type OldName = newpkg.NewName` kept
+// for backward compatibility, which would bind the same type twice.
+func dropMigrationAliases(file *ast.File, decl *ast.GenDecl, m map[string]*symbol) {
+	for _, spec := range decl.Specs {
+		ts, ok := spec.(*ast.TypeSpec)
+		if !ok || !ts.Assign.IsValid() {
+			continue
+		}
+		sel, ok := ts.Type.(*ast.SelectorExpr)
+		if !ok {
+			continue
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		sym, ok := m[ts.Name.Name]
+		if !ok || sym.dropped != "" {
+			continue
+		}
+		if path := importPath(file, x.Name); path != "" && generated(path) {
+			sym.dropped = "alias of " + path + "." + sel.Sel.Name
+		}
+	}
+}
+
+// internalRef records in m under key the internal package of the first
+// type of expr, written in file, that comes from an internal package.
+func internalRef(file *ast.File, expr ast.Expr, key string, m map[string]string) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok {
+			path := importPath(file, x.Name)
+			if _, ok := m[key]; !ok && (strings.HasPrefix(path, "internal/") || strings.Contains(path, "/internal/") || strings.HasSuffix(path, "/internal")) {
+				m[key] = path + "." + sel.Sel.Name
+			}
+		}
+		return false
+	})
+}
+
+// envReaders are the functions whose result depends on the environment of
+// the running program.
+var envReaders = map[string]bool{
+	"os.Environ": true, "os.Executable": true, "os.Getegid": true, "os.Getenv": true,
+	"os.Geteuid": true, "os.Getgid": true, "os.Getpid": true, "os.Getppid": true,
+	"os.Getuid": true, "os.Getwd": true, "os.Hostname": true, "os.LookupEnv": true,
+	"os.TempDir": true, "os.UserCacheDir": true, "os.UserConfigDir": true, "os.UserHomeDir": true,
+	"runtime.GOMAXPROCS": true, "runtime.NumCPU": true, "runtime.NumGoroutine": true,
+	"time.Now": true,
+}
+
+// envRef records in m under key the first environment reader called by
+// expr, written in file, like os.Getenv in `var Home = os.Getenv("HOME")`,
+// outside function literals. Such variables are registered by address: their
+// value is computed at init and may be reassigned by the program when
+// outdated, which registering the value would hide from scripts.
+func envRef(file *ast.File, expr ast.Expr, key string, m map[string]string) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if _, ok := m[key]; ok {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if x, ok := sel.X.(*ast.Ident); ok {
+				if ref := importPath(file, x.Name) + "." + sel.Sel.Name; envReaders[ref] {
+					m[key] = ref
+				}
+			}
+		}
+		return true
+	})
+}
+
+// constantDeps records the constants of other packages the values of the
+// constants of decl, written in file, refer to, like other.Max in
+// `const Limit = other.Max`. A spec without values repeats the previous
+// ones.
+func constantDeps(file *ast.File, decl *ast.GenDecl, constants map[string]*symbol) {
+	var values []ast.Expr
+	for _, spec := range decl.Specs {
+		vs, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		if len(vs.Values) > 0 {
+			values = vs.Values
+		}
+		for i, id := range vs.Names {
+			c, ok := constants[id.Name]
+			if !ok || c.node != vs || i >= len(values) {
+				continue
+			}
+			ast.Inspect(values[i], func(n ast.Node) bool {
+				sel, ok := n.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				if x, ok := sel.X.(*ast.Ident); ok {
+					if path := importPath(file, x.Name); path != "" {
+						c.deps = append(c.deps, path+"."+sel.Sel.Name)
+					}
+				}
+				return false
+			})
+		}
+	}
+}
+
+// initType returns the part of value giving its type, if any: the function
+// or conversion of a call, like C.int of C.int(0), or the type of a
+// composite literal.
+func initType(value ast.Expr) ast.Expr {
+	for {
+		switch expr := value.(type) {
+		case *ast.CallExpr:
+			value = expr.Fun
+		case *ast.UnaryExpr:
+			value = expr.X
+		case *ast.CompositeLit:
+			return expr.Type
+		default:
+			return value
+		}
+	}
+}
+
+// cgoRef records in m under key the first C type of expr, like C.int, in a
+// cgo file. Scripts can't build such values, and go/parser doesn't see the
+// preamble declaring them.
+func cgoRef(file *ast.File, expr ast.Expr, key string, m map[string]string) {
+	if !usesCgo(file) {
+		return
+	}
+	ast.Inspect(expr, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok && x.Name == "C" {
+			if _, ok := m[key]; !ok {
+				m[key] = "C." + sel.Sel.Name
+			}
+		}
+		return false
+	})
+}
+
+// dropInternalRefs warns about the symbols of kind whose type refers to a
+// type of an internal package, which scripts can observe but not name, and
+// drops them with -no-internal-types.
+func dropInternalRefs(path, kind string, m map[string]*symbol, refs map[string]string) {
+	for _, sym := range sortSymbols(m) {
+		ref, ok := refs[sym.expr]
+		if !ok || sym.dropped != "" {
+			continue
+		}
+		if *noInternalTypes {
+			sym.dropped = "internal type " + ref
+			continue
+		}
+		infof("warning: %s: %s %s uses internal type %s, which scripts can't name", path, kind, sym.name, ref)
+	}
+}
+
+// dropUnnameableSignatures drops the functions whose signature refers to a
+// type scripts can't name: an unexported or unregistered type of the package,
+// or a type of an internal package. The element type of a variadic param,
+// like Element in ...Element, is checked like the other types.
+func dropUnnameableSignatures(path string, functions, pkgTypes map[string]*symbol, internalRefs map[string]string) {
+	for _, fn := range sortSymbols(functions) {
+		decl, ok := fn.node.(*ast.FuncDecl)
+		if !ok || fn.dropped != "" {
+			continue
+		}
+		reason := ""
+		if ref, ok := internalRefs[fn.expr]; ok {
+			reason = "internal type " + ref
+		}
+		var visit func(n ast.Node) bool
+		visit = func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.Field:
+				// the names of params, fields and methods aren't types
+				ast.Inspect(n.Type, visit)
+				return false
+			case *ast.ArrayType:
+				// nor the length
+				ast.Inspect(n.Elt, visit)
+				return false
+			case *ast.SelectorExpr:
+				return false
+			case *ast.IndexExpr, *ast.IndexListExpr:
+				// registered by an instantiation of the config
+				return !isInstantiated(pkgTypes, n.(ast.Expr))
+			case *ast.Ident:
+				if reason != "" || types.Universe.Lookup(n.Name) != nil {
+					break
+				}
+				typ, ok := pkgTypes[n.Name]
+				switch {
+				case !n.IsExported():
+					reason = "unexported type " + n.Name
+				// an alias is named by the package of the aliased type
+				case ok && typ.dropped != "" && !strings.HasPrefix(typ.dropped, "alias of "):
+					reason = "unregistered type " + n.Name
+				}
+			}
+			return reason == ""
+		}
+		ast.Inspect(decl.Type.Params, visit)
+		if decl.Type.Results != nil {
+			ast.Inspect(decl.Type.Results, visit)
+		}
+		if reason != "" {
+			infof("warning: %s: dropping function %s, its signature uses the %s", path, fn.name, reason)
+			fn.dropped = reason
+		}
+	}
+}
+
+// warnUninstantiatedResults warns about the functions returning an
+// instantiation of a generic type of the package, like Set[int], that isn't
+// registered: scripts get the value but can't name its type. An exported
+// generic type can be registered at that instantiation by the config.
+func warnUninstantiatedResults(path string, functions, pkgTypes map[string]*symbol, generics map[string]*ast.TypeSpec) {
+	for _, fn := range sortSymbols(functions) {
+		decl, ok := fn.node.(*ast.FuncDecl)
+		if !ok || fn.dropped != "" || decl.Type.Results == nil {
+			continue
+		}
+		ast.Inspect(decl.Type.Results, func(n ast.Node) bool {
+			var base ast.Expr
+			switch n := n.(type) {
+			case *ast.IndexExpr:
+				base = n.X
+			case *ast.IndexListExpr:
+				base = n.X
+			default:
+				return true
+			}
+			id, ok := base.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			expr := types.ExprString(n.(ast.Expr))
+			switch {
+			case !id.IsExported():
+				infof("warning: %s: function %s returns %s, of an unexported generic type scripts can't name", path, fn.name, expr)
+			case generics[id.Name] == nil, isInstantiated(pkgTypes, n.(ast.Expr)):
+			default:
+				infof("warning: %s: function %s returns %s, which scripts can't name: add it to the instantiations of %s in the config", path, fn.name, expr, path)
+			}
+			return false
+		})
+	}
+}
+
+// isInstantiated reports whether the instantiation expr of a generic type is
+// registered, by an instantiation of the config.
+func isInstantiated(pkgTypes map[string]*symbol, expr ast.Expr) bool {
+	s := types.ExprString(expr)
+	for _, typ := range pkgTypes {
+		if typ.dropped != "" || !strings.ContainsRune(typ.expr, '[') {
+			continue
+		}
+		if x, err := parser.ParseExpr(typ.expr); err == nil && types.ExprString(x) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// importPath returns the path of the import of file named name, guessing
+// the names of unnamed imports from their last element.
+func importPath(file *ast.File, name string) string {
+	for _, spec := range file.Imports {
+		path, ok := stringLit(spec.Path)
+		if !ok {
+			continue
+		}
+		if spec.Name != nil {
+			if spec.Name.Name == name {
+				return path
+			}
+			continue
+		}
+		elems := strings.Split(path, "/")
+		elem := elems[len(elems)-1]
+		// major version suffixes, e.g. example.com/mod/v2 or gopkg.in/yaml.v3
+		if len(elems) > 1 && len(elem) > 1 && elem[0] == 'v' && strings.Trim(elem[1:], "0123456789") == "" {
+			elem = elems[len(elems)-2]
+		}
+		if i := strings.Index(elem, ".v"); i > 0 {
+			elem = elem[:i]
+		}
+		if elem == name {
+			return path
+		}
+	}
+	return ""
+}
+
+// generated reports whether the package path is generated in this run.
+func generated(path string) bool {
+	if *std {
+		// standard library paths have no dot in their first element
+		return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+	}
+	return path == *pkg || strings.HasPrefix(path, *pkg+"/")
+}
+
+// exportInstantiations adds the configured instantiations of generic types,
+// e.g. "Set[string]": "StringSet", and of generic functions, e.g.
+// "New[int]": "NewInt", under their given names.
+func exportInstantiations(instances map[string]string, types, functions map[string]*symbol, generics map[string]*ast.TypeSpec) {
+	for expr, name := range instances {
+		base := expr
+		if i := strings.IndexByte(expr, '['); i >= 0 {
+			base = expr[:i]
+		}
+		var params *ast.FieldList
+		m := types
+		if ts, ok := generics[base]; ok {
+			params = ts.TypeParams
+		} else if fn := functions[base]; fn != nil && fn.dropped == "generic" {
+			params = fn.node.(*ast.FuncDecl).Type.TypeParams
+			m = functions
+		} else {
+			infof("warning: %s is not a generic type or function, skipping instantiation %s", base, expr)
+			continue
+		}
+		if n, want := typeArgCount(expr), params.NumFields(); n != want {
+			infof("warning: %s has %d type parameters, skipping instantiation %s", base, want, expr)
+			continue
+		}
+		m[name] = &symbol{name: name, expr: expr}
+	}
+}
+
+// typeArgCount returns the number of type arguments of the instantiation
+// expr, or -1 if it isn't one.
+func typeArgCount(expr string) int {
+	x, err := parser.ParseExpr(expr)
+	if err != nil {
+		return -1
+	}
+	switch x := x.(type) {
+	case *ast.IndexExpr:
+		return 1
+	case *ast.IndexListExpr:
+		return len(x.Indices)
+	}
+	return -1
+}
+
+// resolveGenericAliases records the generic type of the package each alias
+// to an instantiation, like `type Strings = list[string]`, instantiates,
+// exported or not. The generic type itself is dropped, but the alias is a
+// concrete type: the struct fields and methods of the generic type are the
+// ones of the alias, opaque if the generic struct is.
+func resolveGenericAliases(pak *ast.Package, types map[string]*symbol, opaque map[string]struct{}) {
+	generics := make(map[string]*ast.TypeSpec)
+	for _, file := range pak.Files {
+		for _, decl := range file.Decls {
+			if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.TYPE {
+				for _, spec := range decl.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok && ts.TypeParams != nil {
+						generics[ts.Name.Name] = ts
+					}
+				}
+			}
+		}
+	}
+	for _, typ := range types {
+		ts, ok := typ.node.(*ast.TypeSpec)
+		if !ok || !ts.Assign.IsValid() {
+			continue
+		}
+		var x ast.Expr
+		switch t := ts.Type.(type) {
+		case *ast.IndexExpr:
+			x = t.X
+		case *ast.IndexListExpr:
+			x = t.X
+		}
+		id, ok := x.(*ast.Ident)
+		if !ok || generics[id.Name] == nil {
+			continue
+		}
+		typ.origin = generics[id.Name]
+		if _, ok := opaque[id.Name]; ok {
+			opaque[typ.name] = struct{}{}
+		}
+	}
+}
+
+// methodsOf returns the name of the type the methods of typ are declared
+// on: the generic type it instantiates, if it's such an alias.
+func methodsOf(typ *symbol) string {
+	if typ.origin != nil {
+		return typ.origin.Name.Name
+	}
+	return typ.expr
+}
+
+// exportAnyInstantiations exports the generic types with a single type
+// parameter constrained by any at their [any] instantiation.
+func exportAnyInstantiations(m map[string]*symbol, generics map[string]*ast.TypeSpec) {
+	for name, ts := range generics {
+		tps := ts.TypeParams.List
+		if len(tps) != 1 || len(tps[0].Names) != 1 || !isAny(tps[0].Type) {
+			continue
+		}
+		m[name] = &symbol{name: name, expr: name + "[any]", node: ts}
+	}
+}
+
+// isAny reports whether the constraint is any or interface{}.
+func isAny(expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr.Name == "any"
+	case *ast.InterfaceType:
+		return len(expr.Methods.List) == 0
+	}
+	return false
+}
+
+func exportFunction(decl *ast.FuncDecl, m map[string]*symbol) {
+	if decl.Recv != nil || !decl.Name.IsExported() {
+		return
+	}
+	sym := newSymbol(decl.Name.Name, decl)
+	switch {
+	case unstable(decl.Doc.Text()) != "":
+		sym.dropped = unstable(decl.Doc.Text())
+	// declared without a body, implemented in assembly
+	case decl.Body == nil && *noAsm:
+		sym.dropped = "assembly"
+	// can't be referenced without instantiation
+	case decl.Type.TypeParams != nil:
+		sym.dropped = "generic"
+	case *skipPanicStubs && isPanicStub(decl):
+		sym.dropped = "panics"
+	case *skipVariadicAny && isVariadicAny(decl):
+		sym.dropped = "variadic any"
+	}
+	sym.deprecation = deprecation(decl.Doc)
+	sym.group = groupDirective(decl.Doc)
+	m[decl.Name.Name] = sym
+}
+
+// dropLinknamed drops the bodiless functions that file pulls from another
+// package with //go:linkname, internal plumbing rather than API.
+func dropLinknamed(file *ast.File, functions map[string]*symbol) {
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			fields := strings.Fields(c.Text)
+			if len(fields) < 2 || fields[0] != "//go:linkname" {
+				continue
+			}
+			fn, ok := functions[fields[1]]
+			if !ok || fn.dropped != "" {
+				continue
+			}
+			if decl, ok := fn.node.(*ast.FuncDecl); ok && decl.Body == nil {
+				fn.dropped = "linkname"
+			}
+		}
+	}
+}
+
+// isPanicStub reports whether the body of decl only panics, like the stubs
+// of functions unsupported on the platform.
+func isPanicStub(decl *ast.FuncDecl) bool {
+	if decl.Body == nil || len(decl.Body.List) != 1 {
+		return false
+	}
+	stmt, ok := decl.Body.List[0].(*ast.ExprStmt)
+	if !ok {
+		return false
+	}
+	call, ok := stmt.X.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	id, ok := call.Fun.(*ast.Ident)
+	return ok && id.Name == "panic"
+}
+
+// isVariadicAny reports whether the last param of decl is ...any or
+// ...interface{}, like the one of fmt.Println.
+func isVariadicAny(decl *ast.FuncDecl) bool {
+	params := decl.Type.Params.List
+	if len(params) == 0 {
+		return false
+	}
+	ellipsis, ok := params[len(params)-1].Type.(*ast.Ellipsis)
+	return ok && isAny(ellipsis.Elt)
+}
+
+// opaqueStructs collects the struct types of decl that have unexported
+// fields. Values of such types can be passed around in Anko but can't be
+// built field by field.
+func opaqueStructs(decl *ast.GenDecl, m map[string]struct{}) {
+	for _, spec := range decl.Specs {
+		ts, ok := spec.(*ast.TypeSpec)
+		if !ok {
+			continue
+		}
+		st, ok := ts.Type.(*ast.StructType)
+		if !ok {
+			continue
+		}
+		for _, field := range st.Fields.List {
+			if len(field.Names) == 0 {
+				// embedded field, named after its type
+				if id := typeName(field.Type); id != nil && !id.IsExported() {
+					m[ts.Name.Name] = struct{}{}
+				}
+				continue
+			}
+			for _, name := range field.Names {
+				if !name.IsExported() {
+					m[ts.Name.Name] = struct{}{}
+				}
+			}
+		}
+	}
+}
+
+// needsNew reports whether typ is a struct type worth a zero-value
+// constructor. Unless -new-opaque is set, structs without exported fields are
+// skipped since scripts can't set any of their fields.
+func needsNew(typ *symbol) bool {
+	ts, ok := typ.node.(*ast.TypeSpec)
+	if !ok {
+		return false
+	}
+	if typ.origin != nil {
+		ts = typ.origin
+	}
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return false
+	}
+	if *newOpaque {
+		return true
+	}
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			if id := typeName(field.Type); id != nil && id.IsExported() {
+				return true
+			}
+			continue
+		}
+		for _, name := range field.Names {
+			if name.IsExported() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeName returns the identifier naming the type expression expr, if any.
+func typeName(expr ast.Expr) *ast.Ident {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr
+	case *ast.StarExpr:
+		return typeName(expr.X)
+	case *ast.SelectorExpr:
+		return expr.Sel
+	}
+	return nil
+}
+
+// warnUnexportedTypes warns about the constants of an unexported type, like
+// `const X myType = 1`: scripts can read the value but can't name its type.
+func warnUnexportedTypes(path string, constants map[string]*symbol) {
+	for _, c := range sortSymbols(constants) {
+		id, ok := c.typ.(*ast.Ident)
+		if ok && !id.IsExported() && types.Universe.Lookup(id.Name) == nil {
+			infof("warning: %s: constant %s has the unexported type %s, which scripts can't name", path, c.name, id.Name)
+		}
+	}
+}
+
+// noteOpaqueParams notes the functions taking a struct of the package with
+// unexported fields, so scripts know to obtain it from a constructor.
+func noteOpaqueParams(functions map[string]*symbol, opaque map[string]struct{}) {
+	for _, fn := range functions {
+		decl, ok := fn.node.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		for _, param := range decl.Type.Params.List {
+			expr := param.Type
+			if star, ok := expr.(*ast.StarExpr); ok {
+				expr = star.X
+			}
+			if id, ok := expr.(*ast.Ident); ok {
+				if _, ok := opaque[id.Name]; ok {
+					fn.note("opaque struct param")
+					break
+				}
+			}
+		}
+	}
+}
+
+// noteChannelResults notes the direction of the channels returned by the
+// functions, as reflect hides it from scripts: a receive-only channel can
+// only be read with <- or range, a send-only one only written.
+func noteChannelResults(functions map[string]*symbol) {
+	for _, fn := range functions {
+		decl, ok := fn.node.(*ast.FuncDecl)
+		if !ok || decl.Type.Results == nil {
+			continue
+		}
+		for _, result := range decl.Type.Results.List {
+			ct, ok := result.Type.(*ast.ChanType)
+			if !ok {
+				continue
+			}
+			switch ct.Dir {
+			case ast.RECV:
+				fn.note("returns receive-only %s", types.ExprString(ct))
+			case ast.SEND:
+				fn.note("returns send-only %s", types.ExprString(ct))
+			default:
+				fn.note("returns %s", types.ExprString(ct))
+			}
+		}
+	}
+}
+
+// groupConstructors groups the New* functions whose first result is an
+// exported type of the package.
+func groupConstructors(functions, types map[string]*symbol) {
+	for _, fn := range functions {
+		decl, ok := fn.node.(*ast.FuncDecl)
+		if !ok || !strings.HasPrefix(decl.Name.Name, "New") {
+			continue
+		}
+		results := decl.Type.Results
+		if results == nil || len(results.List) == 0 {
+			continue
+		}
+		expr := results.List[0].Type
+		if star, ok := expr.(*ast.StarExpr); ok {
+			expr = star.X
+		}
+		if id, ok := expr.(*ast.Ident); ok {
+			if _, ok := types[id.Name]; ok && fn.group == "" {
+				fn.group = "constructors"
+			}
+		}
+	}
+}
+
+// errorMethod adds the receiver type of decl to m if decl is an
+// Error() string method, so that the type implements error.
+func errorMethod(decl *ast.FuncDecl, m map[string]struct{}) {
+	if decl.Name.Name != "Error" {
+		return
+	}
+	ft := decl.Type
+	if ft.Params.NumFields() != 0 || ft.Results.NumFields() != 1 {
+		return
+	}
+	if id, ok := ft.Results.List[0].Type.(*ast.Ident); !ok || id.Name != "string" {
+		return
+	}
+	if name, _ := receiver(decl); name != "" {
+		m[name] = struct{}{}
+	}
+}
+
+// receiver returns the name of the receiver type of the method decl, and
+// whether the receiver is a pointer. It returns "" if decl isn't a method.
+func receiver(decl *ast.FuncDecl) (string, bool) {
+	if decl.Recv == nil || len(decl.Recv.List) != 1 {
+		return "", false
+	}
+	expr := decl.Recv.List[0].Type
+	star, pointer := expr.(*ast.StarExpr)
+	if pointer {
+		expr = star.X
+	}
+	// generic receivers are written T[P]
+	switch x := expr.(type) {
+	case *ast.IndexExpr:
+		expr = x.X
+	case *ast.IndexListExpr:
+		expr = x.X
+	}
+	if id, ok := expr.(*ast.Ident); ok {
+		return id.Name, pointer
+	}
+	return "", false
+}
+
+// receiverKinds counts the methods of each type of the package by kind of
+// receiver.
+type receiverKinds struct {
+	value, pointer int
+}
+
+func countReceiver(decl *ast.FuncDecl, m map[string]*receiverKinds) {
+	name, pointer := receiver(decl)
+	if name == "" {
+		return
+	}
+	k := m[name]
+	if k == nil {
+		k = new(receiverKinds)
+		m[name] = k
+	}
+	if pointer {
+		k.pointer++
+	} else {
+		k.value++
+	}
+}
+
+// method is a method of a type of the package.
+type method struct {
+	signature string // like func([]byte) (int, error)
+	pointer   bool
+}
+
+// collectMethod adds decl to the methods of its receiver type in m, if it's
+// an exported method.
+func collectMethod(decl *ast.FuncDecl, m map[string]map[string]method) {
+	name, pointer := receiver(decl)
+	if name == "" || !decl.Name.IsExported() {
+		return
+	}
+	if m[name] == nil {
+		m[name] = make(map[string]method)
+	}
+	m[name][decl.Name.Name] = method{funcTypeString(decl.Type), pointer}
+}
+
+// funcTypeString returns the function type ft without its param and result
+// names, e.g. func([]byte) (int, error).
+func funcTypeString(ft *ast.FuncType) string {
+	unnamed := func(fields *ast.FieldList) *ast.FieldList {
+		if fields == nil {
+			return nil
+		}
+		list := new(ast.FieldList)
+		for _, field := range fields.List {
+			for i := 0; i < len(field.Names) || i == 0; i++ {
+				list.List = append(list.List, &ast.Field{Type: field.Type})
+			}
+		}
+		return list
+	}
+	return types.ExprString(&ast.FuncType{Params: unnamed(ft.Params), Results: unnamed(ft.Results)})
+}
+
+// noteInterfaces documents the interfaces, among the common ones or the
+// interfaces of the config, that the types implement with their own
+// methods. Promoted methods of embedded fields aren't seen.
+func noteInterfaces(pkgTypes map[string]*symbol, methods map[string]map[string]method) {
+	ifaces := commonInterfaces
+	if cfg.Interfaces != nil {
+		ifaces = cfg.Interfaces
+	}
+	names := make([]string, 0, len(ifaces))
+	for name := range ifaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, typ := range pkgTypes {
+		ms := methods[methodsOf(typ)]
+		if len(ms) == 0 {
+			continue
+		}
+		var value, pointer []string
+	next:
+		for _, name := range names {
+			ptr := false
+			for m, sig := range ifaces[name] {
+				got, ok := ms[m]
+				if !ok || got.signature != sig {
+					continue next
+				}
+				ptr = ptr || got.pointer
+			}
+			if ptr {
+				pointer = append(pointer, name)
+			} else {
+				value = append(value, name)
+			}
+		}
+		if len(value) > 0 {
+			typ.docs = append(typ.docs, "implements "+strings.Join(value, ", "))
+		}
+		if len(pointer) > 0 {
+			typ.docs = append(typ.docs, "*"+typ.expr+" implements "+strings.Join(pointer, ", "))
+		}
+	}
+}
+
+// commonInterfaces are the interfaces noteInterfaces looks for by default,
+// by method name and signature.
+var commonInterfaces = map[string]map[string]string{
+	"error":        {"Error": "func() string"},
+	"fmt.Stringer": {"String": "func() string"},
+	"io.Closer":    {"Close": "func() error"},
+	"io.Reader":    {"Read": "func([]byte) (int, error)"},
+	"io.Writer":    {"Write": "func([]byte) (int, error)"},
+	"sort.Interface": {
+		"Len":  "func() int",
+		"Less": "func(int, int) bool",
+		"Swap": "func(int, int)",
+	},
+}
+
+// pointerOnlyTypes handles the types whose methods all have a pointer
+// receiver, so scripts must hold a *T to call them: -with-docs notes it and
+// -pointer-types registers *T too, under the TPtr key.
+func pointerOnlyTypes(path string, types map[string]*symbol, receivers map[string]*receiverKinds) {
+	for _, typ := range sortSymbols(types) {
+		k := receivers[methodsOf(typ)]
+		if k == nil || k.value > 0 || k.pointer == 0 {
+			continue
+		}
+		if *withDocs {
+			typ.docs = append(typ.docs, "methods have pointer receivers: use &"+typ.expr+"{} or New to obtain a pointer")
+		}
+		if *pointerTypes {
+			key := typ.name + "Ptr"
+			if _, ok := types[key]; ok {
+				infof("warning: %s: %s is declared already, skipping the pointer type of %s", path, key, typ.name)
+				continue
+			}
+			types[key] = &symbol{name: key, expr: typ.expr, pos: typ.pos, ptr: true}
+		}
+	}
+}
+
+// groupErrorTypes groups the exported types implementing error, which
+// scripts can type-assert errors to.
+func groupErrorTypes(types map[string]*symbol, errorTypes map[string]struct{}) {
+	for _, typ := range types {
+		if _, ok := errorTypes[methodsOf(typ)]; ok && typ.group == "" {
+			typ.group = "error types"
+		}
+	}
+}
+
+// groupFallibleFunctions groups the functions whose last result is an error,
+// which scripts must check, leaving the constructors in their own group.
+func groupFallibleFunctions(functions map[string]*symbol) {
+	for _, fn := range functions {
+		decl, ok := fn.node.(*ast.FuncDecl)
+		if !ok || fn.group != "" {
+			continue
+		}
+		results := decl.Type.Results
+		if results == nil || len(results.List) == 0 {
+			continue
+		}
+		if id, ok := results.List[len(results.List)-1].Type.(*ast.Ident); ok && id.Name == "error" {
+			fn.group = "fallible"
+		}
+	}
+}
+
+// handleNonASCII applies -non-ascii to the symbols whose name contains
+// non-ASCII letters. They are valid Go, but some Anko tooling assumes ASCII
+// keys. With "ascii" the key is rewritten with _uXXXX escapes while the
+// reference keeps the original identifier.
+func handleNonASCII(m map[string]*symbol) {
+	if *nonASCII == "keep" {
+		return
+	}
+	for key, sym := range m {
+		if isASCII(key) {
+			continue
+		}
+		if *nonASCII == "skip" {
+			sym.dropped = "non-ASCII"
+			continue
+		}
+		delete(m, key)
+		var b strings.Builder
+		for _, r := range key {
+			if r < 0x80 {
+				b.WriteRune(r)
+			} else {
+				fmt.Fprintf(&b, "_u%04x", r)
+			}
+		}
+		sym.name = b.String()
+		m[sym.name] = sym
+	}
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// keepSignatureTypes keeps the deprecated or experimental types referenced
+// by the signatures of the functions and the types of the variables
+// exported, which scripts couldn't name otherwise.
+func keepSignatureTypes(path string, types, variables, functions map[string]*symbol) {
+	var exprs []ast.Expr
+	for _, sym := range append(sortSymbols(variables), sortSymbols(functions)...) {
+		if sym.dropped != "" {
+			continue
+		}
+		switch node := sym.node.(type) {
+		case *ast.FuncDecl:
+			exprs = append(exprs, node.Type)
+		case *ast.ValueSpec:
+			if node.Type != nil {
+				exprs = append(exprs, node.Type)
+			}
+		}
+	}
+	for _, expr := range exprs {
+		ast.Inspect(expr, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				// a type of another package
+				return false
+			case *ast.Ident:
+				if typ, ok := types[n.Name]; ok && (typ.dropped == "deprecated" || typ.dropped == "experimental") {
+					infof("warning: %s: keeping %s type %s, referenced by exported signatures", path, typ.dropped, typ.name)
+					typ.dropped = ""
+				}
+			}
+			return true
+		})
+	}
+}
+
+// warnCollisions warns about the values sharing their name with a type,
+// across the files build constraints select and the filtered ones. That
+// can't happen within one set of files, so it points to declarations
+// diverging across build-tagged files, like a type Foo on linux and a
+// constant Foo on windows. Each collision is reported once per package,
+// while -platforms collects it for every platform.
+func warnCollisions(path string, filtered map[string][]string, constants, variables, types, functions map[string]*symbol) {
+	declared := make(map[string][]string, len(filtered))
+	for key, kinds := range filtered {
+		declared[key] = append([]string(nil), kinds...)
+	}
+	for _, kind := range []struct {
+		name string
+		m    map[string]*symbol
+	}{{"const", constants}, {"var", variables}, {"type", types}, {"func", functions}} {
+		for key := range kind.m {
+			if !contains(declared[key], kind.name) {
+				declared[key] = append(declared[key], kind.name)
+			}
+		}
+	}
+	keys := make([]string, 0, len(declared))
+	for key, kinds := range declared {
+		if len(kinds) > 1 && contains(kinds, "type") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := warnedCollisions[path+"."+key]; ok {
+			continue
+		}
+		warnedCollisions[path+"."+key] = struct{}{}
+		var values []string
+		for _, kind := range declared[key] {
+			if kind != "type" {
+				values = append(values, kindNames[kind])
+			}
+		}
+		sort.Strings(values)
+		infof("warning: %s: %s is declared both as a type and a %s, check for platform-specific declarations", path, key, strings.Join(values, " and a "))
+	}
+}
+
+// warnedCollisions holds the path.Name of the collisions reported already.
+var warnedCollisions = make(map[string]struct{})
+
+var kindNames = map[string]string{"const": "constant", "var": "variable", "func": "function"}
+
+// warnCaseCollisions warns about the keys of the maps, sharing a binding
+// map, that only differ by case, like Mode and MODE: legal Go, but confusing
+// in scripts.
+func warnCaseCollisions(path, kind string, maps ...map[string]*symbol) {
+	seen := make(map[string]string)
+	var keys []string
+	for _, m := range maps {
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		folded := strings.ToLower(key)
+		if prev, ok := seen[folded]; ok {
+			infof("warning: %s: %s names %s and %s only differ by case", path, kind, prev, key)
+			continue
+		}
+		seen[folded] = key
+	}
+}
+
+// classifyVariables moves the function-valued variables, like
+// `var Now = time.Now` or the method value `var Get = DefaultClient.Get`, to
+// the functions and notes the variables computed by a call at init, like
+// `var Zero = computeZero()`, whose value is captured when the bindings are
+// registered. pkgFuncs holds the functions of the package, exported or not,
+// and importedRefs the identifiers of other packages the variables are
+// initialized to.
+func classifyVariables(info *types.Info, variables, functions map[string]*symbol, methods map[string]map[string]method, pkgFuncs map[string]struct{}, importedRefs map[string]string) {
+	for key, v := range variables {
+		vs, ok := v.node.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		var value ast.Expr
+		for i, id := range vs.Names {
+			if id.Name == v.name && i < len(vs.Values) {
+				value = vs.Values[i]
+			}
+		}
+		if isFuncValued(info, vs, v.name, value, pkgFuncs, importedRefs[key]) || isMethodValue(value, variables, methods) {
+			delete(variables, key)
+			functions[key] = v
+			continue
+		}
+		if _, ok := value.(*ast.CallExpr); ok {
+			v.note("computed at init")
+		}
+	}
+}
+
+// addressNilVars registers the function and channel variables without
+// initializer or initialized to nil, like `var Hook func()` or
+// `var Events chan Event`, by address: they are nil until assigned by the
+// program and registering the value would capture that nil for good. An
+// initialized channel is registered by value: the copy is the same channel,
+// so sends and receives through the binding reach the program. Named types
+// are resolved through the exported types of the package, like
+// `var Fallback Handler` for `type Handler func()`.
+func addressNilVars(variables, pkgTypes map[string]*symbol) {
+	for _, v := range variables {
+		vs, ok := v.node.(*ast.ValueSpec)
+		if !ok || !nilValued(vs, v.expr) {
+			continue
+		}
+		switch underlyingType(vs.Type, pkgTypes).(type) {
+		case *ast.FuncType, *ast.ChanType:
+			v.addr = true
+		}
+	}
+}
+
+// underlyingType returns the type declared by typ, when it names one of
+// pkgTypes, or typ.
+func underlyingType(typ ast.Expr, pkgTypes map[string]*symbol) ast.Expr {
+	if id, ok := typ.(*ast.Ident); ok {
+		if t, ok := pkgTypes[id.Name]; ok {
+			if ts, ok := t.node.(*ast.TypeSpec); ok && !ts.Assign.IsValid() {
+				return ts.Type
+			}
+		}
+	}
+	return typ
+}
+
+// nilValued reports whether the variable name of vs has no initializer or
+// is initialized to nil.
+func nilValued(vs *ast.ValueSpec, name string) bool {
+	for i, id := range vs.Names {
+		if id.Name == name && i < len(vs.Values) {
+			value, ok := vs.Values[i].(*ast.Ident)
+			return ok && value.Name == "nil"
+		}
+	}
+	return true
+}
+
+// addressArrays registers the fixed-size array variables, like
+// `var Table [256]byte`, by address: their value is a copy, so writes to the
+// elements from scripts would be lost. Named types are resolved like by
+// addressNilVars.
+func addressArrays(variables, pkgTypes map[string]*symbol) {
+	for _, v := range variables {
+		vs, ok := v.node.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		typ := vs.Type
+		if typ == nil {
+			for i, id := range vs.Names {
+				if id.Name == v.expr && i < len(vs.Values) {
+					if lit, ok := vs.Values[i].(*ast.CompositeLit); ok {
+						typ = lit.Type
+					}
+				}
+			}
+		}
+		if at, ok := underlyingType(typ, pkgTypes).(*ast.ArrayType); ok && at.Len != nil {
+			v.addr = true
+		}
+	}
+}
+
+// isFuncValued reports whether the variable name of vs holds a function.
+// Without type information only function types, function literals,
+// functions of the package and imported functions, like time.Now as ref,
+// are recognized, and methods of its types by isMethodValue.
+func isFuncValued(info *types.Info, vs *ast.ValueSpec, name string, value ast.Expr, pkgFuncs map[string]struct{}, ref string) bool {
+	for _, id := range vs.Names {
+		if id.Name != name {
+			continue
+		}
+		if typ := objectType(info, id); typ != nil {
+			_, ok := typ.Underlying().(*types.Signature)
+			return ok
+		}
+	}
+	if _, ok := vs.Type.(*ast.FuncType); ok {
+		return true
+	}
+	switch value := value.(type) {
+	case *ast.FuncLit:
+		return true
+	case *ast.Ident:
+		_, ok := pkgFuncs[value.Name]
+		return ok
+	case *ast.SelectorExpr:
+		return ref != "" && isImportedFunc(ref)
+	}
+	return false
+}
+
+// importedRef records in m under key the identifier of another package
+// expr is, like time.Now, as "time.Now".
+func importedRef(file *ast.File, expr ast.Expr, key string, m map[string]string) {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return
+	}
+	if x, ok := sel.X.(*ast.Ident); ok {
+		if path := importPath(file, x.Name); path != "" {
+			m[key] = path + "." + sel.Sel.Name
+		}
+	}
+}
+
+// isImportedFunc reports whether ref, like time.Now, is a function of the
+// imported package, type-checked from source. A package that can't be
+// imported holds none.
+func isImportedFunc(ref string) bool {
+	i := strings.LastIndexByte(ref, '.')
+	pkg, err := sourceImporter().Import(ref[:i])
+	if err != nil {
+		return false
+	}
+	_, ok := pkg.Scope().Lookup(ref[i+1:]).(*types.Func)
+	return ok
+}
+
+// isMethodValue reports whether value is a method of a type of the package,
+// as a method value like DefaultClient.Get of a variable, or a method
+// expression like (*Client).Get.
+func isMethodValue(value ast.Expr, variables map[string]*symbol, methods map[string]map[string]method) bool {
+	sel, ok := value.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	x := sel.X
+	if paren, ok := x.(*ast.ParenExpr); ok {
+		x = paren.X
+	}
+	typ := ""
+	switch x := x.(type) {
+	case *ast.Ident:
+		if v, ok := variables[x.Name]; ok {
+			typ = varTypeName(v)
+		} else if vs, ok := localVar(x); ok {
+			// unexported, like defaultClient.Get, resolved by the parser
+			// within the file
+			typ = varTypeName(&symbol{expr: x.Name, node: vs})
+		} else {
+			typ = x.Name
+		}
+	case *ast.StarExpr:
+		if id, ok := x.X.(*ast.Ident); ok {
+			typ = id.Name
+		}
+	}
+	_, ok = methods[typ][sel.Sel.Name]
+	return ok
+}
+
+// localVar returns the spec declaring the variable id refers to, if the
+// parser resolved it.
+func localVar(id *ast.Ident) (*ast.ValueSpec, bool) {
+	if id.Obj == nil || id.Obj.Kind != ast.Var {
+		return nil, false
+	}
+	vs, ok := id.Obj.Decl.(*ast.ValueSpec)
+	return vs, ok
+}
+
+// varTypeName returns the name of the type of the package the variable v is
+// declared with, like T for `var V T`, `var V = T{}` or `var V = &T{}`, or
+// "" if unknown.
+func varTypeName(v *symbol) string {
+	vs, ok := v.node.(*ast.ValueSpec)
+	if !ok {
+		return ""
+	}
+	typ := vs.Type
+	if typ == nil {
+		for i, id := range vs.Names {
+			if id.Name == v.expr && i < len(vs.Values) {
+				value := vs.Values[i]
+				if u, ok := value.(*ast.UnaryExpr); ok && u.Op == token.AND {
+					value = u.X
+				}
+				if lit, ok := value.(*ast.CompositeLit); ok {
+					typ = lit.Type
+				}
+			}
+		}
+	}
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if id, ok := typ.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// addConverters sets the converter of each named numeric type of the
+// package having exported constants, so scripts can build values of enum
+// types from numbers.
+func addConverters(constants, types map[string]*symbol) {
+	for _, c := range constants {
+		id, ok := c.typ.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		typ := types[id.Name]
+		if typ == nil || typ.convert != "" {
+			continue
+		}
+		ts, ok := typ.node.(*ast.TypeSpec)
+		if !ok {
+			continue
+		}
+		if basic, ok := ts.Type.(*ast.Ident); ok {
+			switch basic.Name {
+			case "int", "int8", "int16", "int32", "int64",
+				"uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte", "rune":
+				typ.convert = "int64"
+			case "float32", "float64":
+				typ.convert = "float64"
+			}
+		}
+	}
+}
+
+// noteLiteralValues notes the value of the constants declared with a basic
+// literal, e.g. "= 1024". Computed constants are left alone.
+func noteLiteralValues(constants map[string]*symbol) {
+	for _, c := range constants {
+		vs, ok := c.node.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		for i, id := range vs.Names {
+			if id.Name != c.name || i >= len(vs.Values) {
+				continue
+			}
+			if lit, ok := vs.Values[i].(*ast.BasicLit); ok && !strings.Contains(lit.Value, "\n") {
+				c.note("= %s", lit.Value)
+			}
+		}
+	}
+}
+
+// noteIotaValues notes the value of the constants defined with iota, or
+// repeating the expression of a previous constant using it, e.g. "= 3". The
+// values come from -typecheck if set, else from the local evaluation.
+func noteIotaValues(info *types.Info, constants map[string]*symbol, consts map[string]*types.Const) {
+	for _, c := range constants {
+		vs, ok := c.node.(*ast.ValueSpec)
+		if !ok || !usesIota(vs) {
+			continue
+		}
+		lc := consts[c.expr]
+		for _, id := range vs.Names {
+			if id.Name != c.expr || info == nil {
+				continue
+			}
+			if obj, ok := info.Defs[id].(*types.Const); ok {
+				lc = obj
+			}
+		}
+		if lc != nil {
+			c.note("= %s", lc.Val().ExactString())
+		}
+	}
+}
+
+// usesIota reports whether the constants of vs repeat the previous
+// expression, which is only useful with iota, or use iota.
+func usesIota(vs *ast.ValueSpec) bool {
+	if len(vs.Values) == 0 {
+		return true
+	}
+	found := false
+	for _, value := range vs.Values {
+		ast.Inspect(value, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Name == "iota" {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// groupConstantsByType groups the constants by their declared named type,
+// e.g. the values of an enum.
+func groupConstantsByType(constants map[string]*symbol) {
+	for _, c := range constants {
+		if c.group != "" {
+			continue
+		}
+		switch c.typ.(type) {
+		case *ast.Ident, *ast.SelectorExpr:
+			c.group = "constants of type " + types.ExprString(c.typ)
+		}
+	}
+}
+
+// documentCompositeTypes renders the declaration of the types defined as a
+// map, slice, array, channel or function type, like
+// `type Dispatch map[string]func()`, so scripts know the shape of the values
+// to build. Structs and interfaces are left out, as long as their body.
+func documentCompositeTypes(pkgTypes map[string]*symbol) {
+	for _, typ := range pkgTypes {
+		ts, ok := typ.node.(*ast.TypeSpec)
+		if !ok || typ.ptr {
+			continue
+		}
+		switch ts.Type.(type) {
+		case *ast.MapType, *ast.ArrayType, *ast.ChanType, *ast.FuncType:
+			op := " "
+			if ts.Assign.IsValid() {
+				op = " = "
+			}
+			typ.docs = append(typ.docs, "type "+ts.Name.Name+op+types.ExprString(ts.Type))
+		}
+	}
+}
+
+// signature renders the declaration of a function, e.g.
+// "func Copy(dst Writer, src Reader) (written int64, err error)". Blank,
+// unnamed and variadic parameters are kept as written. With type
+// information, identifiers of other packages are qualified even when the
+// source refers to them through a dot-import.
+func signature(info *types.Info, path string, decl *ast.FuncDecl) string {
+	if info != nil {
+		if obj := info.Defs[decl.Name]; obj != nil {
+			return types.ObjectString(obj, func(p *types.Package) string {
+				if p.Path() == path {
+					return ""
+				}
+				return p.Name()
+			})
+		}
+	}
+	var b strings.Builder
+	b.WriteString("func " + decl.Name.Name)
+	if tps := decl.Type.TypeParams; tps != nil {
+		params := make([]string, len(tps.List))
+		for i, tp := range tps.List {
+			names := make([]string, len(tp.Names))
+			for j, name := range tp.Names {
+				names[j] = name.Name
+			}
+			params[i] = strings.Join(names, ", ") + " " + types.ExprString(tp.Type)
+		}
+		b.WriteString("[" + strings.Join(params, ", ") + "]")
+	}
+	b.WriteString(strings.TrimPrefix(types.ExprString(decl.Type), "func"))
+	return b.String()
+}
+
+func sortSymbols(m map[string]*symbol) []*symbol {
+	s := make([]*symbol, 0, len(m))
+	for _, sym := range m {
+		s = append(s, sym)
+	}
+	sort.Slice(s, func(i, j int) bool {
+		return s[i].name < s[j].name
+	})
+	return s
+}
+
+func generateCode(path, name, init string, constants, vars, types, fns []*symbol, deprecated [4][]*symbol) string {
+	if !*symbolTable {
+		bindKeys(boundKeys.Packages, path, constants, vars, fns)
+	}
+	bindKeys(boundKeys.PackageTypes, path, types, funcTypes(fns))
+	if *typesForAll {
+		bindKeys(boundKeys.PackageTypes, path, constants, vars, filterSymbols(fns, func(fn *symbol) bool {
+			return !fn.funcType
+		}))
+	}
+	bindManualKeys(path)
+
+	// constants
+	buf := new(bytes.Buffer)
+	writeEntries(buf, valueFormat("const"), name, constants)
+	cs := buf.String()
+
+	// variables
+	buf.Reset()
+	writeEntries(buf, valueFormat("var"), name, vars)
+	vs := buf.String()
+
+	// functions
+	buf.Reset()
+	writeEntries(buf, valueFormat("func"), name, fns)
+	fs := buf.String()
 
 	// prepare var buffer for struct and interface
 	buf.Reset()
+	writeEntries(buf, typeFormat, name, types)
+	for _, fn := range fns {
+		if fn.funcType {
+			fmt.Fprintf(buf, funcTypeFormat+"\n", fn.name, name, fn.expr)
+		}
+	}
+	if *typesForAll {
+		writeValueTypes(buf, name, constants, vars, fns)
+	}
+	ts := buf.String() + manualText("PackageTypes", path)
+
+	// zero-value constructors
+	var ns string
+	if *emitNew {
+		buf.Reset()
+		for _, typ := range types {
+			if needsNew(typ) {
+				fmt.Fprintf(buf, kindFormat(newFormat, interfaceNewFormat)+"\n", typ.name, name, typ.expr)
+			}
+		}
+		if buf.Len() > 0 {
+			ns = fmt.Sprintf(packageNewTemplate, path, valueType(), buf.String())
+		}
+	}
+
+	// a package with only types registers no values
+	manual := manualText("Packages", path)
+	values := cs + vs + fs + manual
+	if *symbolTable {
+		// the manual entries stay in the map
+		values = writeSymbolTable(path, name, constants, vars, fns)
+		if manual != "" {
+			values += fmt.Sprintf(packagesTemplate, path, valueType(), manual)
+		}
+	} else if values != "" {
+		if !*compact {
+			values = fmt.Sprintf(valuesTemplate, cs, vs, fs)
+			if manual != "" {
+				values += "\n" + tabs + "// manual\n" + manual
+			}
+		}
+		values = fmt.Sprintf(packagesTemplate, path, valueType(), values)
+	}
+	// numeric converters
+	var cvs string
+	buf.Reset()
 	for _, typ := range types {
-		fmt.Fprintf(buf, typeFormat, typ, name, typ)
+		if typ.convert != "" {
+			fmt.Fprintf(buf, kindFormat(convertFormat, interfaceConvertFormat)+"\n", typ.name, typ.convert, name, typ.expr, name, typ.expr)
+		}
+	}
+	if buf.Len() > 0 {
+		cvs = fmt.Sprintf(packageConvertersTemplate, path, valueType(), buf.String())
+	}
+	// reverse type registry
+	var tns string
+	if *typeNames {
+		buf.Reset()
+		for _, typ := range types {
+			ref := name + "." + typ.expr
+			if typ.ptr {
+				ref = "*" + ref
+			}
+			fmt.Fprintf(buf, typeNameFormat, ref, path, typ.name)
+		}
+		tns = buf.String()
+	}
+	// deprecated symbols, bound separately
+	var ds string
+	buf.Reset()
+	for k, kind := range [...]string{"const", "var", "", "func"} {
+		if kind != "" {
+			writeEntries(buf, valueFormat(kind), name, deprecated[k])
+		}
+	}
+	if buf.Len() > 0 {
+		ds = fmt.Sprintf(deprecatedPackagesTemplate, path, valueType(), buf.String())
+	}
+	buf.Reset()
+	writeEntries(buf, typeFormat, name, deprecated[2])
+	if buf.Len() > 0 {
+		ds += fmt.Sprintf(deprecatedPackageTypesTemplate, path, buf.String())
+	}
+	return fmt.Sprintf(initTemplate, init, values, fmt.Sprintf(packageTypesTemplate, path, ts), ns, cvs, tns, ds)
+}
+
+// valueType returns the type of the values of the env.Packages maps, and
+// of the other maps of values, selected by -value-kind.
+func valueType() string {
+	if *valueKind == "interface" {
+		return "interface{}"
+	}
+	return "reflect.Value"
+}
+
+// kindFormat returns the format of the entries of a map of values:
+// reflectFormat, or interfaceFormat with -value-kind interface.
+func kindFormat(reflectFormat, interfaceFormat string) string {
+	if *valueKind == "interface" {
+		return interfaceFormat
+	}
+	return reflectFormat
+}
+
+// writeEntries writes the entries of syms, ungrouped ones first and then
+// each group under its own comment.
+func writeEntries(buf *bytes.Buffer, format, name string, syms []*symbol) {
+	// about the format and two names by entry
+	buf.Grow(len(syms) * (len(format) + 32))
+	groups := make(map[string][]*symbol)
+	for _, sym := range syms {
+		if sym.group == "" {
+			writeEntry(buf, format, name, sym)
+			continue
+		}
+		groups[sym.group] = append(groups[sym.group], sym)
+	}
+	names := make([]string, 0, len(groups))
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+	for _, group := range names {
+		if !*compact {
+			fmt.Fprintf(buf, "\n"+tabs+"// %s\n", group)
+		}
+		for _, sym := range groups[group] {
+			writeEntry(buf, format, name, sym)
+		}
+	}
+}
+
+// writeValueTypes writes the type of every constant, variable and function,
+// for -emit-types-for-all. Untyped constants have the type of their value,
+// the default one unless converted; variables their declared type, even an
+// interface one.
+func writeValueTypes(buf *bytes.Buffer, name string, constants, vars, fns []*symbol) {
+	for _, group := range []struct {
+		comment string
+		syms    []*symbol
+		format  string
+	}{
+		{"types of the constants", constants, tabs + `"%s": reflect.TypeOf(%s),`},
+		{"types of the variables", vars, tabs + `"%s": reflect.TypeOf(&%s).Elem(),`},
+		{"types of the functions", fns, tabs + `"%s": reflect.TypeOf(%s),`},
+	} {
+		if len(group.syms) > 0 && !*compact {
+			fmt.Fprintf(buf, "\n"+tabs+"// %s\n", group.comment)
+		}
+		for _, sym := range group.syms {
+			if sym.funcType {
+				continue
+			}
+			ref := name + "." + sym.expr
+			if sym.conv != "" {
+				ref = sym.conv + "(" + ref + ")"
+			}
+			fmt.Fprintf(buf, group.format+"\n", sym.name, ref)
+		}
+	}
+}
+
+// reference returns the reference to sym of the package name in an entry:
+// its address, the pointer type or its conversion when needed.
+func reference(name string, sym *symbol) string {
+	ref := name + "." + sym.expr
+	if sym.addr {
+		ref = "&" + ref
+	}
+	if sym.ptr {
+		ref = "*" + ref
+	}
+	if sym.conv != "" {
+		ref = sym.conv + "(" + ref + ")"
+	}
+	return ref
+}
+
+// writeEntry writes a map entry of sym, preceded by its docs and followed by
+// its notes.
+func writeEntry(buf *bytes.Buffer, format, name string, sym *symbol) {
+	for _, line := range sym.docs {
+		buf.WriteString(tabs + "// ")
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	writeFormat(buf, format, sym.name, reference(name, sym))
+	for i, note := range sym.notes {
+		if i == 0 {
+			buf.WriteString(" // ")
+		} else {
+			buf.WriteString("; ")
+		}
+		buf.WriteString(note)
+	}
+	buf.WriteByte('\n')
+}
+
+// writeFormat writes format with its %s verbs replaced by args in order,
+// like fmt.Fprintf but without boxing the arguments, once per entry. The
+// formats with other verbs, like the ones of -config, go through
+// fmt.Fprintf.
+func writeFormat(buf *bytes.Buffer, format string, args ...string) {
+	if strings.Count(format, "%") != len(args) || strings.Count(format, "%s") != len(args) {
+		a := make([]interface{}, len(args))
+		for i, arg := range args {
+			a[i] = arg
+		}
+		fmt.Fprintf(buf, format, a...)
+		return
+	}
+	for _, arg := range args {
+		i := strings.Index(format, "%s")
+		buf.WriteString(format[:i])
+		buf.WriteString(arg)
+		format = format[i+2:]
 	}
-	ts := buf.String()
-	return fmt.Sprintf(initTemplate, init, path, cs, vs, fs, path, ts)
+	buf.WriteString(format)
 }
@@ -0,0 +1,3513 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Juby210/anko-package-gen2/loader"
+)
+
+// TestSortedEntries checks that the entries of every map literal generated
+// by the golden modes are sorted by key within their section or group, and
+// that a group is written once. The entries of the literals without
+// headers, like the ones of -compact, -shard and -platforms, are in the
+// section of the default mode.
+func TestSortedEntries(t *testing.T) {
+	config, err := os.ReadFile(filepath.Join("testdata", "golden", "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := testdataMod(t)
+	sections := make(map[string]string)
+	files := generate(t, cache, "golden", map[string]string{"config.json": string(config)}, "-config", "config.json")
+	for _, path := range []string{"example.com/golden", "example.com/golden/generic"} {
+		for _, e := range mapEntries(t, files, "Packages", path) {
+			sections[e.key] = e.group
+		}
+	}
+	for _, mode := range goldenModes {
+		mode := mode
+		if mode.env == "" {
+			continue
+		}
+		t.Run(mode.name, func(t *testing.T) {
+			t.Parallel()
+			args := append([]string{"-config", "config.json"}, mode.args...)
+			files := generate(t, cache, "golden", map[string]string{"config.json": string(config)}, args...)
+			for _, name := range sortedNames(files) {
+				fset := token.NewFileSet()
+				file, err := parser.ParseFile(fset, name, files[name], parser.ParseComments)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ast.Inspect(file, func(n ast.Node) bool {
+					lit, ok := n.(*ast.CompositeLit)
+					if !ok || !stringKeyed(lit) {
+						return true
+					}
+					entries := literalEntries(fset, file, files[name], lit)
+					for i, e := range entries {
+						if e.group == "" {
+							entries[i].group = sections[e.key]
+						}
+					}
+					checkSorted(t, fset.Position(lit.Pos()).String(), entries)
+					return true
+				})
+			}
+		})
+	}
+}
+
+// stringKeyed reports whether lit is a map literal keyed by strings.
+func stringKeyed(lit *ast.CompositeLit) bool {
+	m, ok := lit.Type.(*ast.MapType)
+	if !ok {
+		return false
+	}
+	id, ok := m.Key.(*ast.Ident)
+	return ok && id.Name == "string"
+}
+
+func checkSorted(t *testing.T, pos string, entries []entry) {
+	t.Helper()
+	written := make(map[string]bool)
+	for i := 0; i < len(entries); {
+		j := i
+		for j < len(entries) && entries[j].group == entries[i].group {
+			j++
+		}
+		group := entries[i].group
+		if written[group] {
+			t.Errorf("%s: group %q is written twice", pos, group)
+		}
+		written[group] = true
+		if names := keys(entries[i:j]); !sort.StringsAreSorted(names) {
+			t.Errorf("%s: entries of group %q aren't sorted: %s", pos, group, strings.Join(names, ", "))
+		}
+		i = j
+	}
+}
+
+// TestValueKindInterface builds the files of each mode splitting or
+// extending the maps with -value-kind interface, against the env stub with
+// interface{} values: the shards, the files per kind and the helpers
+// adding to the maps hold bare values too.
+func TestValueKindInterface(t *testing.T) {
+	cache := testdataMod(t)
+	for _, args := range [][]string{
+		nil,
+		{"-shard", "3"},
+		{"-split-by-kind"},
+		{"-split-by-kind", "-kinds", "const,func"},
+		{"-new", "-converters", "-emit-deprecated-separately"},
+		{"-lazy"},
+		{"-register"},
+	} {
+		args := args
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			t.Parallel()
+			files := generate(t, cache, "golden", nil, append([]string{"-value-kind", "interface"}, args...)...)
+			for _, e := range mapEntries(t, files, "Packages", "example.com/golden") {
+				if strings.Contains(e.value, "reflect.") {
+					t.Errorf("%s is registered as %s", e.key, e.value)
+				}
+			}
+			compile(t, files, "anko-interface", cache, []string{"golden"})
+		})
+	}
+}
+
+// TestCollisionWarnings checks that a name declared as a type and a value
+// by files of different platforms is reported once, whether the other
+// platform's file is excluded by the build constraints or collected by
+// -platforms.
+func TestCollisionWarnings(t *testing.T) {
+	cache := writeModule(t, "diverge", map[string]string{
+		"diverge_linux.go":   "package diverge\n\ntype Handle struct{}\n\nfunc Mode() int { return 0 }\n",
+		"diverge_windows.go": "package diverge\n\nconst Handle = 1\n\ntype Mode int\n",
+		"diverge.go":         "package diverge\n\ntype Common struct{}\n",
+	})
+	want := []string{
+		"example.com/diverge: Handle is declared both as a type and a constant",
+		"example.com/diverge: Mode is declared both as a type and a function",
+	}
+	for _, args := range [][]string{
+		nil,
+		{"-platforms", "linux/amd64,windows/amd64"},
+	} {
+		r := runGenerator(t, cache, nil, nil, append([]string{"-pkg", "example.com/diverge", "-v", "v1.0.0", "-name", "diverge"}, args...)...)
+		if r.err != nil {
+			t.Fatalf("%v\n%s", r.err, r.stderr)
+		}
+		for _, w := range want {
+			if n := strings.Count(r.stderr, w); n != 1 {
+				t.Errorf("%s: %q is reported %d times:\n%s", strings.Join(args, " "), w, n, r.stderr)
+			}
+		}
+		if strings.Contains(r.stderr, "Common") {
+			t.Errorf("%s: Common is reported:\n%s", strings.Join(args, " "), r.stderr)
+		}
+	}
+}
+
+// TestCrossPlatformCgo checks that -platforms selects the !cgo files of the
+// platforms other than the host, like a cross build does, unless
+// CGO_ENABLED=1, and the cgo ones of the host unless CGO_ENABLED=0.
+func TestCrossPlatformCgo(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("the host platform is listed as linux/amd64")
+	}
+	cache := writeModule(t, "cgoplat", map[string]string{
+		"native.go":   "//go:build cgo\n\npackage cgoplat\n\nfunc Native() {}\n",
+		"portable.go": "//go:build !cgo\n\npackage cgoplat\n\nfunc Portable() {}\n",
+		"common.go":   "package cgoplat\n\nfunc Common() {}\n",
+	})
+	for _, tt := range []struct {
+		cgo  string
+		want map[string]string // the cgo-dependent function of each platform, if known
+	}{
+		// the host selects cgo if a C compiler is found
+		{"", map[string]string{"windows_arm64": "Portable"}},
+		{"1", map[string]string{"linux_amd64": "Native", "windows_arm64": "Native"}},
+		{"0", map[string]string{"linux_amd64": "Portable", "windows_arm64": "Portable"}},
+	} {
+		r := runGenerator(t, cache, nil, []string{"CGO_ENABLED=" + tt.cgo}, "-pkg", "example.com/cgoplat", "-v", "v1.0.0", "-name", "cgoplat", "-quiet", "-platforms", "linux/amd64,windows/arm64")
+		if r.err != nil {
+			t.Fatalf("CGO_ENABLED=%s: %v\n%s", tt.cgo, r.err, r.stderr)
+		}
+		files := r.output(t)
+		for platform, want := range tt.want {
+			// the symbols registered by the main file and the one of the platform
+			got := values(mapEntries(t, map[string]string{
+				"cgoplat.go":                  files["cgoplat.go"],
+				"cgoplat_" + platform + ".go": files["cgoplat_"+platform+".go"],
+			}, "Packages", "example.com/cgoplat"))
+			for _, name := range []string{"Common", "Native", "Portable"} {
+				if _, ok := got[name]; ok != (name == "Common" || name == want) {
+					t.Errorf("CGO_ENABLED=%s: %s registers %s: %v", tt.cgo, platform, name, ok)
+				}
+			}
+		}
+	}
+}
+
+// TestOverlay checks that -overlay replaces, adds and hides the files of a
+// package, and that the files it adds are parsed in a stable order, so the
+// error reported first is the same on every run.
+func TestOverlay(t *testing.T) {
+	cache := writeModule(t, "drafts", map[string]string{
+		"a.go": "package drafts\n\nfunc Old() {}\n",
+		"b.go": "package drafts\n\nfunc Gone() {}\n",
+		"k.go": "package drafts\n\nfunc Kept() {}\n",
+	})
+	dir := filepath.Join(cache, "example.com", "drafts@v1.0.0")
+	overlay := func(replace map[string]interface{}) string {
+		m := make(map[string]interface{}, len(replace))
+		for name, to := range replace {
+			m[filepath.Join(dir, name)] = to
+		}
+		b, err := json.Marshal(map[string]interface{}{"Replace": m})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	files := generate(t, cache, "drafts", map[string]string{
+		"overlay.json": overlay(map[string]interface{}{"a.go": "new_a.go", "c.go": "c.go", "b.go": nil}),
+		"new_a.go":     "package drafts\n\nfunc New() {}\n",
+		"c.go":         "package drafts\n\nfunc Added() {}\n",
+	}, "-overlay", "overlay.json")
+	if got, want := keys(mapEntries(t, files, "Packages", "example.com/drafts")), []string{"Added", "Kept", "New"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("the overlaid package exports %v, want %v", got, want)
+	}
+
+	for i := 0; i < 5; i++ {
+		r := runGenerator(t, cache, map[string]string{
+			"overlay.json": overlay(map[string]interface{}{"y.go": "y.go", "x.go": "x.go", "w.go": "w.go"}),
+			"w.go":         "package drafts\n\nfunc W() {}\n",
+			"x.go":         "package drafts\n\nfunc X( {}\n",
+			"y.go":         "package drafts\n\nfunc Y( {}\n",
+		}, nil, "-pkg", "example.com/drafts", "-v", "v1.0.0", "-name", "drafts", "-quiet", "-overlay", "overlay.json")
+		if r.err == nil || !strings.Contains(r.stderr, "x.go:3") || strings.Contains(r.stderr, "y.go") {
+			t.Fatalf("run %d: %v, want the error of x.go only:\n%s", i, r.err, r.stderr)
+		}
+	}
+}
+
+// TestMinGo checks that -min-go evaluates the goX.Y build constraints
+// against the given version instead of the host's, and rejects a version
+// that isn't Go 1's.
+func TestMinGo(t *testing.T) {
+	cache := writeModule(t, "releases", map[string]string{
+		"future.go": "//go:build go1.99\n\npackage releases\n\nfunc Future() {}\n",
+		"legacy.go": "//go:build !go1.21\n\npackage releases\n\nfunc Legacy() {}\n",
+		"always.go": "package releases\n\nfunc Always() {}\n",
+	})
+	for _, tt := range []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{"Always"}},
+		{[]string{"-min-go", "1.20"}, []string{"Always", "Legacy"}},
+		{[]string{"-min-go", "1.21"}, []string{"Always"}},
+		{[]string{"-min-go", "go1.99.1"}, []string{"Always", "Future"}},
+	} {
+		files := generate(t, cache, "releases", nil, tt.args...)
+		if got := keys(mapEntries(t, files, "Packages", "example.com/releases")); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: exported %v, want %v", tt.args, got, tt.want)
+		}
+	}
+
+	for _, v := range []string{"2.0", "1.x", "go1"} {
+		r := runGenerator(t, cache, nil, nil, "-pkg", "example.com/releases", "-v", "v1.0.0", "-name", "releases", "-min-go", v)
+		if code := exitCode(r.err); code != 2 || !strings.Contains(r.stderr, "Invalid argument: min-go: "+strconv.Quote(v)+" isn't a Go 1 version") {
+			t.Errorf("-min-go %s: exit status %d, want 2 with the invalid version:\n%s", v, code, r.stderr)
+		}
+	}
+}
+
+// TestExitCodes checks the exit statuses scripts can rely on: 0 on success,
+// 1 on errors like a source that doesn't parse, 2 on invalid arguments and
+// 3 when nothing is exported with -require-nonempty.
+func TestExitCodes(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		src  string
+		args []string
+		code int
+		msg  string
+	}{
+		{"ok", "package ok\n\nfunc Do() {}\n", nil, 0, ""},
+		{"broken", "package broken\n\nfunc Do( {}\n", nil, 1, "expected ')'"},
+		{"conflict", "package conflict\n\nfunc Do() {}\n", []string{"-shard", "2", "-platforms", "linux/amd64"}, 2, "Invalid argument: shard can't be used with platforms"},
+		{"unknown", "package unknown\n\nfunc Do() {}\n", []string{"-no-such-flag"}, 2, "flag provided but not defined"},
+		{"hidden", "package hidden\n\nfunc do() {}\n", []string{"-require-nonempty"}, 3, "no symbols exported"},
+		{"lenient", "package lenient\n\nfunc do() {}\n", nil, 0, ""},
+	} {
+		cache := writeModule(t, tt.name, map[string]string{tt.name + ".go": tt.src})
+		r := runGenerator(t, cache, nil, nil, append([]string{"-pkg", "example.com/" + tt.name, "-v", "v1.0.0", "-name", tt.name, "-quiet"}, tt.args...)...)
+		if code := exitCode(r.err); code != tt.code || !strings.Contains(r.stderr, tt.msg) {
+			t.Errorf("%s: exit status %d, want %d with %q:\n%s", tt.name, code, tt.code, tt.msg, r.stderr)
+		}
+	}
+}
+
+// TestReplaceImport checks that -replace-import binds a package, and the
+// ones below it, under the import path of its fork, which the consumer
+// compiles against.
+func TestReplaceImport(t *testing.T) {
+	src := map[string]string{
+		"upstream.go": "package upstream\n\nfunc Hello() string { return \"hello\" }\n",
+		"sub/sub.go":  "package sub\n\nconst Answer = 42\n",
+	}
+	cache := writeModule(t, "upstream", src)
+	fork := map[string]string{"go.mod": "module example.com/fork\n\ngo 1.21\n"}
+	for name, s := range src {
+		if name != "go.mod" {
+			fork[name] = strings.Replace(s, "package upstream", "package fork", 1)
+		}
+	}
+	writeFiles(t, filepath.Join(cache, "example.com", "fork@v1.0.0"), fork)
+
+	files := generate(t, cache, "upstream", nil, "-replace-import", "example.com/upstream=example.com/fork")
+	file, err := parser.ParseFile(token.NewFileSet(), "upstream.go", files["upstream.go"], parser.ImportsOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var imports []string
+	for _, spec := range file.Imports {
+		if path := unquote(spec.Path); strings.HasPrefix(path, "example.com/") {
+			imports = append(imports, path)
+		}
+	}
+	if want := []string{"example.com/fork", "example.com/fork/sub"}; !reflect.DeepEqual(imports, want) {
+		t.Errorf("the generated file imports %v, want %v", imports, want)
+	}
+	for path, key := range map[string]string{"example.com/fork": "Hello", "example.com/fork/sub": "Answer"} {
+		if _, ok := values(mapEntries(t, files, "Packages", path))[key]; !ok {
+			t.Errorf("%s isn't bound under %s", key, path)
+		}
+	}
+	if strings.Contains(files["upstream.go"], `"example.com/upstream`) {
+		t.Errorf("the generated file still refers to example.com/upstream:\n%s", files["upstream.go"])
+	}
+	compile(t, files, "anko", cache, []string{"fork"})
+
+	r := runGenerator(t, cache, nil, nil, "-pkg", "example.com/upstream", "-v", "v1.0.0", "-name", "upstream", "-replace-import", "example.com/upstream")
+	if code := exitCode(r.err); code != 2 || !strings.Contains(r.stderr, "want old=new") {
+		t.Errorf("-replace-import without new: exit status %d, want 2:\n%s", code, r.stderr)
+	}
+}
+
+// TestBestEffort checks that -best-effort drops the declaration of a file
+// that doesn't parse, warning about its error, and exports the intact ones
+// the parser recovered before it, and skips a file whose package clause
+// doesn't parse, while the run fails without it.
+func TestBestEffort(t *testing.T) {
+	for _, tt := range []struct {
+		name, broken string
+		line         int
+	}{
+		{"body", "func Broken() int {\n\treturn 1 +\n}\n", 13},
+		// the parser doesn't find the end of the declaration
+		{"signature", "func Broken(x int {\n\treturn\n}\n", 11},
+	} {
+		cache := writeModule(t, tt.name, map[string]string{
+			tt.name + ".go": "package " + tt.name + `
+
+const Limit = 3
+
+func Good() int { return Limit }
+
+type Point struct{ X int }
+
+var Origin = Point{}
+
+` + tt.broken,
+			"clause.go": "pakage " + tt.name + "\n\nfunc Lost() {}\n",
+			"fine.go":   "package " + tt.name + "\n\nfunc Fine() {}\n",
+		})
+		args := []string{"-pkg", "example.com/" + tt.name, "-v", "v1.0.0", "-name", tt.name}
+		if r := runGenerator(t, cache, nil, nil, args...); exitCode(r.err) != 1 {
+			t.Fatalf("%s: without -best-effort: %v, want exit status 1:\n%s", tt.name, r.err, r.stderr)
+		}
+
+		r := runGenerator(t, cache, nil, nil, append(args, "-best-effort")...)
+		if r.err != nil {
+			t.Fatalf("%s: %v\n%s", tt.name, r.err, r.stderr)
+		}
+		files := r.output(t)
+		path := "example.com/" + tt.name
+		got := append(keys(mapEntries(t, files, "Packages", path)), keys(mapEntries(t, files, "PackageTypes", path))...)
+		if want := []string{"Limit", "Origin", "Fine", "Good", "Point"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: exported %v, want %v", tt.name, got, want)
+		}
+		for _, warning := range []*regexp.Regexp{
+			regexp.MustCompile(`warning: \S+` + tt.name + `\.go:` + strconv.Itoa(tt.line) + `:\d+: `),
+			regexp.MustCompile(`warning: \S+clause\.go:1:1: expected 'package', found pakage, skipping the file`),
+		} {
+			if !warning.MatchString(r.stderr) {
+				t.Errorf("%s: no warning matching %s:\n%s", tt.name, warning, r.stderr)
+			}
+		}
+	}
+}
+
+// TestIntersection checks that -intersection only binds the symbols the
+// package exports at both versions under the same kind, skipping the
+// packages missing from the other version, so the bindings compile against
+// either.
+func TestIntersection(t *testing.T) {
+	cache := testdataMod(t)
+	r := runGenerator(t, cache, nil, nil, "-pkg", "example.com/evolve", "-v", "v1.1.0", "-intersection", "v1.0.0", "-name", "evolve", "-quiet")
+	if r.err != nil {
+		t.Fatalf("%v\n%s", r.err, r.stderr)
+	}
+	files := r.output(t)
+	path := "example.com/evolve"
+	got := append(keys(mapEntries(t, files, "Packages", path)), keys(mapEntries(t, files, "PackageTypes", path))...)
+	if want := []string{"Version", "Default", "Stable", "Config"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("exported %v, want %v", got, want)
+	}
+	if entries := mapEntries(t, files, "Packages", path+"/extra"); len(entries) != 0 {
+		t.Errorf("the package missing from v1.0.0 exports %v", keys(entries))
+	}
+
+	dir := consumer(t, files, "anko", cache, []string{"evolve"})
+	gomod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{"v1.0.0", "v1.1.0"} {
+		src := strings.Replace(string(gomod), "evolve@v1.0.0", "evolve@"+version, 1)
+		writeFiles(t, dir, map[string]string{"go.mod": src})
+		cmd := exec.Command("go", "vet", "./...")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("building against %s: %v\n%s", version, err, output)
+		}
+	}
+}
+
+// TestArchive checks that -archive binds the packages of a module zip or
+// tarball, under a path@version/ prefix or a GitHub-style top directory,
+// leaving out a nested module, and that the bindings compile against the
+// module.
+func TestArchive(t *testing.T) {
+	module := map[string]string{
+		"arc.go":           "package arc\n\nfunc Hello() string { return \"hello\" }\n",
+		"util/util.go":     "package util\n\nconst Answer = 42\n",
+		"nested/go.mod":    "module example.com/arc/nested\n\ngo 1.21\n",
+		"nested/nested.go": "package nested\n\nfunc Other() {}\n",
+		"nested/deep/d.go": "package deep\n\nfunc Deeper() {}\n",
+		"README.md":        "# arc\n",
+	}
+	cache := writeModule(t, "arc", module)
+	for _, tt := range []struct {
+		archive string
+		prefix  string
+		args    []string
+	}{
+		{"arc.zip", "example.com/arc@v1.0.0/", nil},
+		{"arc.tar.gz", "arc-1.0.0/", nil},
+		{"arc.tgz", "arc-main/", []string{"-pkg", "example.com/arc"}},
+	} {
+		files := make(map[string]string, len(module))
+		for name, src := range module {
+			files[tt.prefix+name] = src
+		}
+		if tt.args != nil {
+			// a tarball of a repository without go.mod
+			delete(files, tt.prefix+"go.mod")
+		}
+		r := runGenerator(t, cache, map[string]string{tt.archive: writeArchive(t, tt.archive, files)}, nil, append([]string{"-archive", tt.archive, "-name", "arc", "-quiet"}, tt.args...)...)
+		if r.err != nil {
+			t.Fatalf("%s: %v\n%s", tt.archive, r.err, r.stderr)
+		}
+		output := r.output(t)
+		for path, want := range map[string][]string{
+			"example.com/arc":             {"Hello"},
+			"example.com/arc/util":        {"Answer"},
+			"example.com/arc/nested":      nil,
+			"example.com/arc/nested/deep": nil,
+		} {
+			if got := keys(mapEntries(t, output, "Packages", path)); !reflect.DeepEqual(got, want) && len(got)+len(want) > 0 {
+				t.Errorf("%s: %s exports %v, want %v", tt.archive, path, got, want)
+			}
+		}
+		compile(t, output, "anko", cache, []string{"arc"})
+	}
+}
+
+// writeArchive returns the zip or tar.gz archive, after the extension of name,
+// of the files.
+func writeArchive(t testing.TB, name string, files map[string]string) string {
+	var buf bytes.Buffer
+	if strings.HasSuffix(name, ".zip") {
+		w := zip.NewWriter(&buf)
+		for _, file := range sortedNames(files) {
+			f, err := w.Create(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(f, files[file])
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for _, file := range sortedNames(files) {
+		if err := w.WriteHeader(&tar.Header{Name: file, Mode: 0o644, Size: int64(len(files[file])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, files[file])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// TestByConstraint checks that -by-constraint registers the symbols of a
+// build-constrained file from a file with the same constraint, by its name
+// suffix or its //go:build line, defining the init function of the other
+// builds: each build registers the symbols of its files.
+func TestByConstraint(t *testing.T) {
+	files := map[string]string{
+		"go.mod":     "module example.com/bycon\n\ngo 1.21\n",
+		"common.go":  "package bycon\n\nfunc Common() {}\n",
+		"x_linux.go": "package bycon\n\nfunc OnLinux() {}\n",
+		"sum_asm.go": "//go:build !purego\n\npackage bycon\n\nfunc Sum() int { return 1 }\n\nfunc Fast() {}\n",
+		"sum_go.go":  "//go:build purego\n\npackage bycon\n\nfunc Sum() int { return 0 }\n",
+	}
+	cache := writeModule(t, "bycon", files)
+	out := generate(t, cache, "bycon", nil, "-by-constraint")
+	want := []string{"bycon.go", "bycon_constraint1.go", "bycon_constraint1_other.go", "bycon_constraint2.go", "bycon_constraint2_other.go", "bycon_constraint3.go", "bycon_constraint3_other.go"}
+	if names := sortedNames(out); !reflect.DeepEqual(names, want) {
+		t.Fatalf("got the files %q, want %q", names, want)
+	}
+	compile(t, out, "anko", cache, []string{"bycon"}, "linux", "darwin")
+
+	for _, tt := range []struct {
+		goos string
+		tags []string
+		want []string
+	}{
+		{"linux", nil, []string{"Common", "Fast", "OnLinux", "Sum"}},
+		{"darwin", nil, []string{"Common", "Fast", "Sum"}},
+		{"linux", []string{"purego"}, []string{"Common", "OnLinux", "Sum"}},
+	} {
+		ctxt := build.Default
+		ctxt.GOOS, ctxt.GOARCH, ctxt.BuildTags = tt.goos, "amd64", tt.tags
+		ctxt.OpenFile = func(path string) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(out[filepath.Base(path)])), nil
+		}
+		selected := make(map[string]string)
+		for name, src := range out {
+			ok, err := ctxt.MatchFile(".", name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				selected[name] = src
+			}
+		}
+		var got []string
+		for key := range values(mapEntries(t, selected, "Packages", "example.com/bycon")) {
+			got = append(got, key)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q: got %q, want %q", tt.goos, tt.tags, got, tt.want)
+		}
+		for i := 1; i <= 3; i++ {
+			a, b := fmt.Sprintf("bycon_constraint%d.go", i), fmt.Sprintf("bycon_constraint%d_other.go", i)
+			if _, ok := selected[a]; ok == (selected[b] != "") {
+				t.Errorf("%s %q: want exactly one of %s and %s", tt.goos, tt.tags, a, b)
+			}
+		}
+	}
+}
+
+// TestDescriptor checks that -format json lists the symbols of each package
+// by kind, and that the loader registers them at runtime from the values of
+// the compiled bindings.
+func TestDescriptor(t *testing.T) {
+	files := map[string]string{
+		"desc.go":     "package desc\n\nconst Max = 3\n\nvar Count int\n\ntype Point struct{ X int }\n\nfunc Double(x int) int { return 2 * x }\n",
+		"sub/sub.go":  "package sub\n\nfunc Hello() string { return \"hello\" }\n",
+		"internal.go": "package desc\n\nfunc hidden() {}\n",
+	}
+	cache := writeModule(t, "desc", files)
+	out := generate(t, cache, "desc", nil, "-format", "json")
+	if names := sortedNames(out); !reflect.DeepEqual(names, []string{"desc.json"}) {
+		t.Fatalf("got the files %q, want desc.json", names)
+	}
+	pkgs, err := loader.Decode(strings.NewReader(out["desc.json"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []loader.Package{
+		{Path: "example.com/desc", Name: "desc", Constants: []string{"Max"}, Variables: []string{"Count"}, Functions: []string{"Double"}, Types: []string{"Point"}},
+		{Path: "example.com/desc/sub", Name: "sub", Functions: []string{"Hello"}},
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Fatalf("got the descriptor %+v, want %+v", pkgs, want)
+	}
+
+	bindings := generate(t, cache, "desc", nil)
+	dir := consumer(t, bindings, "anko", cache, []string{"desc"})
+	root, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gomod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{
+		"go.mod":    string(gomod) + "\nrequire github.com/Juby210/anko-package-gen2 v0.0.0\n\nreplace github.com/Juby210/anko-package-gen2 => " + root + "\n",
+		"desc.json": out["desc.json"],
+		"main.go": `package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/Juby210/anko-package-gen2/loader"
+	"github.com/mattn/anko/env"
+
+	_ "consumer/packages"
+)
+
+func main() {
+	f, err := os.Open("desc.json")
+	if err != nil {
+		panic(err)
+	}
+	pkgs, err := loader.Decode(f)
+	if err != nil {
+		panic(err)
+	}
+	to := loader.Registry{
+		Packages:     map[string]map[string]reflect.Value{},
+		PackageTypes: map[string]map[string]reflect.Type{},
+	}
+	if err := loader.Load(pkgs, loader.Registry{Packages: env.Packages, PackageTypes: env.PackageTypes}, to); err != nil {
+		panic(err)
+	}
+	desc := to.Packages["example.com/desc"]
+	fmt.Println(desc["Double"].Call([]reflect.Value{reflect.ValueOf(4)})[0], desc["Max"], to.PackageTypes["example.com/desc"]["Point"])
+	fmt.Println(to.Packages["example.com/desc/sub"]["Hello"].Call(nil)[0])
+}
+`,
+	})
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("running the consumer: %v\n%s", err, output)
+	}
+	if got, want := string(output), "8 3 desc.Point\nhello\n"; got != want {
+		t.Errorf("got the output %q, want %q", got, want)
+	}
+}
+
+// TestStdoutSink checks that -o - prints the files a run writes to the
+// output dir, each after a // name.go line, without writing them.
+func TestStdoutSink(t *testing.T) {
+	files := map[string]string{
+		"a.go":       "package sink\n\nfunc A() {}\n",
+		"b_linux.go": "package sink\n\nfunc B() {}\n",
+	}
+	cache := writeModule(t, "sink", files)
+	args := []string{"-pkg", "example.com/sink", "-v", "v1.0.0", "-name", "sink", "-quiet", "-platforms", "linux/amd64,darwin/amd64"}
+	want := generate(t, cache, "sink", nil, args[7:]...)
+	r := runGenerator(t, cache, nil, nil, append(args, "-o", "-")...)
+	if r.err != nil {
+		t.Fatalf("%v\n%s", r.err, r.stderr)
+	}
+	if _, err := os.Stat(filepath.Join(r.dir, "anko-packages")); !os.IsNotExist(err) {
+		t.Errorf("-o - wrote the output dir: %v", err)
+	}
+	got := make(map[string]string)
+	heads := regexp.MustCompile(`(?m)^// (\S+\.go)\n\n`).FindAllStringSubmatchIndex(r.stdout, -1)
+	for i, h := range heads {
+		end := len(r.stdout)
+		if i+1 < len(heads) {
+			end = heads[i+1][0]
+		}
+		// the header of the files lists the arguments, -o - included
+		got[r.stdout[h[2]:h[3]]] = strings.Replace(r.stdout[h[1]:end-1], " -o -.", ".", 1)
+	}
+	if names := sortedNames(got); !reflect.DeepEqual(names, sortedNames(want)) {
+		t.Fatalf("got the files %q, want %q", names, sortedNames(want))
+	}
+	for name, src := range want {
+		if got[name] != src {
+			t.Errorf("%s: got\n%s\nwant\n%s", name, got[name], src)
+		}
+	}
+}
+
+// TestStd checks that -std generates the packages go list std lists,
+// leaving out the internal and vendored ones and unsafe, into bindings that
+// build. A go wrapper first in PATH keeps the list to a few packages.
+func TestStd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the go wrapper is a shell script")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found")
+	}
+	bin := t.TempDir()
+	list := "container/list\nerrors\ninternal/bytealg\ncrypto/internal/boring\nnet/http/internal\nunicode/utf8\nunsafe\nvendor/golang.org/x/crypto/chacha20\n"
+	writeFiles(t, bin, map[string]string{
+		"go": "#!/bin/sh\nif [ \"$1 $2\" = \"list std\" ]; then\n\tprintf '" + strings.ReplaceAll(list, "\n", "\\n") + "'\n\texit\nfi\nexec " + goCmd + " \"$@\"\n",
+	})
+	if err := os.Chmod(filepath.Join(bin, "go"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	r := runGenerator(t, testdataMod(t), nil, []string{"PATH=" + bin + string(os.PathListSeparator) + os.Getenv("PATH")}, "-std", "-name", "std", "-quiet")
+	if r.err != nil {
+		t.Fatalf("%v\n%s", r.err, r.stderr)
+	}
+	out := r.output(t)
+	if names := sortedNames(out); !reflect.DeepEqual(names, []string{"std.go"}) {
+		t.Fatalf("got the files %q, want std.go", names)
+	}
+	var paths []string
+	for _, m := range regexp.MustCompile(`env\.Packages\["([^"]+)"\]`).FindAllStringSubmatch(out["std.go"], -1) {
+		paths = append(paths, m[1])
+	}
+	if want := []string{"container/list", "errors", "unicode/utf8"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("got the packages %q, want %q", paths, want)
+	}
+	if got := values(mapEntries(t, out, "Packages", "unicode/utf8")); got["RuneError"] != "reflect.ValueOf(utf8.RuneError)" {
+		t.Errorf("got the unicode/utf8 entries %v, want RuneError", got)
+	}
+	compile(t, out, "anko", "", nil)
+}
+
+// TestValidateConfig checks that -validate-config reports the problems of
+// every file given, all those of the config at once, and exits with status
+// 1 on a problem without generating.
+func TestValidateConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		files map[string]string
+		args  []string
+		code  int
+		want  []string
+	}{
+		{
+			name: "ok",
+			files: map[string]string{
+				"c.json":   `{"instantiations": {"p": {"Set[string]": "StringSet"}}, "value_formats": {"func": "wrap(%s)"}}`,
+				"o.json":   `{"Replace": {}}`,
+				"t.tmpl":   `{{.Path}}`,
+				"head.txt": "// head\n",
+			},
+			args: []string{"-config", "c.json", "-overlay", "o.json", "-template", "t.tmpl", "-header-file", "head.txt", "-footer-file", "head.txt"},
+			want: []string{"config ok"},
+		},
+		{
+			name:  "config",
+			files: map[string]string{"c.json": `{"instantiations": {"p": {"Set[": "1x"}}, "function_types": {"p": ["a b"]}, "value_formats": {"type": "f(%s, %d)"}, "packages": [{"dir": "nope", "path": "x"}, {"path": "y"}], "generic_functions": {"p": [{"func": "Min"}]}}`},
+			args:  []string{"-config", "c.json"},
+			code:  1,
+			want: []string{
+				`c.json: function_types: p: "a b" isn't an identifier`,
+				`c.json: generic_functions: p: "Min" needs a function name and instantiations`,
+				`c.json: instantiations: p: "1x" isn't an identifier`,
+				`c.json: instantiations: p: "Set[" isn't an instantiation like Set[string]`,
+				`c.json: packages: entry 1: nope isn't a directory`,
+				`c.json: packages: entry 2 needs a dir and a path`,
+				`c.json: value_formats: "f(%s, %d)" must contain %s once`,
+				`c.json: value_formats: unknown kind "type", want const, var or func`,
+			},
+		},
+		{
+			name:  "syntax",
+			files: map[string]string{"c.json": `{"imports": [`},
+			args:  []string{"-config", "c.json"},
+			code:  1,
+			want:  []string{"c.json: unexpected end of JSON input"},
+		},
+		{
+			name:  "files",
+			files: map[string]string{"o.json": `{"Replace": 3}`, "t.tmpl": `{{.Path`},
+			args:  []string{"-overlay", "o.json", "-template", "t.tmpl", "-header-file", "head.txt", "-footer-file", "foot.txt"},
+			code:  1,
+			want: []string{
+				"o.json: json: cannot unmarshal number",
+				"template: t.tmpl:1: unclosed action",
+				"open head.txt: no such file or directory",
+				"open foot.txt: no such file or directory",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := runGenerator(t, testdataMod(t), tt.files, nil, append([]string{"-validate-config"}, tt.args...)...)
+			if code := exitCode(r.err); code != tt.code {
+				t.Errorf("got the exit status %d, want %d\n%s", code, tt.code, r.stderr)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(r.stderr, want) {
+					t.Errorf("the output doesn't report %q:\n%s", want, r.stderr)
+				}
+			}
+			if tt.code != 0 && strings.Contains(r.stderr, "config ok") {
+				t.Errorf("reported config ok:\n%s", r.stderr)
+			}
+			if _, err := os.Stat(filepath.Join(r.dir, "anko-packages")); !os.IsNotExist(err) {
+				t.Errorf("generated the output dir: %v", err)
+			}
+		})
+	}
+}
+
+// TestSkipDeprecatedPackages checks that -skip-deprecated-packages skips
+// the packages whose doc comment has a Deprecated: paragraph, in any file or
+// in a doc.go left out by the build constraints, and binds them otherwise.
+func TestSkipDeprecatedPackages(t *testing.T) {
+	cache := writeModule(t, "deppkg", map[string]string{
+		"deppkg.go":   "package deppkg\n\nfunc Root() {}\n",
+		"old/a.go":    "package old\n\nfunc A() {}\n",
+		"old/b.go":    "// Package old is old.\n//\n// Deprecated: use deppkg.\npackage old\n\nfunc B() {}\n",
+		"gone/doc.go": "//go:build ignore\n\n// Deprecated: use deppkg.\npackage gone\n",
+		"gone/g.go":   "package gone\n\nfunc G() {}\n",
+		"fine/f.go":   "// Package fine replaces the deprecated old package.\npackage fine\n\nfunc F() {}\n",
+	})
+	for _, tt := range []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{"example.com/deppkg", "example.com/deppkg/fine", "example.com/deppkg/gone", "example.com/deppkg/old"}},
+		{[]string{"-skip-deprecated-packages"}, []string{"example.com/deppkg", "example.com/deppkg/fine"}},
+	} {
+		out := generate(t, cache, "deppkg", nil, tt.args...)
+		var got []string
+		for _, path := range []string{"example.com/deppkg", "example.com/deppkg/fine", "example.com/deppkg/gone", "example.com/deppkg/old"} {
+			if len(mapEntries(t, out, "Packages", path)) > 0 {
+				got = append(got, path)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got the packages %q, want %q", tt.args, got, tt.want)
+		}
+		compile(t, out, "anko", cache, []string{"deppkg"})
+	}
+}
+
+// TestNewOpaque checks that -new-opaque adds the structs without exported
+// fields to the constructors of -new, which skips them otherwise.
+func TestNewOpaque(t *testing.T) {
+	files := map[string]string{
+		"ctor.go": "package ctor\n\ntype Open struct{ X int }\n\ntype Embeds struct{ Open }\n\ntype Opaque struct{ x int }\n\ntype Empty struct{}\n\ntype Count int\n",
+	}
+	cache := writeModule(t, "ctor", files)
+	for _, tt := range []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"-new"}, []string{"Embeds", "Open"}},
+		{[]string{"-new", "-new-opaque"}, []string{"Embeds", "Empty", "Opaque", "Open"}},
+	} {
+		out := generate(t, cache, "ctor", nil, tt.args...)
+		entries := mapEntries(t, out, "PackageNew", "example.com/ctor")
+		if got := keys(entries); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got the constructors %q, want %q", tt.args, got, tt.want)
+		}
+		compile(t, out, "anko", cache, []string{"ctor"})
+	}
+}
+
+// TestMaxSymbols checks that -max-symbols fails on a package exporting more
+// symbols, or only warns with -warn-max-symbols, and logs the largest
+// packages.
+func TestMaxSymbols(t *testing.T) {
+	cache := writeModule(t, "maxsym", map[string]string{
+		"maxsym.go":  "package maxsym\n\nconst A = 1\n\nvar B int\n\nfunc C() {}\n",
+		"small/s.go": "package small\n\nfunc S() {}\n",
+	})
+	args := []string{"-pkg", "example.com/maxsym", "-v", "v1.0.0", "-name", "maxsym"}
+	for _, tt := range []struct {
+		args []string
+		code int
+		want []string
+	}{
+		{[]string{"-max-symbols", "3"}, 0, []string{"largest packages:", "\texample.com/maxsym: 3 symbols", "\texample.com/maxsym/small: 1 symbols"}},
+		{[]string{"-max-symbols", "2"}, 1, []string{"example.com/maxsym exports 3 symbols, more than -max-symbols 2"}},
+		{[]string{"-max-symbols", "2", "-warn-max-symbols"}, 0, []string{"warning: example.com/maxsym exports 3 symbols, more than -max-symbols 2"}},
+	} {
+		r := runGenerator(t, cache, nil, nil, append(args, tt.args...)...)
+		if code := exitCode(r.err); code != tt.code {
+			t.Fatalf("%q: got the exit status %d, want %d\n%s", tt.args, code, tt.code, r.stderr)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(r.stderr, want) {
+				t.Errorf("%q: the output doesn't report %q:\n%s", tt.args, want, r.stderr)
+			}
+		}
+		if tt.code != 0 {
+			continue
+		}
+		out := r.output(t)
+		if got := keys(mapEntries(t, out, "Packages", "example.com/maxsym")); !reflect.DeepEqual(got, []string{"A", "B", "C"}) {
+			t.Errorf("%q: got the entries %q, want A B C", tt.args, got)
+		}
+	}
+}
+
+// TestCheckImports checks that -check-imports warns about the imports of
+// the source packages that don't resolve, once each, and only with the flag.
+func TestCheckImports(t *testing.T) {
+	cache := writeModule(t, "chk", map[string]string{
+		"a.go":     "package chk\n\nimport (\n\t\"strings\"\n\n\t\"example.com/chk/sub\"\n\t\"example.com/missing\"\n)\n\nfunc A() string { return strings.ToUpper(sub.S + missing.M) }\n",
+		"b.go":     "package chk\n\nimport \"example.com/missing\"\n\nvar B = missing.M\n",
+		"sub/s.go": "package sub\n\nconst S = \"s\"\n",
+	})
+	args := []string{"-pkg", "example.com/chk", "-v", "v1.0.0", "-name", "chk"}
+	for _, tt := range []struct {
+		args []string
+		want int
+	}{
+		{nil, 0},
+		{[]string{"-check-imports"}, 1},
+	} {
+		r := runGenerator(t, cache, nil, nil, append(args, tt.args...)...)
+		if r.err != nil {
+			t.Fatalf("%q: %v\n%s", tt.args, r.err, r.stderr)
+		}
+		if got := strings.Count(r.stderr, "warning: example.com/chk: unresolved import example.com/missing: "); got != tt.want {
+			t.Errorf("%q: got %d warnings about example.com/missing, want %d:\n%s", tt.args, got, tt.want, r.stderr)
+		}
+		if got := strings.Count(r.stderr, "unresolved import"); got != tt.want {
+			t.Errorf("%q: got %d unresolved imports, want %d:\n%s", tt.args, got, tt.want, r.stderr)
+		}
+	}
+}
+
+// TestHeaderFooter checks that -header-file and -footer-file wrap the
+// generated file verbatim, ending the footer with a newline, and that a
+// footer breaking the file fails the run.
+func TestHeaderFooter(t *testing.T) {
+	cache := writeModule(t, "foot", map[string]string{
+		"foot.go": "package foot\n\nfunc F() {}\n",
+	})
+	files := map[string]string{
+		"license.txt": "// Copyright 2024 The Authors.\n\n",
+		"footer.txt":  "\nvar registered = true\n\n// end",
+		"broken.txt":  "}\n",
+	}
+	out := generate(t, cache, "foot", files, "-header-file", "license.txt", "-footer-file", "footer.txt")
+	src := out["foot.go"]
+	if !strings.HasPrefix(src, files["license.txt"]+"// Code generated by anko-package-gen2 ") {
+		t.Errorf("the file doesn't start with the header:\n%s", src)
+	}
+	if !strings.HasSuffix(src, "}\n"+files["footer.txt"]+"\n") {
+		t.Errorf("the file doesn't end with the footer:\n%s", src)
+	}
+	compile(t, out, "anko", cache, []string{"foot"})
+
+	r := runGenerator(t, cache, files, nil, "-pkg", "example.com/foot", "-v", "v1.0.0", "-name", "foot", "-quiet", "-footer-file", "broken.txt")
+	if code := exitCode(r.err); code != 1 || !strings.Contains(r.stderr, "invalid header or footer: ") {
+		t.Errorf("got the exit status %d, want 1 for an invalid footer:\n%s", code, r.stderr)
+	}
+}
+
+// TestPackageClause checks that -package sets the package clause of every
+// generated file, and must be an identifier.
+func TestPackageClause(t *testing.T) {
+	cache := writeModule(t, "clause", map[string]string{
+		"a.go":       "package clause\n\nfunc A() {}\n",
+		"b_linux.go": "package clause\n\nfunc B() {}\n",
+	})
+	for _, args := range [][]string{
+		{"-package", "ankobind"},
+		{"-package", "ankobind", "-platforms", "linux/amd64,darwin/amd64"},
+		{"-package", "ankobind", "-by-constraint"},
+		{"-package", "ankobind", "-emit-string", "Source"},
+	} {
+		out := generate(t, cache, "clause", nil, args...)
+		for _, name := range sortedNames(out) {
+			file, err := parser.ParseFile(token.NewFileSet(), name, out[name], parser.PackageClauseOnly)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.Name.Name != "ankobind" {
+				t.Errorf("%q: %s: got the package %s, want ankobind", args, name, file.Name.Name)
+			}
+		}
+		compile(t, out, "anko", cache, []string{"clause"})
+	}
+
+	r := runGenerator(t, cache, nil, nil, "-pkg", "example.com/clause", "-v", "v1.0.0", "-name", "clause", "-package", "anko-bind")
+	if code := exitCode(r.err); code != 2 || !strings.Contains(r.stderr, "Invalid argument: package must be an identifier") {
+		t.Errorf("got the exit status %d, want 2 for a package that isn't an identifier:\n%s", code, r.stderr)
+	}
+}
+
+// TestInstantiateAny checks that -instantiate-any registers the generic
+// types with a single any or interface{} type parameter at their [any]
+// instantiation, and only them.
+func TestInstantiateAny(t *testing.T) {
+	cache := writeModule(t, "anyinst", map[string]string{
+		"anyinst.go": "package anyinst\n\ntype Plain struct{}\n\ntype Box[T any] struct{ V T }\n\ntype Bag[T interface{}] []T\n\ntype Pair[K, V any] struct {\n\tK K\n\tV V\n}\n\ntype Set[T comparable] map[T]bool\n",
+	})
+	for _, tt := range []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{"Plain"}},
+		{[]string{"-instantiate-any"}, []string{"Bag", "Box", "Plain"}},
+	} {
+		out := generate(t, cache, "anyinst", nil, tt.args...)
+		entries := mapEntries(t, out, "PackageTypes", "example.com/anyinst")
+		got := keys(entries)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got the types %q, want %q", tt.args, got, tt.want)
+		}
+		for name, value := range values(entries) {
+			if name != "Plain" && !strings.Contains(value, "anyinst."+name+"[any]") {
+				t.Errorf("%q: %s is registered as %s, want the [any] instantiation", tt.args, name, value)
+			}
+		}
+		compile(t, out, "anko", cache, []string{"anyinst"})
+	}
+}
+
+// TestBetaMarker checks that -beta-marker replaces the Beta: marker of the
+// symbols -stability stable drops with Experimental: ones, and that the
+// default beta level keeps them all.
+func TestBetaMarker(t *testing.T) {
+	cache := writeModule(t, "beta", map[string]string{
+		"beta.go": "package beta\n\nfunc Stable() {}\n\n// Exp is new.\n//\n// Experimental: may change.\nfunc Exp() {}\n\n// Trial is new.\n//\n// Beta: may change.\nfunc Trial() {}\n\n// Next is new.\n//\n// Preview: may change.\nfunc Next() {}\n",
+	})
+	for _, tt := range []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"-stability", "stable"}, []string{"Next", "Stable"}},
+		{[]string{"-stability", "stable", "-beta-marker", "Preview:"}, []string{"Stable", "Trial"}},
+		{[]string{"-stability", "stable", "-beta-marker", ""}, []string{"Next", "Stable", "Trial"}},
+		{[]string{"-beta-marker", "Preview:"}, []string{"Exp", "Next", "Stable", "Trial"}},
+	} {
+		out := generate(t, cache, "beta", nil, tt.args...)
+		got := keys(mapEntries(t, out, "Packages", "example.com/beta"))
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got the functions %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestEmitString checks that -emit-string writes the generated file as a
+// string constant holding the file written otherwise, backquotes included.
+func TestEmitString(t *testing.T) {
+	cache := writeModule(t, "str", map[string]string{
+		"str.go": "package str\n\nfunc Quote(s string) string { return s }\n",
+	})
+	header := map[string]string{"header.txt": "// Run `go generate` to update.\n\n"}
+	want := generate(t, cache, "str", header, "-header-file", "header.txt")["str.go"]
+	out := generate(t, cache, "str", header, "-header-file", "header.txt", "-emit-string", "Source")
+	if names := sortedNames(out); !reflect.DeepEqual(names, []string{"str.go"}) {
+		t.Fatalf("got the files %q, want str.go", names)
+	}
+	got := execute(t, out, "anko", cache, nil, "package main\n\nimport (\n\t\"fmt\"\n\n\t\"consumer/packages\"\n)\n\nfunc main() { fmt.Print(packages.Source) }\n")
+	if got = strings.Replace(got, " -emit-string Source", "", 1); got != want {
+		t.Errorf("got the string\n%s\nwant\n%s", got, want)
+	}
+
+	for _, args := range [][]string{
+		{"-emit-string", "the-source"},
+		{"-emit-string", "Source", "-platforms", "linux/amd64"},
+	} {
+		r := runGenerator(t, cache, nil, nil, append([]string{"-pkg", "example.com/str", "-v", "v1.0.0", "-name", "str"}, args...)...)
+		if code := exitCode(r.err); code != 2 || !strings.Contains(r.stderr, "Invalid argument: emit-string ") {
+			t.Errorf("%q: got the exit status %d, want 2:\n%s", args, code, r.stderr)
+		}
+	}
+}
+
+// TestEmitGenerate checks that -emit-generate writes a generate.go whose
+// directive reproduces the run from the output directory, where go generate
+// runs it: the path flags are made relative to it and the arguments holding
+// spaces are quoted.
+func TestEmitGenerate(t *testing.T) {
+	cache := writeModule(t, "gen", map[string]string{
+		"gen.go": "package gen\n\nfunc G() {}\n",
+	})
+	r := runGenerator(t, cache, map[string]string{"header.txt": "// Header.\n\n"}, nil,
+		"-pkg", "example.com/gen", "-v", "v1.0.0", "-name", "gen", "-quiet", "-o", "out", "-package", "bind",
+		"-header-file", "header.txt", "-beta-marker", "Not yet:", "-emit-generate")
+	if r.err != nil {
+		t.Fatalf("%v\n%s", r.err, r.stderr)
+	}
+	out := filepath.Join(r.dir, "out")
+	want := readFiles(t, out)
+	directive := "package bind\n\n//go:generate anko-package-gen2 -o=. \"-beta-marker=Not yet:\" -emit-generate -header-file=../header.txt -name=gen -package=bind -pkg=example.com/gen -quiet -v=v1.0.0\n"
+	if got := want["generate.go"]; got != directive {
+		t.Fatalf("got generate.go\n%s\nwant\n%s", got, directive)
+	}
+
+	if err := os.Remove(filepath.Join(out, "gen.go")); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "generate", "generate.go")
+	cmd.Dir = out
+	cmd.Env = append(os.Environ(), "PATH="+filepath.Dir(generator)+string(os.PathListSeparator)+os.Getenv("PATH"), "GOMODCACHE="+cache, "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go generate: %v\n%s", err, output)
+	}
+	got := readFiles(t, out)
+	// the header of the file lists the arguments of the run
+	want["gen.go"] = strings.Replace(want["gen.go"], "-pkg example.com/gen -v v1.0.0 -name gen -quiet -o out -package bind -header-file header.txt -beta-marker Not yet: -emit-generate", "-o=. -beta-marker=Not yet: -emit-generate -header-file=../header.txt -name=gen -package=bind -pkg=example.com/gen -quiet -v=v1.0.0", 1)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("go generate wrote\n%v\nwant\n%v", got, want)
+	}
+}
+
+// TestForceExport checks that -force-export refuses to bind unexported
+// identifiers, exiting with status 2 after explaining why, and that it
+// points exported ones to -coverage instead.
+func TestForceExport(t *testing.T) {
+	cache := writeModule(t, "force", map[string]string{
+		"force.go": "package force\n\nfunc Open() {}\n\nfunc helper() {}\n",
+	})
+	for _, tt := range []struct {
+		value string
+		want  string
+	}{
+		{"helper", "force-export helper: unexported identifiers can't be bound: the generated package can't refer to them"},
+		{"helper,open", "force-export helper,open: unexported identifiers can't be bound"},
+		{"helper,Open", "Invalid argument: force-export: Open is exported, and bound unless dropped (see -coverage)"},
+	} {
+		r := runGenerator(t, cache, nil, nil, "-pkg", "example.com/force", "-v", "v1.0.0", "-name", "force", "-force-export", tt.value)
+		if code := exitCode(r.err); code != 2 || !strings.Contains(r.stderr, tt.want) {
+			t.Errorf("-force-export %s: got the exit status %d, want 2 reporting %q:\n%s", tt.value, code, tt.want, r.stderr)
+		}
+		if _, err := os.Stat(filepath.Join(r.dir, "anko-packages")); !os.IsNotExist(err) {
+			t.Errorf("-force-export %s wrote the output: %v", tt.value, err)
+		}
+	}
+}
+
+// TestEvalSymlinks checks that a module directory of the cache linking to
+// another one is walked, deriving the import paths from the cache, unless
+// -eval-symlinks=false leaves filepath.Walk to not follow it.
+func TestEvalSymlinks(t *testing.T) {
+	target := t.TempDir()
+	writeFiles(t, target, map[string]string{
+		"go.mod":   "module example.com/link\n\ngo 1.21\n",
+		"l.go":     "package link\n\nfunc L() {}\n",
+		"sub/s.go": "package sub\n\nfunc S() {}\n",
+	})
+	cache := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(cache, "example.com"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(cache, "example.com", "link@v1.0.0")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	for _, tt := range []struct {
+		args []string
+		want map[string][]string
+	}{
+		{nil, map[string][]string{"example.com/link": {"L"}, "example.com/link/sub": {"S"}}},
+		{[]string{"-eval-symlinks=false"}, map[string][]string{"example.com/link": nil, "example.com/link/sub": nil}},
+	} {
+		out := generate(t, cache, "link", nil, tt.args...)
+		for path, want := range tt.want {
+			if got := keys(mapEntries(t, out, "Packages", path)); strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("%q: %s is bound with %q, want %q", tt.args, path, got, want)
+			}
+		}
+		if strings.Contains(out["link.go"], target) {
+			t.Errorf("%q: the file refers to the link target %s:\n%s", tt.args, target, out["link.go"])
+		}
+	}
+	compile(t, generate(t, cache, "link", nil), "anko", cache, []string{"link"})
+}
+
+// TestPackageName checks that -package-name picks the package of that name
+// in a directory declaring several, where the first by name is exported
+// otherwise, and skips the directories without it.
+func TestPackageName(t *testing.T) {
+	cache := writeModule(t, "pn", map[string]string{
+		"mixed/a.go":     "package alpha\n\nfunc A() {}\n",
+		"mixed/b.go":     "package beta\n\nfunc B() {}\n",
+		"mixed/c.go":     "package beta\n\nfunc C() {}\n",
+		"other/other.go": "package other\n\nfunc O() {}\n",
+	})
+	for _, tt := range []struct {
+		args []string
+		want map[string][]string
+	}{
+		{nil, map[string][]string{"example.com/pn/mixed": {"A"}, "example.com/pn/other": {"O"}}},
+		{[]string{"-package-name", "beta"}, map[string][]string{"example.com/pn/mixed": {"B", "C"}, "example.com/pn/other": nil}},
+	} {
+		out := generate(t, cache, "pn", nil, tt.args...)
+		for path, want := range tt.want {
+			if got := keys(mapEntries(t, out, "Packages", path)); strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("%q: %s is bound with %q, want %q", tt.args, path, got, want)
+			}
+		}
+	}
+
+	r := runGenerator(t, cache, nil, nil, "-pkg", "example.com/pn", "-v", "v1.0.0", "-name", "pn", "-package-name", "main")
+	if !strings.Contains(r.stderr, "warning: package-name main: Go doesn't allow importing main packages") {
+		t.Errorf("-package-name main doesn't warn that main packages can't be imported:\n%s", r.stderr)
+	}
+}
+
+// TestNoInternalTypes checks that the functions and variables using a type
+// of an internal package are bound with a warning, and dropped with
+// -no-internal-types.
+func TestNoInternalTypes(t *testing.T) {
+	cache := writeModule(t, "intl", map[string]string{
+		"intl.go":               "package intl\n\nimport \"example.com/intl/internal/impl\"\n\nvar Default impl.Conn\n\nfunc Dial() *impl.Conn { return nil }\n\nfunc Plain() int { return 0 }\n",
+		"internal/impl/impl.go": "package impl\n\ntype Conn struct{}\n",
+	})
+	args := []string{"-pkg", "example.com/intl", "-v", "v1.0.0", "-name", "intl"}
+	for _, tt := range []struct {
+		args     []string
+		want     []string
+		warnings int
+	}{
+		{nil, []string{"Default", "Dial", "Plain"}, 2},
+		{[]string{"-no-internal-types"}, []string{"Plain"}, 0},
+	} {
+		r := runGenerator(t, cache, nil, nil, append(args, tt.args...)...)
+		if r.err != nil {
+			t.Fatalf("%q: %v\n%s", tt.args, r.err, r.stderr)
+		}
+		out := r.output(t)
+		got := keys(mapEntries(t, out, "Packages", "example.com/intl"))
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got the entries %q, want %q", tt.args, got, tt.want)
+		}
+		if n := strings.Count(r.stderr, "uses internal type example.com/intl/internal/impl.Conn, which scripts can't name"); n != tt.warnings {
+			t.Errorf("%q: got %d warnings about impl.Conn, want %d:\n%s", tt.args, n, tt.warnings, r.stderr)
+		}
+		compile(t, out, "anko", cache, []string{"intl"})
+	}
+}
+
+// TestWarnCase checks that -warn-case warns about the values, and the types,
+// whose names only differ by case, binding them all, and that a value and a
+// type, in maps of their own, don't collide.
+func TestWarnCase(t *testing.T) {
+	cache := writeModule(t, "casing", map[string]string{
+		"casing.go": "package casing\n\nconst URL = \"u\"\n\nfunc Url() {}\n\ntype POINT struct{}\n\ntype Point struct{}\n\ntype NODE struct{}\n\nfunc Node() {}\n",
+	})
+	args := []string{"-pkg", "example.com/casing", "-v", "v1.0.0", "-name", "casing"}
+	for _, tt := range []struct {
+		args []string
+		want []string
+	}{
+		{nil, nil},
+		{[]string{"-warn-case"}, []string{
+			"warning: example.com/casing: value names URL and Url only differ by case",
+			"warning: example.com/casing: type names POINT and Point only differ by case",
+		}},
+	} {
+		r := runGenerator(t, cache, nil, nil, append(args, tt.args...)...)
+		if r.err != nil {
+			t.Fatalf("%q: %v\n%s", tt.args, r.err, r.stderr)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(r.stderr, want) {
+				t.Errorf("%q: no %q:\n%s", tt.args, want, r.stderr)
+			}
+		}
+		if n := strings.Count(r.stderr, "only differ by case"); n != len(tt.want) {
+			t.Errorf("%q: got %d warnings, want %d:\n%s", tt.args, n, len(tt.want), r.stderr)
+		}
+		out := r.output(t)
+		if got := len(mapEntries(t, out, "Packages", "example.com/casing")) + len(mapEntries(t, out, "PackageTypes", "example.com/casing")); got != 6 {
+			t.Errorf("%q: got %d entries, want 6", tt.args, got)
+		}
+	}
+}
+
+// TestSkipPanicStubs checks that -skip-panic-stubs drops the functions
+// whose body only panics, reporting them in -coverage, and keeps the ones
+// panicking on a condition or doing more.
+func TestSkipPanicStubs(t *testing.T) {
+	cache := writeModule(t, "stub", map[string]string{
+		"stub.go": "package stub\n\nfunc Todo() { panic(\"not implemented\") }\n\nfunc Must(err error) {\n\tif err != nil {\n\t\tpanic(err)\n\t}\n}\n\nfunc Fail() int {\n\tprintln(\"failing\")\n\tpanic(\"fail\")\n}\n\nfunc Done() {}\n",
+	})
+	for _, tt := range []struct {
+		args    []string
+		want    []string
+		dropped []droppedSymbol
+	}{
+		{nil, []string{"Done", "Fail", "Must", "Todo"}, nil},
+		{[]string{"-skip-panic-stubs"}, []string{"Done", "Fail", "Must"}, []droppedSymbol{{Name: "Todo", Kind: "func", Reason: "panics"}}},
+	} {
+		r := runGenerator(t, cache, nil, nil, append([]string{"-pkg", "example.com/stub", "-v", "v1.0.0", "-name", "stub", "-quiet", "-coverage", "coverage.json"}, tt.args...)...)
+		if r.err != nil {
+			t.Fatalf("%v\n%s", r.err, r.stderr)
+		}
+		if got := keys(mapEntries(t, r.output(t), "Packages", "example.com/stub")); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got the functions %q, want %q", tt.args, got, tt.want)
+		}
+		b, err := os.ReadFile(filepath.Join(r.dir, "coverage.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var coverage []packageCoverage
+		if err := json.Unmarshal(b, &coverage); err != nil {
+			t.Fatal(err)
+		}
+		if len(coverage) != 1 || !reflect.DeepEqual(coverage[0].Dropped, tt.dropped) {
+			t.Errorf("%q: the coverage is %+v, want %+v dropped", tt.args, coverage, tt.dropped)
+		}
+	}
+}
+
+// TestKeepLinkname checks that the bodiless functions pulled from another
+// package with //go:linkname are dropped, unless -keep-linkname, while the
+// functions with a body the directive pushes are kept.
+func TestKeepLinkname(t *testing.T) {
+	cache := writeModule(t, "link", map[string]string{
+		"link.go": "package link\n\nimport _ \"unsafe\"\n\n//go:linkname Nanotime runtime.nanotime\nfunc Nanotime() int64\n\n//go:linkname Pushed\nfunc Pushed() {}\n\nfunc Plain() {}\n",
+	})
+	for _, tt := range []struct {
+		args    []string
+		want    []string
+		dropped []droppedSymbol
+	}{
+		{nil, []string{"Plain", "Pushed"}, []droppedSymbol{{Name: "Nanotime", Kind: "func", Reason: "linkname"}}},
+		{[]string{"-keep-linkname"}, []string{"Nanotime", "Plain", "Pushed"}, nil},
+	} {
+		r := runGenerator(t, cache, nil, nil, append([]string{"-pkg", "example.com/link", "-v", "v1.0.0", "-name", "link", "-quiet", "-coverage", "coverage.json"}, tt.args...)...)
+		if r.err != nil {
+			t.Fatalf("%v\n%s", r.err, r.stderr)
+		}
+		if got := keys(mapEntries(t, r.output(t), "Packages", "example.com/link")); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got the functions %q, want %q", tt.args, got, tt.want)
+		}
+		b, err := os.ReadFile(filepath.Join(r.dir, "coverage.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var coverage []packageCoverage
+		if err := json.Unmarshal(b, &coverage); err != nil {
+			t.Fatal(err)
+		}
+		if len(coverage) != 1 || !reflect.DeepEqual(coverage[0].Dropped, tt.dropped) {
+			t.Errorf("%q: the coverage is %+v, want %+v dropped", tt.args, coverage, tt.dropped)
+		}
+	}
+}
+
+// TestAllowMain checks that a directory's only main package is exported
+// with -allow-main, warning that it can't be imported, and skipped
+// otherwise, while another package of the directory is chosen first.
+func TestAllowMain(t *testing.T) {
+	cache := writeModule(t, "mainpkg", map[string]string{
+		"cmd/tool/main.go": "package main\n\nfunc Run() {}\n\nfunc main() { Run() }\n",
+		"mixed/main.go":    "package main\n\nfunc Main() {}\n",
+		"mixed/lib.go":     "package lib\n\nfunc Lib() {}\n",
+	})
+	args := []string{"-pkg", "example.com/mainpkg", "-v", "v1.0.0", "-name", "mainpkg"}
+	for _, tt := range []struct {
+		args []string
+		want map[string][]string
+		warn bool
+	}{
+		{nil, map[string][]string{"example.com/mainpkg/cmd/tool": nil, "example.com/mainpkg/mixed": {"Lib"}}, false},
+		{[]string{"-allow-main"}, map[string][]string{"example.com/mainpkg/cmd/tool": {"Run"}, "example.com/mainpkg/mixed": {"Lib"}}, true},
+	} {
+		r := runGenerator(t, cache, nil, nil, append(args, tt.args...)...)
+		if r.err != nil {
+			t.Fatalf("%q: %v\n%s", tt.args, r.err, r.stderr)
+		}
+		out := r.output(t)
+		for path, want := range tt.want {
+			if got := keys(mapEntries(t, out, "Packages", path)); strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("%q: %s is bound with %q, want %q", tt.args, path, got, want)
+			}
+		}
+		if warned := strings.Contains(r.stderr, "warning: allow-main: Go doesn't allow importing main packages"); warned != tt.warn {
+			t.Errorf("%q: warned %v, want %v:\n%s", tt.args, warned, tt.warn, r.stderr)
+		}
+	}
+}
+
+// TestSummary checks that -summary prints the numbers of symbols of each
+// kind bound per package, with why a package is skipped, and their totals,
+// aligned in columns.
+func TestSummary(t *testing.T) {
+	cache := writeModule(t, "sum", map[string]string{
+		"sum.go":   "package sum\n\nconst A = 1\n\nvar B int\n\ntype C struct{}\n\nfunc D() {}\n\nfunc E() {}\n",
+		"sub/s.go": "package sub\n\nfunc S() {}\n",
+		"old/o.go": "// Deprecated: gone.\npackage old\n\nfunc O() {}\n",
+	})
+	r := runGenerator(t, cache, nil, nil, "-pkg", "example.com/sum", "-v", "v1.0.0", "-name", "sum", "-quiet", "-summary", "-skip-deprecated-packages")
+	if r.err != nil {
+		t.Fatalf("%v\n%s", r.err, r.stderr)
+	}
+	want := `example.com/sum:     1 consts, 1 vars, 1 types, 2 funcs
+example.com/sum/old: 0 consts, 0 vars, 0 types, 0 funcs (skipped: deprecated package)
+example.com/sum/sub: 0 consts, 0 vars, 0 types, 1 funcs
+total (3 packages):  1 consts, 1 vars, 1 types, 3 funcs
+`
+	if r.stderr != want {
+		t.Errorf("got the summary\n%s\nwant\n%s", r.stderr, want)
+	}
+}
+
+// TestKnownBuiltins checks that -known-builtins warns when generating the
+// listed packages, anko standing for the ones anko binds, and still
+// generates them.
+func TestKnownBuiltins(t *testing.T) {
+	files := map[string]string{
+		"c.json":   `{"packages": [{"dir": "str", "path": "strings"}, {"dir": "own", "path": "example.com/own"}]}`,
+		"str/s.go": "package strings\n\nfunc Upper() {}\n",
+		"own/o.go": "package own\n\nfunc Own() {}\n",
+	}
+	const warning = " is bound by the known builtins already: with both imported, the init running last replaces the other's bindings"
+	for _, tt := range []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{"anko", []string{"strings"}},
+		{"example.com/own", []string{"example.com/own"}},
+		{"anko,example.com/own", []string{"strings", "example.com/own"}},
+	} {
+		r := runGenerator(t, testdataMod(t), files, nil, "-config", "c.json", "-name", "kb", "-known-builtins", tt.value)
+		if r.err != nil {
+			t.Fatalf("%q: %v\n%s", tt.value, r.err, r.stderr)
+		}
+		for _, path := range tt.want {
+			if !strings.Contains(r.stderr, "warning: "+path+warning) {
+				t.Errorf("-known-builtins %q: no warning about %s:\n%s", tt.value, path, r.stderr)
+			}
+		}
+		if n := strings.Count(r.stderr, warning); n != len(tt.want) {
+			t.Errorf("-known-builtins %q: got %d warnings, want %d:\n%s", tt.value, n, len(tt.want), r.stderr)
+		}
+		out := r.output(t)
+		for _, path := range []string{"strings", "example.com/own"} {
+			if len(mapEntries(t, out, "Packages", path)) != 1 {
+				t.Errorf("-known-builtins %q: %s isn't bound", tt.value, path)
+			}
+		}
+	}
+}
+
+// TestGoimports checks that -goimports runs every generated Go file through
+// the goimports of PATH, fails on its errors, and keeps the gofmt output,
+// warning once, when it's missing.
+func TestGoimports(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the goimports stubs are shell scripts")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found")
+	}
+	cache := writeModule(t, "imp", map[string]string{
+		"a.go":       "package imp\n\nfunc A() {}\n",
+		"b_linux.go": "package imp\n\nfunc B() {}\n",
+	})
+	args := []string{"-pkg", "example.com/imp", "-v", "v1.0.0", "-name", "imp", "-platforms", "linux/amd64,darwin/amd64"}
+	want := generate(t, cache, "imp", nil, args[6:]...)
+	for _, tt := range []struct {
+		name      string
+		goimports string
+		code      int
+		prefix    string
+		stderr    string
+	}{
+		{"missing", "", 0, "", "warning: goimports: not found in PATH, keeping the output of gofmt"},
+		{"run", "#!/bin/sh\necho '// goimports'\n/bin/cat\n", 0, "// goimports\n", ""},
+		{"failing", "#!/bin/sh\necho 'could not import example.com/x' >&2\nexit 1\n", 1, "", "goimports imp.go: exit status 1: could not import example.com/x"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			bin := t.TempDir()
+			if tt.goimports != "" {
+				writeFiles(t, bin, map[string]string{"goimports": tt.goimports})
+				if err := os.Chmod(filepath.Join(bin, "goimports"), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			path := bin + string(os.PathListSeparator) + filepath.Dir(goCmd)
+			r := runGenerator(t, cache, nil, []string{"PATH=" + path}, append(args, "-goimports")...)
+			if code := exitCode(r.err); code != tt.code {
+				t.Fatalf("got the exit status %d, want %d:\n%s", code, tt.code, r.stderr)
+			}
+			if tt.stderr != "" && strings.Count(r.stderr, tt.stderr) != 1 {
+				t.Errorf("the output doesn't report %q once:\n%s", tt.stderr, r.stderr)
+			}
+			if tt.code != 0 {
+				return
+			}
+			got := r.output(t)
+			if names := sortedNames(got); !reflect.DeepEqual(names, sortedNames(want)) {
+				t.Fatalf("got the files %q, want %q", names, sortedNames(want))
+			}
+			for name, src := range want {
+				// the header of the files lists the arguments, -quiet of
+				// generate but not -goimports
+				src = strings.Replace(src, " -quiet", "", 1)
+				if g := strings.Replace(got[name], " -goimports.", ".", 1); g != tt.prefix+src {
+					t.Errorf("%s: got\n%s\nwant\n%s", name, g, tt.prefix+src)
+				}
+			}
+		})
+	}
+}
+
+// TestNoteChannels checks that -note-channels notes the direction of the
+// channels functions return, on their entry, and leaves the parameters and
+// the other runs alone.
+func TestNoteChannels(t *testing.T) {
+	cache := writeModule(t, "ch", map[string]string{
+		"ch.go": "package ch\n\nfunc Recv() <-chan int { return nil }\n\nfunc Send() chan<- string { return nil }\n\nfunc Both() (chan error, error) { return nil, nil }\n\nfunc Take(c <-chan int) {}\n",
+	})
+	for _, tt := range []struct {
+		args []string
+		want map[string]string
+	}{
+		{nil, map[string]string{"Both": "", "Recv": "", "Send": "", "Take": ""}},
+		{[]string{"-note-channels"}, map[string]string{
+			"Both": " // returns chan error",
+			"Recv": " // returns receive-only <-chan int",
+			"Send": " // returns send-only chan<- string",
+			"Take": "",
+		}},
+	} {
+		out := generate(t, cache, "ch", nil, tt.args...)
+		for name, note := range tt.want {
+			entry := fmt.Sprintf("%q: reflect.ValueOf(ch.%s),%s\n", name, name, note)
+			if !strings.Contains(out["ch.go"], entry) {
+				t.Errorf("%q: no entry %q:\n%s", tt.args, entry, out["ch.go"])
+			}
+		}
+		compile(t, out, "anko", cache, []string{"ch"})
+	}
+}
+
+// TestDenyByDefault checks that -deny-by-default only exports the symbols
+// of the -baseline file, dropping the others as not approved and leaving out
+// the packages without any, where -baseline alone fails on them.
+func TestDenyByDefault(t *testing.T) {
+	cache := writeModule(t, "deny", map[string]string{
+		"deny.go":  "package deny\n\nconst A = 1\n\nfunc B() {}\n\ntype T struct{}\n",
+		"sub/s.go": "package sub\n\nfunc S() {}\n",
+	})
+	files := map[string]string{"approved.txt": "example.com/deny.A\n\nexample.com/deny.T\n"}
+	args := []string{"-pkg", "example.com/deny", "-v", "v1.0.0", "-name", "deny", "-quiet", "-baseline", "approved.txt"}
+	r := runGenerator(t, cache, files, nil, append(args, "-deny-by-default", "-coverage", "coverage.json")...)
+	if r.err != nil {
+		t.Fatalf("%v\n%s", r.err, r.stderr)
+	}
+	out := r.output(t)
+	for m, want := range map[string][]string{"Packages": {"A"}, "PackageTypes": {"T"}} {
+		if got := keys(mapEntries(t, out, m, "example.com/deny")); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", m, got, want)
+		}
+	}
+	if strings.Contains(out["deny.go"], `"example.com/deny/sub"`) {
+		t.Errorf("the package without approved symbols is registered:\n%s", out["deny.go"])
+	}
+	b, err := os.ReadFile(filepath.Join(r.dir, "coverage.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var coverage []packageCoverage
+	if err := json.Unmarshal(b, &coverage); err != nil {
+		t.Fatal(err)
+	}
+	want := []droppedSymbol{{Name: "B", Kind: "func", Reason: "not approved"}}
+	if len(coverage) == 0 || !reflect.DeepEqual(coverage[0].Dropped, want) {
+		t.Errorf("the coverage is %+v, want %+v dropped", coverage, want)
+	}
+	compile(t, out, "anko", cache, []string{"deny"})
+
+	if r := runGenerator(t, cache, files, nil, args...); exitCode(r.err) != 1 {
+		t.Errorf("-baseline without -deny-by-default: got the exit status %d, want 1 on the unapproved symbols:\n%s", exitCode(r.err), r.stderr)
+	}
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-deny-by-default"}, "Missing required argument: baseline"},
+		{[]string{"-deny-by-default", "-baseline", "approved.txt", "-update-baseline"}, "Invalid argument: deny-by-default can't be used with update-baseline"},
+	} {
+		r := runGenerator(t, cache, files, nil, append([]string{"-pkg", "example.com/deny", "-v", "v1.0.0", "-name", "deny"}, tt.args...)...)
+		if code := exitCode(r.err); code != 2 || !strings.Contains(r.stderr, tt.want) {
+			t.Errorf("%q: got the exit status %d, want 2 reporting %q:\n%s", tt.args, code, tt.want, r.stderr)
+		}
+	}
+}
+
+// TestExcludedCollisionWarnings checks that a constant and a type sharing
+// their name are reported when neither of their files is built, like the
+// darwin and windows files of a linux run.
+func TestExcludedCollisionWarnings(t *testing.T) {
+	cache := writeModule(t, "elsewhere", map[string]string{
+		"elsewhere_darwin.go":  "package elsewhere\n\ntype Kind struct{}\n",
+		"elsewhere_windows.go": "package elsewhere\n\nconst Kind = \"windows\"\n",
+		"elsewhere.go":         "package elsewhere\n\nfunc Name() string { return \"\" }\n",
+	})
+	r := runGenerator(t, cache, nil, nil, "-pkg", "example.com/elsewhere", "-v", "v1.0.0", "-name", "elsewhere")
+	if r.err != nil {
+		t.Fatalf("%v\n%s", r.err, r.stderr)
+	}
+	if w := "example.com/elsewhere: Kind is declared both as a type and a constant"; !strings.Contains(r.stderr, w) {
+		t.Errorf("%q isn't reported:\n%s", w, r.stderr)
+	}
+}
+
+// TestExternalTestPackages checks that the symbols of an external foo_test
+// package are never bound, and that -external-test fails with status 2
+// explaining why, instead of generating bindings that can't import them.
+func TestExternalTestPackages(t *testing.T) {
+	cache := writeModule(t, "extern", map[string]string{
+		"extern.go":         "package extern\n\nfunc Open() {}\n",
+		"extern_test.go":    "package extern\n\nfunc Internal() {}\n",
+		"helpers_test.go":   "package extern_test\n\nfunc Helper() {}\n",
+		"open/open.go":      "package open\n\nconst Mode = 1\n",
+		"open/mode_test.go": "package open_test\n\nconst TestMode = 2\n",
+	})
+	files := generate(t, cache, "extern", nil)
+	for path, want := range map[string][]string{
+		"example.com/extern":      {"Open"},
+		"example.com/extern/open": {"Mode"},
+	} {
+		if got := keys(mapEntries(t, files, "Packages", path)); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s is bound with %v, want %v", path, got, want)
+		}
+	}
+	for _, path := range []string{"example.com/extern_test", "example.com/extern/open_test"} {
+		if strings.Contains(files["extern.go"], strconv.Quote(path)) {
+			t.Errorf("%s is bound:\n%s", path, files["extern.go"])
+		}
+	}
+
+	r := runGenerator(t, cache, nil, nil, "-pkg", "example.com/extern", "-v", "v1.0.0", "-name", "extern", "-external-test")
+	if code := exitCode(r.err); code != 2 || !strings.Contains(r.stderr, "no other package, the generated one included, can import it") {
+		t.Errorf("-external-test: got the exit status %d, want 2 explaining why foo_test can't be bound:\n%s", code, r.stderr)
+	}
+	if _, err := os.Stat(filepath.Join(r.dir, "anko-packages")); !os.IsNotExist(err) {
+		t.Errorf("-external-test wrote the output: %v", err)
+	}
+}
+
+// writeLargePackage writes a package of n constants, variables, types and
+// functions of each kind spread over files, as large as the biggest ones of
+// the standard library, and returns its directory. It selects every kind,
+// as the default -kinds does once parsed.
+func writeLargePackage(b *testing.B, n int) string {
+	b.Helper()
+	for _, kind := range []string{"const", "var", "type", "func"} {
+		exportKinds[kind] = true
+	}
+	dir := b.TempDir()
+	files := make(map[string]string)
+	for f := 0; f < 10; f++ {
+		var src strings.Builder
+		fmt.Fprintf(&src, "package large\n\nimport \"io\"\n\ntype Kind%d int\n\nconst (\n", f)
+		for i := 0; i < n/10; i++ {
+			fmt.Fprintf(&src, "\tKind%d_%d Kind%d = iota\n", f, i, f)
+		}
+		src.WriteString(")\n\nconst (\n")
+		for i := 0; i < n/10; i++ {
+			fmt.Fprintf(&src, "\tLimit%d_%d = %d\n\tName%d_%d = \"name\"\n", f, i, i, f, i)
+		}
+		src.WriteString(")\n\nvar (\n")
+		for i := 0; i < n/10; i++ {
+			fmt.Fprintf(&src, "\tDefault%d_%d = &Value%d_%d{}\n\tOutput%d_%d io.Writer\n", f, i, f, i, f, i)
+		}
+		src.WriteString(")\n")
+		for i := 0; i < n/10; i++ {
+			fmt.Fprintf(&src, "\n// Value%[1]d_%[2]d is a value.\ntype Value%[1]d_%[2]d struct{ N int }\n\n"+
+				"func (v *Value%[1]d_%[2]d) Write(p []byte) (int, error) { return len(p), nil }\n\n"+
+				"// New%[1]d_%[2]d returns a value.\nfunc New%[1]d_%[2]d(n int) *Value%[1]d_%[2]d { return &Value%[1]d_%[2]d{n} }\n", f, i)
+		}
+		files[fmt.Sprintf("large%d.go", f)] = src.String()
+	}
+	writeFiles(b, dir, files)
+	return dir
+}
+
+func BenchmarkCollectDeclaration(b *testing.B) {
+	dir := writeLargePackage(b, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := collectDeclaration(dir, "example.com/large", ".", "Large"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerateCode(b *testing.B) {
+	d, err := collectDeclaration(writeLargePackage(b, 1000), "example.com/large", ".", "Large")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		generateCode(d.path, d.name, d.init, d.constants, d.variables, d.types, d.functions, d.deprecated)
+	}
+}
+
+// TestComplementaryFiles checks that the symbols declared both by an
+// assembly-backed file and by its pure Go fallback, like the ones of the
+// crypto packages, are bound once, from the file selected by the tag set.
+func TestComplementaryFiles(t *testing.T) {
+	cache := writeModule(t, "sum", map[string]string{
+		"sum.go":         "package sum\n\n// Size is the size of a checksum.\nconst Size = 4\n",
+		"sum_amd64.go":   "//go:build !purego\n\npackage sum\n\nconst BlockSize = 64\n\nvar Impl = \"amd64\"\n\nfunc Sum(b []byte) uint32 { return uint32(len(b)) }\n",
+		"sum_generic.go": "//go:build !amd64 || purego\n\npackage sum\n\nconst BlockSize = 64\n\nvar Impl = \"generic\"\n\nfunc Sum(b []byte) uint32 { return 0 }\n",
+	})
+	for _, test := range []struct {
+		name string
+		env  []string
+		args []string
+		file string // declaring BlockSize, Impl and Sum
+	}{
+		{"amd64", nil, nil, "sum_amd64.go"},
+		{"arm64", []string{"GOARCH=arm64"}, nil, "sum_generic.go"},
+		{"purego", nil, []string{"-require-tag", "purego"}, "sum_generic.go"},
+		{"platforms", nil, []string{"-platforms", "linux/amd64,linux/arm64"}, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := runGenerator(t, cache, nil, test.env, append([]string{"-pkg", "example.com/sum", "-v", "v1.0.0", "-name", "sum", "-quiet", "-with-positions"}, test.args...)...)
+			if r.err != nil {
+				t.Fatalf("%v\n%s", r.err, r.stderr)
+			}
+			files := r.output(t)
+			count := make(map[string]int)
+			for _, e := range mapEntries(t, files, "Packages", "example.com/sum") {
+				count[e.key]++
+			}
+			want := []string{"BlockSize", "Impl", "Sum"}
+			if test.name != "purego" {
+				// sum.go doesn't require the tag
+				want = append(want, "Size")
+			}
+			for _, key := range want {
+				if count[key] != 1 {
+					t.Errorf("%s is bound %d times", key, count[key])
+				}
+			}
+			var out strings.Builder
+			for _, name := range sortedNames(files) {
+				out.WriteString(files[name])
+			}
+			for _, file := range []string{"sum_amd64.go", "sum_generic.go"} {
+				want := 0
+				if file == test.file {
+					want = 3
+				}
+				if got := strings.Count(out.String(), "defined at "+file); test.file != "" && got != want {
+					t.Errorf("%d symbols are defined at %s, want %d:\n%s", got, file, want, out.String())
+				}
+			}
+			if test.env == nil {
+				compile(t, files, "anko", cache, []string{"sum"})
+			}
+		})
+	}
+}
+
+// TestVariableAddresses checks which variables are registered by address,
+// and that the channel variables of both kinds carry the sends and receives
+// of scripts through the binding.
+func TestVariableAddresses(t *testing.T) {
+	cache := writeModule(t, "vars", map[string]string{
+		"vars.go": `package vars
+
+import "os"
+
+var Events = make(chan int, 1)
+
+var Late chan int
+
+func Open() { Late = make(chan int, 1) }
+
+var Hook func() string
+
+var Table [4]int
+
+var Home = os.Getenv("HOME")
+
+var Count = 1
+
+var Names = []string{"a"}
+`,
+	})
+	files := generate(t, cache, "vars", nil)
+	got := values(mapEntries(t, files, "Packages", "example.com/vars"))
+	for key, want := range map[string]string{
+		"Events": "reflect.ValueOf(vars.Events)",
+		"Late":   "reflect.ValueOf(&vars.Late)",
+		"Hook":   "reflect.ValueOf(&vars.Hook)",
+		"Table":  "reflect.ValueOf(&vars.Table)",
+		"Home":   "reflect.ValueOf(&vars.Home)",
+		"Count":  "reflect.ValueOf(vars.Count)",
+		"Names":  "reflect.ValueOf(vars.Names)",
+	} {
+		if got[key] != want {
+			t.Errorf("%s is registered as %q, want %q", key, got[key], want)
+		}
+	}
+
+	output := execute(t, files, "anko", cache, []string{"vars"}, `package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"example.com/vars"
+	"github.com/mattn/anko/env"
+
+	_ "consumer/packages"
+)
+
+func main() {
+	m := env.Packages["example.com/vars"]
+	// sent by the script, received by the program, and back
+	m["Events"].Send(reflect.ValueOf(1))
+	fmt.Println(<-vars.Events)
+	vars.Events <- 2
+	v, _ := m["Events"].Recv()
+	fmt.Println(v)
+	// assigned by the program after the registration
+	vars.Open()
+	m["Late"].Elem().Send(reflect.ValueOf(3))
+	fmt.Println(<-vars.Late)
+}
+`)
+	if want := "1\n2\n3\n"; output != want {
+		t.Errorf("the channels carry %q, want %q", output, want)
+	}
+}
+
+// TestNilFuncVariables checks that the function variables the program
+// assigns late, declared without initializer or initialized to nil, are
+// registered by address so scripts call the assigned function, also of
+// named function types of the package, while
+// initialized ones stay registered by value.
+func TestNilFuncVariables(t *testing.T) {
+	cache := writeModule(t, "hooks", map[string]string{
+		"hooks.go": `package hooks
+
+var OnStart func(name string) string
+
+var OnStop, OnError func() string = nil, func() string { return "error" }
+
+var Greet = func() string { return "hello" }
+
+type Handler func() string
+
+var Fallback Handler
+`,
+	})
+	files := generate(t, cache, "hooks", nil)
+	got := values(mapEntries(t, files, "Packages", "example.com/hooks"))
+	for key, want := range map[string]string{
+		"OnStart":  "reflect.ValueOf(&hooks.OnStart)",
+		"OnStop":   "reflect.ValueOf(&hooks.OnStop)",
+		"OnError":  "reflect.ValueOf(hooks.OnError)",
+		"Greet":    "reflect.ValueOf(hooks.Greet)",
+		"Fallback": "reflect.ValueOf(&hooks.Fallback)",
+	} {
+		if got[key] != want {
+			t.Errorf("%s is registered as %q, want %q", key, got[key], want)
+		}
+	}
+
+	output := execute(t, files, "anko", cache, []string{"hooks"}, `package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"example.com/hooks"
+	"github.com/mattn/anko/env"
+
+	_ "consumer/packages"
+)
+
+func main() {
+	m := env.Packages["example.com/hooks"]
+	// assigned by the program after the registration
+	hooks.OnStart = func(name string) string { return "start " + name }
+	hooks.OnStop = func() string { return "stop" }
+	hooks.Fallback = func() string { return "fallback" }
+	fmt.Println(m["OnStart"].Elem().Call([]reflect.Value{reflect.ValueOf("app")})[0])
+	fmt.Println(m["OnStop"].Elem().Call(nil)[0])
+	fmt.Println(m["OnError"].Call(nil)[0])
+	fmt.Println(m["Fallback"].Elem().Call(nil)[0])
+}
+`)
+	if want := "start app\nstop\nerror\nfallback\n"; output != want {
+		t.Errorf("the hooks return %q, want %q", output, want)
+	}
+}
+
+// TestCgoDetection checks that -no-cgo skips the files importing "C",
+// with or without preamble, alone or grouped, selecting their !cgo
+// fallbacks, and keeps the files importing a package named C of a module
+// or only mentioning import "C" in a comment.
+func TestCgoDetection(t *testing.T) {
+	cache := writeModule(t, "cgoish", map[string]string{
+		"preamble.go": `package cgoish
+
+// #include <stdlib.h>
+import "C"
+
+func Native() int { return int(C.abs(-1)) }
+`,
+		"grouped.go": `package cgoish
+
+import (
+	"unsafe"
+	"C"
+)
+
+func Pointer() unsafe.Pointer { return nil }
+`,
+		"fallback.go": `//go:build !cgo
+
+package cgoish
+
+func Portable() {}
+`,
+		"module.go": `package cgoish
+
+// Like cgo, this file has import "C" in a comment:
+// import "C"
+import "example.com/cgoish/C"
+
+var Shared = C.Value
+`,
+		"C/c.go": `package C
+
+var Value = 1
+`,
+	})
+	for _, tt := range []struct {
+		args   []string
+		keys   []string
+		absent []string
+	}{
+		{nil, []string{"Native", "Pointer", "Shared"}, []string{"Portable"}},
+		{[]string{"-no-cgo"}, []string{"Portable", "Shared"}, []string{"Native", "Pointer"}},
+	} {
+		r := runGenerator(t, cache, nil, []string{"CGO_ENABLED=1"}, append([]string{"-pkg", "example.com/cgoish", "-v", "v1.0.0", "-name", "cgoish", "-quiet"}, tt.args...)...)
+		if r.err != nil {
+			t.Fatalf("generating %v: %v\n%s", tt.args, r.err, r.stderr)
+		}
+		got := values(mapEntries(t, r.output(t), "Packages", "example.com/cgoish"))
+		for _, key := range tt.keys {
+			if _, ok := got[key]; !ok {
+				t.Errorf("%v: %s isn't exported", tt.args, key)
+			}
+		}
+		for _, key := range tt.absent {
+			if _, ok := got[key]; ok {
+				t.Errorf("%v: %s is exported", tt.args, key)
+			}
+		}
+	}
+}
+
+// TestComplexConstants checks that -skip-complex drops the complex
+// constants, untyped, typed or of a complex type of the package, literal or
+// computed, and keeps the others, which are all exported without it.
+func TestComplexConstants(t *testing.T) {
+	cache := writeModule(t, "phasors", map[string]string{
+		"phasors.go": `package phasors
+
+type Phasor complex128
+
+const (
+	I               = 1i
+	Unit  complex64 = 1
+	Root            = complex(0, 1)
+	Twice           = I * 2
+	Zero  Phasor    = 0
+	Real  float64   = 1.5
+	Count           = 3
+	Imag            = imag(Root)
+)
+`,
+	})
+	complexes := []string{"I", "Unit", "Root", "Twice", "Zero"}
+	for _, tt := range []struct {
+		args   []string
+		keys   []string
+		absent []string
+	}{
+		{nil, append([]string{"Real", "Count", "Imag"}, complexes...), nil},
+		{[]string{"-skip-complex"}, []string{"Real", "Count", "Imag"}, complexes},
+	} {
+		files := generate(t, cache, "phasors", nil, tt.args...)
+		got := values(mapEntries(t, files, "Packages", "example.com/phasors"))
+		for _, key := range tt.keys {
+			if _, ok := got[key]; !ok {
+				t.Errorf("%v: %s isn't exported", tt.args, key)
+			}
+		}
+		for _, key := range tt.absent {
+			if _, ok := got[key]; ok {
+				t.Errorf("%v: %s is exported", tt.args, key)
+			}
+		}
+		compile(t, files, "anko", cache, []string{"phasors"})
+	}
+}
+
+// TestArrayVariables checks that the fixed-size array variables, declared
+// with an array type, a named one or by a composite literal, are registered
+// by address so the writes of scripts to their elements reach the program,
+// unless -arrays-by-value, and that slices stay registered by value.
+func TestArrayVariables(t *testing.T) {
+	cache := writeModule(t, "tables", map[string]string{
+		"tables.go": `package tables
+
+const Size = 4
+
+type Row [Size]int
+
+var Table [256]byte
+
+var First Row
+
+var Grid = [2][2]int{}
+
+var Letters = [...]string{"a", "b"}
+
+var Slice = make([]int, 1)
+`,
+	})
+	for _, tt := range []struct {
+		args   []string
+		want   map[string]string
+		output string
+	}{
+		{nil, map[string]string{
+			"Table":   "reflect.ValueOf(&tables.Table)",
+			"First":   "reflect.ValueOf(&tables.First)",
+			"Grid":    "reflect.ValueOf(&tables.Grid)",
+			"Letters": "reflect.ValueOf(&tables.Letters)",
+			"Slice":   "reflect.ValueOf(tables.Slice)",
+		}, "7 8 9 c 1\n"},
+		{[]string{"-arrays-by-value"}, map[string]string{
+			"Table":   "reflect.ValueOf(tables.Table)",
+			"First":   "reflect.ValueOf(tables.First)",
+			"Grid":    "reflect.ValueOf(tables.Grid)",
+			"Letters": "reflect.ValueOf(tables.Letters)",
+			"Slice":   "reflect.ValueOf(tables.Slice)",
+		}, "0 0 0 a 1\n"},
+	} {
+		files := generate(t, cache, "tables", nil, tt.args...)
+		got := values(mapEntries(t, files, "Packages", "example.com/tables"))
+		for key, want := range tt.want {
+			if got[key] != want {
+				t.Errorf("%v: %s is registered as %q, want %q", tt.args, key, got[key], want)
+			}
+		}
+
+		output := execute(t, files, "anko", cache, []string{"tables"}, `package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"example.com/tables"
+	"github.com/mattn/anko/env"
+
+	_ "consumer/packages"
+)
+
+// set assigns x to the element i of the array or slice v, like a script
+// does, if it's addressable.
+func set(v reflect.Value, x interface{}, i ...int) {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	for _, i := range i {
+		v = v.Index(i)
+	}
+	if v.CanSet() {
+		v.Set(reflect.ValueOf(x).Convert(v.Type()))
+	}
+}
+
+func main() {
+	m := env.Packages["example.com/tables"]
+	set(m["Table"], 7, 0)
+	set(m["First"], 8, 3)
+	set(m["Grid"], 9, 1, 1)
+	set(m["Letters"], "c", 0)
+	set(m["Slice"], 1, 0)
+	fmt.Println(tables.Table[0], tables.First[3], tables.Grid[1][1], tables.Letters[0], tables.Slice[0])
+}
+`)
+		if output != tt.output {
+			t.Errorf("%v: the program sees %q, want %q", tt.args, output, tt.output)
+		}
+	}
+}
+
+// TestUnexportedConstantTypes checks that the constants of an unexported
+// type are bound, read by scripts with their type, and warned about since
+// scripts can't name it, unlike the constants of exported or predeclared
+// types.
+func TestUnexportedConstantTypes(t *testing.T) {
+	cache := writeModule(t, "modes", map[string]string{
+		"modes.go": `package modes
+
+type mode int
+
+const (
+	ReadOnly mode = iota
+	ReadWrite
+)
+
+type state string
+
+const Idle state = "idle"
+
+type Level int
+
+const Debug Level = 1
+
+const Plain int = 2
+`,
+	})
+	r := runGenerator(t, cache, nil, nil, "-pkg", "example.com/modes", "-v", "v1.0.0", "-name", "modes")
+	if r.err != nil {
+		t.Fatalf("generating: %v\n%s", r.err, r.stderr)
+	}
+	for _, tt := range []struct {
+		name, typ string
+		warned    bool
+	}{
+		{"ReadOnly", "mode", true},
+		{"ReadWrite", "mode", true},
+		{"Idle", "state", true},
+		{"Debug", "Level", false},
+		{"Plain", "int", false},
+	} {
+		warning := fmt.Sprintf("warning: example.com/modes: constant %s has the unexported type %s, which scripts can't name", tt.name, tt.typ)
+		if strings.Contains(r.stderr, warning) != tt.warned {
+			t.Errorf("%s: warned %v, want %v:\n%s", tt.name, !tt.warned, tt.warned, r.stderr)
+		}
+	}
+
+	files := r.output(t)
+	output := execute(t, files, "anko", cache, []string{"modes"}, `package main
+
+import (
+	"fmt"
+
+	"github.com/mattn/anko/env"
+
+	_ "consumer/packages"
+)
+
+func main() {
+	m := env.Packages["example.com/modes"]
+	for _, name := range []string{"ReadOnly", "ReadWrite", "Idle", "Debug"} {
+		fmt.Println(name, m[name].Type(), m[name].Interface())
+	}
+}
+`)
+	want := "ReadOnly modes.mode 0\nReadWrite modes.mode 1\nIdle modes.state idle\nDebug modes.Level 1\n"
+	if output != want {
+		t.Errorf("the constants read as %q, want %q", output, want)
+	}
+}
+
+// TestVariadicAny checks that -skip-variadic-any drops the functions like
+// fmt.Println, whose last param is ...any or ...interface{}, and keeps the
+// other variadic functions and the ones taking a single interface{}.
+func TestVariadicAny(t *testing.T) {
+	cache := writeModule(t, "printer", map[string]string{
+		"printer.go": `package printer
+
+import "io"
+
+func Println(a ...any) (n int, err error) { return 0, nil }
+
+func Printf(format string, a ...interface{}) (n int, err error) { return 0, nil }
+
+func Fprint(w io.Writer, a ...any) (n int, err error) { return 0, nil }
+
+func Join(sep string, parts ...string) string { return "" }
+
+func Show(v interface{}) {}
+
+func Stringers(s ...interface{ String() string }) {}
+
+func Lists(lists ...[]any) {}
+`,
+	})
+	for _, args := range [][]string{nil, {"-skip-variadic-any"}} {
+		got := values(mapEntries(t, generate(t, cache, "printer", nil, args...), "Packages", "example.com/printer"))
+		for name, variadicAny := range map[string]bool{
+			"Println":   true,
+			"Printf":    true,
+			"Fprint":    true,
+			"Join":      false,
+			"Show":      false,
+			"Stringers": false,
+			"Lists":     false,
+		} {
+			want := !variadicAny || args == nil
+			if _, ok := got[name]; ok != want {
+				t.Errorf("%v: %s exported %v, want %v", args, name, ok, want)
+			}
+		}
+	}
+}
+
+// TestMethodValueVariables checks that -classify-vars moves the variables
+// holding a method value, of an exported or unexported variable, or a
+// method expression to the functions, like the ones holding an imported
+// function, keeping a field read a variable, and that scripts call them
+// through the binding.
+func TestMethodValueVariables(t *testing.T) {
+	cache := writeModule(t, "counter", map[string]string{
+		"counter.go": `package counter
+
+import "encoding/json"
+
+type Counter struct {
+	Name string
+	n    int
+}
+
+func (c *Counter) Inc() int { c.n++; return c.n }
+
+func (c Counter) Label() string { return "counter " + c.Name }
+
+var Default = &Counter{Name: "default"}
+
+var hidden = &Counter{Name: "hidden"}
+
+var Inc = Default.Inc
+
+var Label = Default.Label
+
+var Hidden = hidden.Inc
+
+var IncOf = (*Counter).Inc
+
+var LabelOf = Counter.Label
+
+var DefaultMarshal = json.Marshal
+
+var Name = Default.Name
+`,
+	})
+	files := generate(t, cache, "counter", nil, "-classify-vars")
+	groups := make(map[string]string)
+	for _, e := range mapEntries(t, files, "Packages", "example.com/counter") {
+		groups[e.key] = e.group
+	}
+	for key, want := range map[string]string{
+		"Inc":            "functions",
+		"Label":          "functions",
+		"Hidden":         "functions",
+		"IncOf":          "functions",
+		"LabelOf":        "functions",
+		"DefaultMarshal": "functions",
+		"Default":        "variables",
+		"Name":           "variables",
+	} {
+		if groups[key] != want {
+			t.Errorf("%s is in the %q section, want %q", key, groups[key], want)
+		}
+	}
+
+	output := execute(t, files, "anko", cache, []string{"counter"}, `package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"example.com/counter"
+	"github.com/mattn/anko/env"
+
+	_ "consumer/packages"
+)
+
+func main() {
+	m := env.Packages["example.com/counter"]
+	call := func(name string, args ...interface{}) interface{} {
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			in[i] = reflect.ValueOf(arg)
+		}
+		return m[name].Call(in)[0].Interface()
+	}
+	fmt.Println(call("Inc"), call("Inc"), call("Hidden"), call("IncOf", counter.Default))
+	fmt.Println(call("Label"), call("LabelOf", counter.Counter{Name: "other"}))
+	fmt.Println(string(call("DefaultMarshal", []int{1}).([]byte)))
+}
+`)
+	if want := "1 2 1 3\ncounter default counter other\n[1]\n"; output != want {
+		t.Errorf("the methods return %q, want %q", output, want)
+	}
+}
+
+// TestCgoTypes checks that the functions and variables of a cgo file whose
+// type uses a C type, declared or given by the initializer, are skipped,
+// as go/parser doesn't see the preamble declaring them, and the others of
+// the file are exported.
+func TestCgoTypes(t *testing.T) {
+	cache := writeModule(t, "clib", map[string]string{
+		"clib.go": `package clib
+
+// #include <stdlib.h>
+// #include <unistd.h>
+// typedef struct conn conn;
+import "C"
+
+import "unsafe"
+
+type Conn struct{ p *C.conn }
+
+func Dial(addr string) *Conn { return nil }
+
+func Abs(x C.int) C.int { return C.abs(x) }
+
+func Raw() *C.conn { return nil }
+
+func Free(p unsafe.Pointer) { C.free(p) }
+
+func Pid() int { return int(C.getpid()) }
+
+var Last C.int
+
+var Zero = C.int(0)
+
+var Self = C.getpid()
+
+var Callback func(code C.int)
+
+var Ready = true
+
+var Size = int(C.sizeof_int)
+`,
+	})
+	r := runGenerator(t, cache, nil, []string{"CGO_ENABLED=1"}, "-pkg", "example.com/clib", "-v", "v1.0.0", "-name", "clib", "-quiet")
+	if r.err != nil {
+		t.Fatalf("generating: %v\n%s", r.err, r.stderr)
+	}
+	files := r.output(t)
+	got := values(mapEntries(t, files, "Packages", "example.com/clib"))
+	for name, want := range map[string]bool{
+		"Dial":     true,
+		"Free":     true,
+		"Pid":      true,
+		"Ready":    true,
+		"Size":     true,
+		"Abs":      false,
+		"Raw":      false,
+		"Last":     false,
+		"Zero":     false,
+		"Self":     false,
+		"Callback": false,
+	} {
+		if _, ok := got[name]; ok != want {
+			t.Errorf("%s exported %v, want %v", name, ok, want)
+		}
+	}
+	if _, ok := values(mapEntries(t, files, "PackageTypes", "example.com/clib"))["Conn"]; !ok {
+		t.Error("Conn, with an unexported C field, isn't exported")
+	}
+	if strings.Contains(files["clib.go"], "C.") {
+		t.Errorf("the generated file refers to C:\n%s", files["clib.go"])
+	}
+}
+
+// TestKinds checks that -kinds exports exactly the selected kinds of
+// symbols, for each combination of them, and rejects an unknown one.
+func TestKinds(t *testing.T) {
+	cache := writeModule(t, "records", map[string]string{
+		"records.go": `package records
+
+const Version = "1.0"
+
+var Default = Record{}
+
+type Record struct{ ID int }
+
+func New(id int) Record { return Record{id} }
+`,
+	})
+	all := []string{"const", "var", "type", "func"}
+	symbols := map[string]string{"const": "Version", "var": "Default", "type": "Record", "func": "New"}
+	for mask := 1; mask < 1<<len(all); mask++ {
+		var selected []string
+		for i, kind := range all {
+			if mask&(1<<i) != 0 {
+				selected = append(selected, kind)
+			}
+		}
+		arg := strings.Join(selected, ",")
+		files := generate(t, cache, "records", nil, "-kinds", arg)
+		entries := append(mapEntries(t, files, "Packages", "example.com/records"), mapEntries(t, files, "PackageTypes", "example.com/records")...)
+		got := values(entries)
+		for _, kind := range all {
+			if _, ok := got[symbols[kind]]; ok != contains(selected, kind) {
+				t.Errorf("-kinds %s: %s %s exported %v", arg, kind, symbols[kind], ok)
+			}
+		}
+		if len(got) != len(selected) {
+			t.Errorf("-kinds %s: exported %v, want only %v", arg, keys(entries), selected)
+		}
+	}
+
+	for _, arg := range []string{"", "const,method", "funcs"} {
+		r := runGenerator(t, cache, nil, nil, "-pkg", "example.com/records", "-v", "v1.0.0", "-name", "records", "-quiet", "-kinds", arg)
+		if r.err == nil || !strings.Contains(r.stderr, "Invalid argument: kinds must list const, var, type or func") {
+			t.Errorf("-kinds %q: %v, want a usage error:\n%s", arg, r.err, r.stderr)
+		}
+	}
+}
+
+// TestEnvironmentVariables checks that the variables computed from the
+// environment, by a call in their initializer or of one of its results, are
+// registered by address, so scripts read the value the program reassigns,
+// unless -env-vars-by-value, and the other variables by value.
+func TestEnvironmentVariables(t *testing.T) {
+	cache := writeModule(t, "settings", map[string]string{
+		"settings.go": `package settings
+
+import (
+	sys "os"
+	"runtime"
+	"strings"
+)
+
+var Home = sys.Getenv("HOME")
+
+var Path = strings.Split(sys.Getenv("PATH"), ":")
+
+var Workers = runtime.NumCPU() * 2
+
+var Host, _ = sys.Hostname()
+
+var Lookup = func() string { return sys.Getenv("USER") }
+
+var Name = "fixed"
+
+// Reload reads the environment again.
+func Reload() { Home = "/reloaded" }
+`,
+	})
+	for _, tt := range []struct {
+		args   []string
+		addr   []string
+		output string
+	}{
+		{nil, []string{"Home", "Path", "Workers", "Host"}, "true false\n"},
+		{[]string{"-env-vars-by-value"}, nil, "false true\n"},
+	} {
+		files := generate(t, cache, "settings", nil, tt.args...)
+		got := values(mapEntries(t, files, "Packages", "example.com/settings"))
+		for _, key := range []string{"Home", "Path", "Workers", "Host", "Name"} {
+			want := "reflect.ValueOf(settings." + key + ")"
+			if contains(tt.addr, key) {
+				want = "reflect.ValueOf(&settings." + key + ")"
+			}
+			if got[key] != want {
+				t.Errorf("%v: %s is registered as %q, want %q", tt.args, key, got[key], want)
+			}
+		}
+
+		output := execute(t, files, "anko", cache, []string{"settings"}, `package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"example.com/settings"
+	"github.com/mattn/anko/env"
+
+	_ "consumer/packages"
+)
+
+func main() {
+	initial := settings.Home
+	settings.Reload()
+	home := env.Packages["example.com/settings"]["Home"]
+	if home.Kind() == reflect.Ptr {
+		home = home.Elem()
+	}
+	// reloaded, or still the value at init
+	fmt.Println(home.String() == settings.Home, home.String() == initial)
+}
+`)
+		if output != tt.output {
+			t.Errorf("%v: scripts read Home as %q, want %q", tt.args, output, tt.output)
+		}
+	}
+}
+
+// TestShardedInits checks that, with -shard, the init functions of the
+// packages of a module and of the shard files are all unique, when packages
+// under different paths share a name, derive the same init suffix, or one
+// derived from a shard file.
+func TestShardedInits(t *testing.T) {
+	cache := writeModule(t, "mix", map[string]string{
+		"a/util/util.go":  "package util\n\nfunc A() {}\n\nfunc Z() {}\n",
+		"b/util/util.go":  "package util\n\nfunc B() {}\n\nfunc Y() {}\n",
+		"shard2/shard.go": "package shard2\n\nfunc C() {}\n\nfunc X() {}\n",
+		"x/y-z/yz.go":     "package yz\n\nfunc D() {}\n\nfunc W() {}\n",
+		"x/y/z/z.go":      "package z\n\nfunc E() {}\n\nfunc V() {}\n",
+	})
+	for _, shards := range []string{"2", "3"} {
+		files := generate(t, cache, "mix", nil, "-shard", shards)
+		decls := make(map[string]string)
+		for _, name := range sortedNames(files) {
+			for _, m := range regexp.MustCompile(`(?m)^func (init\w+)\(\)`).FindAllStringSubmatch(files[name], -1) {
+				if other, ok := decls[m[1]]; ok {
+					t.Errorf("-shard %s: %s is declared by %s and %s", shards, m[1], other, name)
+				}
+				decls[m[1]] = name
+			}
+		}
+		for _, path := range []string{"a/util", "b/util", "shard2", "x/y-z", "x/y/z"} {
+			if len(mapEntries(t, files, "Packages", "example.com/mix/"+path)) != 2 {
+				t.Errorf("-shard %s: example.com/mix/%s doesn't export its 2 functions", shards, path)
+			}
+		}
+		compile(t, files, "anko", cache, []string{"mix"})
+	}
+}
+
+// TestMismatchedPackageNames checks that the packages named unlike their
+// path are imported under an alias, also told apart when they share a name,
+// and that every entry refers to each package by the identifier its import
+// declares.
+func TestMismatchedPackageNames(t *testing.T) {
+	cache := writeModule(t, "kit", map[string]string{
+		"go-shapes/shapes.go": `package shapes
+
+type Kind int
+
+const Round Kind = 1
+
+type Circle struct{ R float64 }
+
+func New() Circle { return Circle{} }
+
+var Unit = Circle{R: 1}
+`,
+		"other/shapes/shapes.go": "package shapes\n\ntype Box struct{}\n\nfunc Square() Box { return Box{} }\n",
+		"yaml.v3/yaml.go":        "package yaml\n\nfunc Marshal(v interface{}) ([]byte, error) { return nil, nil }\n",
+		"api/v2/api.go":          "package api\n\nfunc Call() {}\n",
+		"plain/plain.go":         "package plain\n\nfunc Do() {}\n",
+	})
+	files := generate(t, cache, "kit", nil)
+	file, err := parser.ParseFile(token.NewFileSet(), "kit.go", files["kit.go"], parser.ImportsOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported := make(map[string]string)
+	aliased := make(map[string]bool)
+	for _, spec := range file.Imports {
+		path := unquote(spec.Path)
+		// the last element, but a major version
+		name := regexp.MustCompile(`([^/]+)(/v[1-9][0-9]*)?$`).FindStringSubmatch(path)[1]
+		if spec.Name != nil {
+			name = spec.Name.Name
+			aliased[path] = true
+		}
+		imported[name] = path
+	}
+	qualifier := regexp.MustCompile(`\b([A-Za-z_]\w*)\.[A-Z]`)
+	for _, tt := range []struct {
+		path    string
+		aliased bool
+	}{
+		{"example.com/kit/go-shapes", true},
+		{"example.com/kit/other/shapes", true},
+		{"example.com/kit/yaml.v3", true},
+		{"example.com/kit/api/v2", false},
+		{"example.com/kit/plain", false},
+	} {
+		if aliased[tt.path] != tt.aliased {
+			t.Errorf("%s imported with an alias %v, want %v", tt.path, aliased[tt.path], tt.aliased)
+		}
+		entries := append(mapEntries(t, files, "Packages", tt.path), mapEntries(t, files, "PackageTypes", tt.path)...)
+		if len(entries) == 0 {
+			t.Errorf("%s isn't exported", tt.path)
+		}
+		for _, e := range entries {
+			for _, m := range qualifier.FindAllStringSubmatch(e.value, -1) {
+				if m[1] != "reflect" && imported[m[1]] != tt.path {
+					t.Errorf("%s: %s refers to %s, imported as %s", tt.path, e.key, m[1], imported[m[1]])
+				}
+			}
+		}
+	}
+	compile(t, files, "anko", cache, []string{"kit"})
+}
+
+// TestGenericAliases checks that the aliases of instantiations of generic
+// types, exported or not, are registered as working types while the generic
+// types are skipped, with the methods of the generic type for
+// -pointer-types.
+func TestGenericAliases(t *testing.T) {
+	cache := writeModule(t, "stores", map[string]string{
+		"stores.go": `package stores
+
+type store[K comparable, V any] struct {
+	items map[K]V
+	Size  int
+}
+
+func (s *store[K, V]) Put(k K, v V) { s.items[k] = v; s.Size++ }
+
+func (s *store[K, V]) Get(k K) V { return s.items[k] }
+
+type Strings = store[string, string]
+
+func NewStrings() *Strings { return &Strings{items: make(map[string]string)} }
+
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+type IntPair = Pair[int, int]
+
+type mixed = Pair[int, string]
+`,
+	})
+	files := generate(t, cache, "stores", nil, "-pointer-types")
+	if got, want := keys(mapEntries(t, files, "PackageTypes", "example.com/stores")), []string{"IntPair", "Strings", "StringsPtr"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("the types are %v, want %v", got, want)
+	}
+
+	output := execute(t, files, "anko", cache, []string{"stores"}, `package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mattn/anko/env"
+
+	_ "consumer/packages"
+)
+
+func main() {
+	m, types := env.Packages["example.com/stores"], env.PackageTypes["example.com/stores"]
+	s := m["NewStrings"].Call(nil)[0]
+	fmt.Println(s.Type() == types["StringsPtr"], s.Elem().Type() == types["Strings"])
+	s.MethodByName("Put").Call([]reflect.Value{reflect.ValueOf("k"), reflect.ValueOf("v")})
+	fmt.Println(s.MethodByName("Get").Call([]reflect.Value{reflect.ValueOf("k")})[0], s.Elem().FieldByName("Size"))
+	p := reflect.New(types["IntPair"]).Elem()
+	p.FieldByName("First").SetInt(3)
+	fmt.Println(p.Interface())
+}
+`)
+	if want := "true true\nv 1\n{3 0}\n"; output != want {
+		t.Errorf("the aliases work as %q, want %q", output, want)
+	}
+}
+
+// TestGroupDeprecation checks that a "Deprecated:" paragraph on a grouped
+// declaration drops every spec of the group, and one on a spec only that
+// spec, like godoc reads them, for constants, variables and types.
+func TestGroupDeprecation(t *testing.T) {
+	cache := writeModule(t, "deprec", map[string]string{
+		"deprec.go": `package deprec
+
+// Deprecated: use the constants of the other block.
+const (
+	OldA = 1
+	OldB = 2
+)
+
+const (
+	// Deprecated: use KeptA.
+	GoneA = 1
+	KeptA = 2 // Deprecated: a line comment isn't documentation.
+)
+
+// Deprecated: use the variables of the other block.
+var (
+	OldVar  = 1
+	OldVar2 = 2
+)
+
+var (
+	// Deprecated: use KeptVar.
+	GoneVar = 1
+	KeptVar = 2
+)
+
+// Deprecated: use the types of the other block.
+type (
+	OldT struct{}
+	OldU int
+)
+
+type (
+	// Deprecated: use KeptT.
+	GoneT struct{}
+	KeptT struct{}
+)
+`,
+	})
+	for _, test := range []struct {
+		args       []string
+		m          string
+		values     []string
+		types      []string
+		deprecated bool
+	}{
+		{nil, "Packages", []string{"KeptA", "KeptVar"}, []string{"KeptT"}, false},
+		{[]string{"-emit-deprecated-separately"}, "DeprecatedPackages", []string{"GoneA", "OldA", "OldB", "GoneVar", "OldVar", "OldVar2"}, []string{"GoneT", "OldT", "OldU"}, true},
+	} {
+		files := generate(t, cache, "deprec", nil, test.args...)
+		if got := keys(mapEntries(t, files, test.m, "example.com/deprec")); strings.Join(got, ",") != strings.Join(test.values, ",") {
+			t.Errorf("%s: env.%s holds %v, want %v", strings.Join(test.args, " "), test.m, got, test.values)
+		}
+		types := strings.TrimSuffix(test.m, "s") + "Types"
+		if got := keys(mapEntries(t, files, types, "example.com/deprec")); strings.Join(got, ",") != strings.Join(test.types, ",") {
+			t.Errorf("%s: env.%s holds %v, want %v", strings.Join(test.args, " "), types, got, test.types)
+		}
+		if test.deprecated {
+			if got := keys(mapEntries(t, files, "Packages", "example.com/deprec")); strings.Join(got, ",") != "KeptA,KeptVar" {
+				t.Errorf("%s: env.Packages holds %v", strings.Join(test.args, " "), got)
+			}
+		}
+	}
+}
+
+// TestTypeSpecDeprecation checks that the "Deprecated:" paragraph of one
+// spec of a type block, after its description, only drops that type, while
+// the block's own documentation doesn't deprecate any.
+func TestTypeSpecDeprecation(t *testing.T) {
+	cache := writeModule(t, "shapes", map[string]string{
+		"shapes.go": `package shapes
+
+// Shapes of the package.
+type (
+	// Circle is round.
+	//
+	// Deprecated: use Ellipse.
+	Circle struct{ R float64 }
+	// Ellipse is round too.
+	Ellipse struct{ A, B float64 }
+	Square  struct{ Side float64 }
+)
+
+func Area(e Ellipse) float64 { return e.A * e.B }
+`,
+	})
+	for _, test := range []struct {
+		args []string
+		want map[string][]string
+	}{
+		{nil, map[string][]string{"PackageTypes": {"Ellipse", "Square"}}},
+		{[]string{"-stability", "all"}, map[string][]string{"PackageTypes": {"Circle", "Ellipse", "Square"}}},
+		{[]string{"-emit-deprecated-separately"}, map[string][]string{"PackageTypes": {"Ellipse", "Square"}, "DeprecatedPackageTypes": {"Circle"}}},
+	} {
+		files := generate(t, cache, "shapes", nil, test.args...)
+		for m, want := range test.want {
+			if got := keys(mapEntries(t, files, m, "example.com/shapes")); strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("%s: env.%s holds %v, want %v", strings.Join(test.args, " "), m, got, want)
+			}
+		}
+		if got := keys(mapEntries(t, files, "Packages", "example.com/shapes")); strings.Join(got, ",") != "Area" {
+			t.Errorf("%s: env.Packages holds %v, want Area", strings.Join(test.args, " "), got)
+		}
+		compile(t, files, "anko", cache, []string{"shapes"})
+	}
+}
+
+// TestVariadicSignatures checks that the element type of a variadic param
+// of the package's own type is rendered by -with-docs and checked by
+// -strict-signatures like the type of any other param: a deprecated one is
+// kept for the function, an uninstantiated generic one drops it.
+func TestVariadicSignatures(t *testing.T) {
+	cache := writeModule(t, "joiner", map[string]string{
+		"joiner.go": `package joiner
+
+type Element struct{ Name string }
+
+type element struct{}
+
+// Deprecated: use Element.
+type Old struct{}
+
+func Join(elems ...Element) string { return "" }
+
+func JoinPointers(sep string, elems ...*Element) int { return len(elems) }
+
+func Nested(groups ...[]Element) {}
+
+func Hidden(elems ...element) {}
+
+func Legacy(olds ...Old) {}
+
+type Box[T any] struct{ V T }
+
+func Unbox(boxes ...Box[int]) {}
+`,
+	})
+	all := []string{"Hidden", "Join", "JoinPointers", "Legacy", "Nested", "Unbox"}
+	for _, test := range []struct {
+		args []string
+		want []string
+		docs map[string]string
+	}{
+		{nil, all, nil},
+		{[]string{"-strict-signatures"}, []string{"Join", "JoinPointers", "Legacy", "Nested"}, nil},
+		{[]string{"-with-docs"}, all, map[string]string{
+			"Join":         "func Join(elems ...Element) string",
+			"JoinPointers": "func JoinPointers(sep string, elems ...*Element) int",
+			"Nested":       "func Nested(groups ...[]Element)",
+			"Hidden":       "func Hidden(elems ...element)",
+		}},
+	} {
+		files := generate(t, cache, "joiner", nil, test.args...)
+		if got := keys(mapEntries(t, files, "Packages", "example.com/joiner")); strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("%s: env.Packages holds %v, want %v", strings.Join(test.args, " "), got, test.want)
+		}
+		// kept for Legacy, which scripts couldn't call otherwise
+		if got := keys(mapEntries(t, files, "PackageTypes", "example.com/joiner")); strings.Join(got, ",") != "Element,Old" {
+			t.Errorf("%s: env.PackageTypes holds %v, want Element and Old", strings.Join(test.args, " "), got)
+		}
+		for key, doc := range test.docs {
+			if entry := "// " + doc + "\n\t\t" + strconv.Quote(key) + ":"; !strings.Contains(files["joiner.go"], entry) {
+				t.Errorf("%s: %s isn't documented as %q:\n%s", strings.Join(test.args, " "), key, doc, files["joiner.go"])
+			}
+		}
+		compile(t, files, "anko", cache, []string{"joiner"})
+	}
+}
+
+// TestFilelessPackages checks that a directory only holding _test.go,
+// example_ and fuzz.go files is skipped cleanly, whether its packages are
+// left out or kept without files.
+func TestFilelessPackages(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		packages map[string]*ast.Package
+		want     string
+	}{
+		{"none", map[string]*ast.Package{}, ""},
+		{"empty", map[string]*ast.Package{"only": {Name: "only", Files: map[string]*ast.File{}}}, ""},
+		{"nil files", map[string]*ast.Package{"only": {Name: "only"}}, ""},
+		{"empty and main", map[string]*ast.Package{
+			"only": {Name: "only", Files: map[string]*ast.File{}},
+			"main": {Name: "main", Files: map[string]*ast.File{"main.go": {}}},
+		}, ""},
+		{"empty and other", map[string]*ast.Package{
+			"only":  {Name: "only", Files: map[string]*ast.File{}},
+			"other": {Name: "other", Files: map[string]*ast.File{"other.go": {}}},
+		}, "other"},
+	} {
+		if got := getPackageName(test.packages); got != test.want {
+			t.Errorf("%s: getPackageName = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	cache := writeModule(t, "fileless", map[string]string{
+		"fileless.go":               "package fileless\n\nfunc Kept() {}\n",
+		"only/only_test.go":         "package only\n\nfunc Test() {}\n",
+		"only/example_only_test.go": "package only_test\n\nfunc Example() {}\n",
+		"only/example_usage.go":     "package only\n\nfunc Usage() {}\n",
+		"only/fuzz.go":              "package only\n\nfunc Fuzz(b []byte) int { return 0 }\n",
+	})
+	r := runGenerator(t, cache, nil, nil, "-pkg", "example.com/fileless", "-v", "v1.0.0", "-name", "fileless")
+	if r.err != nil {
+		t.Fatalf("%v\n%s", r.err, r.stderr)
+	}
+	files := r.output(t)
+	if got := keys(mapEntries(t, files, "Packages", "example.com/fileless")); strings.Join(got, ",") != "Kept" {
+		t.Errorf("example.com/fileless holds %v, want Kept", got)
+	}
+	if strings.Contains(files["fileless.go"], "example.com/fileless/only") {
+		t.Errorf("example.com/fileless/only is generated:\n%s", files["fileless.go"])
+	}
+}
+
+// TestConstantTypeInheritance checks that the constants of a block
+// repeating a typed spec, like Green and Blue after `Red Color = iota`, are
+// of its type for -group-constants and at runtime, while the ones
+// repeating an untyped spec stay untyped.
+func TestConstantTypeInheritance(t *testing.T) {
+	cache := writeModule(t, "colors", map[string]string{
+		"colors.go": `package colors
+
+type Color int
+
+const (
+	Red Color = iota
+	Green
+	Blue
+)
+
+type Size int64
+
+const (
+	Small Size = 1 << iota
+	Large
+	Max = Size(1 << 20)
+	Over
+)
+
+const (
+	D = 5
+	E
+)
+`,
+	})
+	files := generate(t, cache, "colors", nil, "-group-constants")
+	groups := make(map[string]string)
+	for _, e := range mapEntries(t, files, "Packages", "example.com/colors") {
+		groups[e.key] = e.group
+	}
+	for key, want := range map[string]string{
+		"Red":   "constants of type Color",
+		"Green": "constants of type Color",
+		"Blue":  "constants of type Color",
+		"Small": "constants of type Size",
+		"Large": "constants of type Size",
+		// converted, but with no type of their spec
+		"Max":  "constants",
+		"Over": "constants",
+		"D":    "constants",
+		"E":    "constants",
+	} {
+		if groups[key] != want {
+			t.Errorf("%s is in group %q, want %q", key, groups[key], want)
+		}
+	}
+
+	output := execute(t, files, "anko", cache, []string{"colors"}, `package main
+
+import (
+	"fmt"
+
+	"github.com/mattn/anko/env"
+
+	_ "consumer/packages"
+)
+
+func main() {
+	for _, key := range []string{"Red", "Green", "Blue", "Small", "Large", "Max", "Over", "D", "E"} {
+		fmt.Println(key, env.Packages["example.com/colors"][key].Type())
+	}
+}
+`)
+	want := "Red colors.Color\nGreen colors.Color\nBlue colors.Color\nSmall colors.Size\nLarge colors.Size\nMax colors.Size\nOver colors.Size\nD int\nE int\n"
+	if output != want {
+		t.Errorf("the constants are of types:\n%swant:\n%s", output, want)
+	}
+}
+
+// TestEmbeddedInstantiations checks that the structs embedding or holding
+// instantiations of generic types are bound like any struct, the generic
+// types themselves aside.
+func TestEmbeddedInstantiations(t *testing.T) {
+	cache := writeModule(t, "embed", map[string]string{
+		"embed.go": `package embed
+
+type cache[K comparable] struct{ m map[K]int }
+
+type Store[T any] struct{ items []T }
+
+func (s *Store[T]) Len() int { return len(s.items) }
+
+type Names struct {
+	cache[string]
+}
+
+type Users struct {
+	*Store[string]
+	Limit int
+}
+
+type Pairs struct {
+	Left, Right Store[int]
+	byKey       map[string]Store[bool]
+}
+
+type Matrix [2][2]Store[float64]
+`,
+	})
+	files := generate(t, cache, "embed", nil)
+	if got := keys(mapEntries(t, files, "PackageTypes", "example.com/embed")); strings.Join(got, ",") != "Matrix,Names,Pairs,Users" {
+		t.Errorf("env.PackageTypes holds %v, want Matrix, Names, Pairs and Users", got)
+	}
+	output := execute(t, files, "anko", cache, []string{"embed"}, `package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mattn/anko/env"
+
+	_ "consumer/packages"
+)
+
+func main() {
+	types := env.PackageTypes["example.com/embed"]
+	users := reflect.New(types["Users"]).Elem()
+	fmt.Println(users.Field(0).Type(), users.NumMethod() == 0, reflect.PtrTo(types["Users"]).NumMethod())
+	fmt.Println(types["Names"].Field(0).Type, types["Pairs"].NumField(), types["Matrix"].Elem().Elem())
+}
+`)
+	want := "*embed.Store[string] false 1\nembed.cache[string] 3 embed.Store[float64]\n"
+	if output != want {
+		t.Errorf("the types are:\n%swant:\n%s", output, want)
+	}
+}
+
+// TestCompositeTypes checks that the named types defined as a map with
+// function values, and the other composite types, are registered, with
+// their definition written above them by -with-docs.
+func TestCompositeTypes(t *testing.T) {
+	cache := writeModule(t, "dispatch", map[string]string{
+		"dispatch.go": `package dispatch
+
+type Dispatch map[string]func()
+
+type Handlers map[string]func(args ...string) (int, error)
+
+type Queue chan<- Dispatch
+
+type Table [4][]Handlers
+
+type Route = map[string]Dispatch
+
+type Server struct{ Routes Dispatch }
+`,
+	})
+	docs := map[string]string{
+		"Dispatch": "type Dispatch map[string]func()",
+		"Handlers": "type Handlers map[string]func(args ...string) (int, error)",
+		"Queue":    "type Queue chan<- Dispatch",
+		"Table":    "type Table [4][]Handlers",
+		"Route":    "type Route = map[string]Dispatch",
+	}
+	for _, args := range [][]string{nil, {"-with-docs"}} {
+		files := generate(t, cache, "dispatch", nil, args...)
+		if got := keys(mapEntries(t, files, "PackageTypes", "example.com/dispatch")); strings.Join(got, ",") != "Dispatch,Handlers,Queue,Route,Server,Table" {
+			t.Errorf("%s: env.PackageTypes holds %v", strings.Join(args, " "), got)
+		}
+		src := files["dispatch.go"]
+		for key, doc := range docs {
+			if got := strings.Contains(src, "// "+doc+"\n\t\t"+strconv.Quote(key)+":"); got != (args != nil) {
+				t.Errorf("%s: %s documented as %q = %v:\n%s", strings.Join(args, " "), key, doc, got, src)
+			}
+		}
+		if strings.Contains(src, "// type Server") {
+			t.Errorf("%s: the struct Server is documented:\n%s", strings.Join(args, " "), src)
+		}
+		output := execute(t, files, "anko", cache, []string{"dispatch"}, `package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mattn/anko/env"
+
+	_ "consumer/packages"
+)
+
+func main() {
+	// built by a script from the registered type
+	typ := env.PackageTypes["example.com/dispatch"]["Dispatch"]
+	m := reflect.MakeMap(typ)
+	called := false
+	m.SetMapIndex(reflect.ValueOf("run"), reflect.ValueOf(func() { called = true }))
+	m.MapIndex(reflect.ValueOf("run")).Call(nil)
+	fmt.Println(typ, typ.Elem(), called)
+}
+`)
+		if want := "dispatch.Dispatch func() true\n"; output != want {
+			t.Errorf("%s: the Dispatch built by a script is %q, want %q", strings.Join(args, " "), output, want)
+		}
+	}
+}
+
+// TestGenericPackages checks that the constants and variables of a package
+// using generics heavily are its top-level ones only, whatever the generic
+// functions, methods and types declare.
+func TestGenericPackages(t *testing.T) {
+	cache := writeModule(t, "algo", map[string]string{
+		"algo.go": `package algo
+
+type Number interface{ ~int | ~int64 | ~float64 }
+
+type Num[T Number] int
+
+const Typed Num[int] = 3
+
+const Untyped = 2
+
+var Zero Num[float64]
+
+var Registry = map[string]Tree[int]{}
+
+type Tree[T any] struct {
+	Left, Right *Tree[T]
+	Value       T
+}
+
+func (t *Tree[T]) Walk(f func(T)) {
+	const Depth = 10
+	var Visited int
+	_ = Visited
+	f(t.Value)
+}
+
+func Map[T, U any](s []T, f func(T) U) []U {
+	const Capacity = 16
+	var Out = make([]U, 0, Capacity)
+	for _, v := range s {
+		Out = append(Out, f(v))
+	}
+	return Out
+}
+
+func Reduce[T any, A Number](s []T, f func(A, T) A) (Acc A) {
+	type Step struct{ Index int }
+	return Acc
+}
+`,
+	})
+	files := generate(t, cache, "algo", nil)
+	if got := keys(mapEntries(t, files, "Packages", "example.com/algo")); strings.Join(got, ",") != "Typed,Untyped,Registry,Zero" {
+		t.Errorf("env.Packages holds %v, want Typed, Untyped, Registry and Zero", got)
+	}
+	if got := keys(mapEntries(t, files, "PackageTypes", "example.com/algo")); len(got) != 0 {
+		t.Errorf("env.PackageTypes holds %v, the generic types without instantiation", got)
+	}
+	compile(t, files, "anko", cache, []string{"algo"})
+}
+
+// TestLongLines checks that the entries of very long names are written on
+// one line each, formatted as gofmt does, and that a -header-file directive
+// for line-length linters is kept above the package clause.
+func TestLongLines(t *testing.T) {
+	long := "Very" + strings.Repeat("Long", 60)
+	cache := writeModule(t, "long", map[string]string{
+		"long.go": fmt.Sprintf("package long\n\nconst %[1]sConst = 1\n\nvar %[1]sVar = map[string][]int{}\n\ntype %[1]sType struct{}\n\nfunc %[1]sFunc(a, b %[1]sType) %[1]sType { return a }\n", long),
+		"x/package_with_a_very_long_name_too/p.go": fmt.Sprintf("package package_with_a_very_long_name_too\n\nfunc %sFunc() {}\n", long),
+	})
+	files := generate(t, cache, "long", map[string]string{"header.txt": "//nolint:lll\n"}, "-header-file", "header.txt", "-with-docs")
+	src := files["long.go"]
+	if !strings.HasPrefix(src, "//nolint:lll\n") {
+		t.Errorf("the header isn't first:\n%s", src[:200])
+	}
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(formatted) != src {
+		t.Errorf("long.go isn't formatted")
+	}
+	for _, path := range []string{"example.com/long", "example.com/long/x/package_with_a_very_long_name_too"} {
+		for _, e := range append(mapEntries(t, files, "Packages", path), mapEntries(t, files, "PackageTypes", path)...) {
+			line := strconv.Quote(e.key) + ": " + e.value + ","
+			if !strings.Contains(src, "\t\t"+line+"\n") {
+				t.Errorf("the entry of %s isn't on one line", e.key)
+			}
+		}
+	}
+	if n := len(mapEntries(t, files, "Packages", "example.com/long")); n != 3 {
+		t.Errorf("example.com/long has %d values, want 3", n)
+	}
+	compile(t, files, "anko", cache, []string{"long"})
+}
+
+// TestNonASCIINames checks the keys and references of the exported names
+// with non-ASCII letters under each -non-ascii mode.
+func TestNonASCIINames(t *testing.T) {
+	cache := writeModule(t, "unicode", map[string]string{
+		"unicode.go": `package unicode
+
+const Größe = 1
+
+const Plain = 2
+
+var Café = "x"
+
+type Ñandú struct{}
+
+func Über() Ñandú { return Ñandú{} }
+`,
+	})
+	for _, test := range []struct {
+		mode   string
+		values map[string]string
+		types  map[string]string
+	}{
+		{"keep", map[string]string{
+			"Größe": "reflect.ValueOf(unicode.Größe)",
+			"Plain": "reflect.ValueOf(unicode.Plain)",
+			"Café":  "reflect.ValueOf(unicode.Café)",
+			"Über":  "reflect.ValueOf(unicode.Über)",
+		}, map[string]string{"Ñandú": "reflect.TypeOf((*unicode.Ñandú)(nil)).Elem()"}},
+		{"skip", map[string]string{
+			"Plain": "reflect.ValueOf(unicode.Plain)",
+		}, map[string]string{}},
+		{"ascii", map[string]string{
+			"Gr_u00f6_u00dfe": "reflect.ValueOf(unicode.Größe)",
+			"Plain":           "reflect.ValueOf(unicode.Plain)",
+			"Caf_u00e9":       "reflect.ValueOf(unicode.Café)",
+			"_u00dcber":       "reflect.ValueOf(unicode.Über)",
+		}, map[string]string{"_u00d1and_u00fa": "reflect.TypeOf((*unicode.Ñandú)(nil)).Elem()"}},
+	} {
+		files := generate(t, cache, "unicode", nil, "-non-ascii", test.mode)
+		for m, want := range map[string]map[string]string{"Packages": test.values, "PackageTypes": test.types} {
+			got := values(mapEntries(t, files, m, "example.com/unicode"))
+			if len(got) != len(want) {
+				t.Errorf("-non-ascii %s: env.%s holds %v, want %v", test.mode, m, got, want)
+			}
+			for key, value := range want {
+				if got[key] != value {
+					t.Errorf("-non-ascii %s: env.%s[%q] = %q, want %q", test.mode, m, key, got[key], value)
+				}
+			}
+		}
+		compile(t, files, "anko", cache, []string{"unicode"})
+	}
+}
+
+// TestAssemblyFunctions checks that the functions declared without a body,
+// implemented in assembly, are bound and callable by default, and dropped
+// as such by -no-asm.
+func TestAssemblyFunctions(t *testing.T) {
+	cache := writeModule(t, "asm", map[string]string{
+		"add_amd64.go": "package asm\n\n// Add is implemented in add_amd64.s.\nfunc Add(a, b int) int\n",
+		"add_amd64.s":  "#include \"textflag.h\"\n\n// func Add(a, b int) int\nTEXT ·Add(SB), NOSPLIT, $0-24\n\tMOVQ a+0(FP), AX\n\tADDQ b+8(FP), AX\n\tMOVQ AX, ret+16(FP)\n\tRET\n",
+		"add_other.go": "//go:build !amd64\n\npackage asm\n\nfunc Add(a, b int) int { return a + b }\n",
+		"scale.go":     "package asm\n\nfunc Scale(a, n int) int { return Add(a, 0) * n }\n",
+	})
+	for _, test := range []struct {
+		args    []string
+		want    string
+		dropped []droppedSymbol
+	}{
+		{nil, "Add,Scale", nil},
+		{[]string{"-no-asm"}, "Scale", []droppedSymbol{{Name: "Add", Kind: "func", Reason: "assembly"}}},
+	} {
+		r := runGenerator(t, cache, nil, nil, append([]string{"-pkg", "example.com/asm", "-v", "v1.0.0", "-name", "asm", "-quiet", "-coverage", "coverage.json"}, test.args...)...)
+		if r.err != nil {
+			t.Fatalf("%v\n%s", r.err, r.stderr)
+		}
+		files := r.output(t)
+		if got := keys(mapEntries(t, files, "Packages", "example.com/asm")); strings.Join(got, ",") != test.want {
+			t.Errorf("%s: env.Packages holds %v, want %s", strings.Join(test.args, " "), got, test.want)
+		}
+		b, err := os.ReadFile(filepath.Join(r.dir, "coverage.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var coverage []packageCoverage
+		if err := json.Unmarshal(b, &coverage); err != nil {
+			t.Fatal(err)
+		}
+		if len(coverage) != 1 || !reflect.DeepEqual(coverage[0].Dropped, test.dropped) {
+			t.Errorf("%s: the coverage is %+v, want %+v dropped", strings.Join(test.args, " "), coverage, test.dropped)
+		}
+		if test.args != nil {
+			continue
+		}
+		output := execute(t, files, "anko", cache, []string{"asm"}, `package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mattn/anko/env"
+
+	_ "consumer/packages"
+)
+
+func main() {
+	add := env.Packages["example.com/asm"]["Add"]
+	fmt.Println(add.Call([]reflect.Value{reflect.ValueOf(2), reflect.ValueOf(3)})[0])
+}
+`)
+		if output != "5\n" {
+			t.Errorf("the assembly Add returns %q, want 5", output)
+		}
+	}
+}
+
+// TestClassifiedVariables checks that -classify-vars moves the variables
+// holding functions to the functions, whatever their initializer, and notes
+// the ones computed by a call at init.
+func TestClassifiedVariables(t *testing.T) {
+	cache := writeModule(t, "lazy", map[string]string{
+		"lazy.go": `package lazy
+
+import (
+	"os"
+	"time"
+)
+
+type Client struct{}
+
+func (c *Client) Get(url string) error { return nil }
+
+var DefaultClient = &Client{}
+
+var Now = time.Now
+
+var Out = os.Stdout
+
+var Literal = func() int { return 1 }
+
+var Local = helper
+
+var Get = DefaultClient.Get
+
+var Zero = computeZero()
+
+var Picked = pick()
+
+var Plain = 3
+
+func helper() {}
+
+func computeZero() int { return 0 }
+
+func pick() func() int { return computeZero }
+`,
+	})
+	for _, test := range []struct {
+		args     []string
+		groups   map[string]string
+		computed []string
+	}{
+		{nil, map[string]string{
+			"DefaultClient": "variables", "Now": "variables", "Out": "variables", "Literal": "variables", "Local": "variables",
+			"Get": "variables", "Zero": "variables", "Picked": "variables", "Plain": "variables",
+		}, nil},
+		{[]string{"-classify-vars"}, map[string]string{
+			"DefaultClient": "variables", "Now": "functions", "Out": "variables", "Literal": "functions", "Local": "functions",
+			"Get": "functions", "Zero": "variables", "Picked": "variables", "Plain": "variables",
+		}, []string{"Zero", "Picked"}},
+		// the type of the result of pick is known
+		{[]string{"-classify-vars", "-typecheck"}, map[string]string{
+			"DefaultClient": "variables", "Now": "functions", "Out": "variables", "Literal": "functions", "Local": "functions",
+			"Get": "functions", "Zero": "variables", "Picked": "functions", "Plain": "variables",
+		}, []string{"Zero"}},
+	} {
+		files := generate(t, cache, "lazy", nil, test.args...)
+		entries := mapEntries(t, files, "Packages", "example.com/lazy")
+		groups := make(map[string]string)
+		for _, e := range entries {
+			groups[e.key] = e.group
+		}
+		for key, want := range test.groups {
+			if groups[key] != want {
+				t.Errorf("%s: %s is in the %q section, want %q", strings.Join(test.args, " "), key, groups[key], want)
+			}
+		}
+		for _, e := range entries {
+			computed := regexp.MustCompile(strconv.Quote(e.key) + `:\s+` + regexp.QuoteMeta(e.value) + `,\s+// computed at init\n`).MatchString(files["lazy.go"])
+			if want := contains(test.computed, e.key); computed != want {
+				t.Errorf("%s: %s noted computed at init = %v, want %v", strings.Join(test.args, " "), e.key, computed, want)
+			}
+		}
+		compile(t, files, "anko", cache, []string{"lazy"})
+	}
+}
+
+// TestRenderedSignatures checks the signatures -with-docs writes above the
+// functions, for each shape of params and results.
+func TestRenderedSignatures(t *testing.T) {
+	cache := writeModule(t, "sig", map[string]string{
+		"sig.go": `package sig
+
+import "io"
+
+type Option struct{}
+
+func Blank(_ int, _ string) {}
+
+func Unnamed(int, string) {}
+
+func Mixed(_ int, name string) {}
+
+func Variadic(format string, args ...interface{}) {}
+
+func BlankVariadic(_ ...Option) {}
+
+func Results(r io.Reader) (int, error) { return 0, nil }
+
+func Named(path string) (n int, err error) { return }
+
+func BlankResults() (_ int, _ error) { return }
+
+func Funcs(f func(int) (bool, error), _ func(...string)) func() error { return nil }
+
+func Grouped(a, b int, c, _ string) {}
+`,
+	})
+	files := generate(t, cache, "sig", nil, "-with-docs")
+	src := files["sig.go"]
+	for key, doc := range map[string]string{
+		"Blank":         "func Blank(_ int, _ string)",
+		"Unnamed":       "func Unnamed(int, string)",
+		"Mixed":         "func Mixed(_ int, name string)",
+		"Variadic":      "func Variadic(format string, args ...interface{})",
+		"BlankVariadic": "func BlankVariadic(_ ...Option)",
+		"Results":       "func Results(r io.Reader) (int, error)",
+		"Named":         "func Named(path string) (n int, err error)",
+		"BlankResults":  "func BlankResults() (_ int, _ error)",
+		"Funcs":         "func Funcs(f func(int) (bool, error), _ func(...string)) func() error",
+		"Grouped":       "func Grouped(a, b int, c, _ string)",
+	} {
+		if entry := "// " + doc + "\n\t\t" + strconv.Quote(key) + ":"; !strings.Contains(src, entry) {
+			t.Errorf("%s isn't documented as %q:\n%s", key, doc, src)
+		}
+	}
+	compile(t, files, "anko", cache, []string{"sig"})
+}
+
+// TestDotImports checks that the symbols of a file dot-importing a package
+// are collected like the others, and that -typecheck qualifies the
+// identifiers of the imported package in the signatures of -with-docs.
+func TestDotImports(t *testing.T) {
+	cache := writeModule(t, "clock", map[string]string{
+		"clock.go": `package clock
+
+import . "time"
+
+type Clock struct{ Zone *Location }
+
+const Period = Second
+
+var Default = Clock{Zone: UTC}
+
+func Later(d Duration) Time { return Now().Add(d) }
+
+func (c Clock) In(t Time) Time { return t.In(c.Zone) }
+
+func Pass(c Clock) Clock { return c }
+`,
+	})
+	for _, test := range []struct {
+		args []string
+		docs map[string]string
+	}{
+		{[]string{"-with-docs"}, map[string]string{
+			"Later": "func Later(d Duration) Time",
+			"Pass":  "func Pass(c Clock) Clock",
+		}},
+		{[]string{"-with-docs", "-typecheck"}, map[string]string{
+			"Later": "func Later(d time.Duration) time.Time",
+			"Pass":  "func Pass(c Clock) Clock",
+		}},
+	} {
+		files := generate(t, cache, "clock", nil, test.args...)
+		if got := keys(mapEntries(t, files, "Packages", "example.com/clock")); strings.Join(got, ",") != "Period,Default,Later,Pass" {
+			t.Errorf("%s: env.Packages holds %v, want Period, Default, Later and Pass", strings.Join(test.args, " "), got)
+		}
+		if got := keys(mapEntries(t, files, "PackageTypes", "example.com/clock")); strings.Join(got, ",") != "Clock" {
+			t.Errorf("%s: env.PackageTypes holds %v, want Clock", strings.Join(test.args, " "), got)
+		}
+		for key, doc := range test.docs {
+			if entry := "// " + doc + "\n\t\t" + strconv.Quote(key) + ":"; !strings.Contains(files["clock.go"], entry) {
+				t.Errorf("%s: %s isn't documented as %q:\n%s", strings.Join(test.args, " "), key, doc, files["clock.go"])
+			}
+		}
+		compile(t, files, "anko", cache, []string{"clock"})
+	}
+}
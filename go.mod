@@ -1,3 +1,3 @@
 module github.com/Juby210/anko-package-gen2
 
-go 1.16
+go 1.18
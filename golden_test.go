@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files of testdata/golden with the generated ones")
+
+// goldenModes are the runs of the generator on example.com/golden whose
+// output is kept in testdata/golden/<name>, and the env stub it builds
+// with.
+var goldenModes = []struct {
+	name string
+	env  string
+	args []string
+}{
+	{"default", "anko", nil},
+	{"compact", "anko", []string{"-compact"}},
+	{"grouped", "anko", []string{"-group-constants", "-constructors", "-group-fallible", "-error-types"}},
+	{"docs", "anko", []string{"-with-docs", "-iota-values", "-with-values"}},
+	{"types", "anko", []string{"-emit-types-for-all", "-pointer-types", "-type-names", "-new", "-converters"}},
+	{"split", "anko", []string{"-split-by-kind"}},
+	{"shard", "anko", []string{"-shard", "2"}},
+	{"platforms", "anko", []string{"-platforms", "linux/amd64,windows/amd64"}},
+	{"table", "anko", []string{"-symbol-table"}},
+	{"interface", "anko-interface", []string{"-value-kind", "interface"}},
+	{"lazy", "anko", []string{"-lazy"}},
+	{"register", "anko", []string{"-register", "-import-names"}},
+	{"json", "", []string{"-format", "json"}},
+}
+
+// TestGolden diffs the files generated by each mode with the golden ones,
+// rewritten with -update, and builds them. The fixture has iota constants,
+// aliases, build-constrained files and generic types and functions,
+// exported at the instantiations of testdata/golden/config.json.
+func TestGolden(t *testing.T) {
+	config, err := os.ReadFile(filepath.Join("testdata", "golden", "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := testdataMod(t)
+	for _, mode := range goldenModes {
+		mode := mode
+		t.Run(mode.name, func(t *testing.T) {
+			t.Parallel()
+			args := append([]string{"-config", "config.json"}, mode.args...)
+			files := generate(t, cache, "golden", map[string]string{"config.json": string(config)}, args...)
+			dir := filepath.Join("testdata", "golden", mode.name)
+			if *update {
+				if err := os.RemoveAll(dir); err != nil {
+					t.Fatal(err)
+				}
+				writeFiles(t, dir, files)
+			}
+			want := readFiles(t, dir)
+			for name, src := range files {
+				if want[name] != src {
+					t.Errorf("%s differs from %s, run go test -update to accept:\n%s", name, filepath.Join(dir, name), src)
+				}
+			}
+			for name := range want {
+				if _, ok := files[name]; !ok {
+					t.Errorf("%s isn't generated anymore", name)
+				}
+			}
+			switch {
+			case mode.env == "":
+			case mode.name == "platforms":
+				compile(t, files, mode.env, cache, []string{"golden"}, "linux", "windows")
+			default:
+				// generated for linux, where Epoll is declared
+				compile(t, files, mode.env, cache, []string{"golden"})
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const importNameTemplate = `	if m := env.Packages["%[2]s"]; m != nil {
+		env.Packages["%[1]s"] = m
+		env.PackageTypes["%[1]s"] = env.PackageTypes["%[2]s"]
+	}
+`
+
+// importName returns the last element of path, the one before for a major
+// version suffix like /v2.
+func importName(path string) string {
+	elems := strings.Split(path, "/")
+	last := elems[len(elems)-1]
+	if len(elems) > 1 && isMajorVersion(last) {
+		return elems[len(elems)-2]
+	}
+	return last
+}
+
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' || s[1] == '0' {
+		return false
+	}
+	for _, c := range s[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// importNames returns the code registering the packages under their import
+// name too, so scripts can import("name") instead of the full path. Names
+// claimed by several paths, or being the path of another package, are left
+// out with a warning.
+func importNames(paths []string) string {
+	isPath := make(map[string]bool, len(paths))
+	claims := make(map[string][]string)
+	for _, path := range paths {
+		isPath[path] = true
+		if name := importName(path); name != path {
+			claims[name] = append(claims[name], path)
+		}
+	}
+	names := make([]string, 0, len(claims))
+	for name := range claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		switch {
+		case isPath[name]:
+			infof("warning: import name %s of %s is a package path already, skipping", name, strings.Join(claims[name], ", "))
+		case len(claims[name]) > 1:
+			infof("warning: import name %s is shared by %s, skipping", name, strings.Join(claims[name], ", "))
+		default:
+			fmt.Fprintf(&b, importNameTemplate, name, claims[name][0])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,47 @@
+package main
+
+import "fmt"
+
+// qualifiers maps the identifiers the generated files refer to packages by
+// to their import path, starting with the imports of the templates.
+var qualifiers = map[string]string{
+	"reflect": "reflect",
+	"env":     "github.com/mattn/anko/env",
+}
+
+// aliases maps the import paths of the packages referred to by another
+// identifier than their name to that identifier.
+var aliases = make(map[string]string)
+
+// qualify returns the identifier the generated code refers to the package
+// path named name by. Packages of the same name, like crypto/rand and
+// math/rand, are told apart by a numeric suffix. The import of a package
+// whose name isn't the one of its path, like yaml for gopkg.in/yaml.v3, is
+// aliased too, so every reference reads as the identifier imported.
+func qualify(path, name string) string {
+	q := name
+	for i := 2; ; i++ {
+		if p, ok := qualifiers[q]; !ok || p == path {
+			break
+		}
+		q = fmt.Sprintf("%s%d", name, i)
+	}
+	qualifiers[q] = path
+	if q != name || name != importName(path) {
+		aliases[path] = q
+	}
+	return q
+}
+
+// importSpec returns the import line of path, or "" if the templates import
+// it already.
+func importSpec(path string) string {
+	switch {
+	case path == qualifiers["reflect"] || path == qualifiers["env"]:
+		return ""
+	case aliases[path] != "":
+		return fmt.Sprintf("\t%s \"%s\"\n", aliases[path], path)
+	default:
+		return fmt.Sprintf("\t\"%s\"\n", path)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+)
+
+// indexEntry is a bound symbol in the -index file.
+type indexEntry struct {
+	Path       string `json:"path"`
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	Deprecated bool   `json:"deprecated,omitempty"`
+	Signature  string `json:"signature,omitempty"`
+}
+
+// indexEntries records the symbols bound in this run, and indexedPaths
+// their packages, replacing the entries of the index for them.
+var (
+	indexEntries []indexEntry
+	indexedPaths = make(map[string]bool)
+)
+
+func addIndexEntries(d *declaration) {
+	indexedPaths[d.path] = true
+	bound := [4][]*symbol{d.constants, d.variables, d.types, d.functions}
+	for k, kind := range []string{"const", "var", "type", "func"} {
+		for _, syms := range [][]*symbol{bound[k], d.deprecated[k]} {
+			for _, sym := range syms {
+				indexEntries = append(indexEntries, indexEntry{
+					Path:       d.path,
+					Name:       sym.name,
+					Kind:       kind,
+					Deprecated: sym.deprecation != "",
+					Signature:  sym.signature,
+				})
+			}
+		}
+	}
+}
+
+// writeIndex updates the index in filename with the symbols bound in this
+// run: the entries of the other packages are kept, so the index can be
+// built by several runs.
+func writeIndex(filename string) error {
+	var entries []indexEntry
+	b, err := os.ReadFile(filename)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	case len(b) > 0:
+		if err := json.Unmarshal(b, &entries); err != nil {
+			return err
+		}
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if !indexedPaths[e.Path] {
+			kept = append(kept, e)
+		}
+	}
+	entries = append(kept, indexEntries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Path != entries[j].Path {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	if b, err = json.MarshalIndent(entries, "", "\t"); err != nil {
+		return err
+	}
+	return writeFile(filename, append(b, '\n'))
+}
@@ -0,0 +1,96 @@
+// Package loader registers the bindings listed by a descriptor of
+// anko-package-gen2 -format json at runtime.
+//
+// Go can't look up the symbols of a package by name, so the program
+// compiles in a registry of the values and types it may bind, e.g. the
+// maps of generated Go bindings, and the descriptor selects the ones
+// scripts see. The descriptor can then change without rebuilding the
+// program, as long as the registry holds its symbols.
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Package is the descriptor of a package: its symbols by kind.
+type Package struct {
+	Path      string   `json:"path"`
+	Name      string   `json:"name"`
+	Constants []string `json:"constants,omitempty"`
+	Variables []string `json:"variables,omitempty"`
+	Functions []string `json:"functions,omitempty"`
+	Types     []string `json:"types,omitempty"`
+}
+
+// Decode reads the descriptor of -format json.
+func Decode(r io.Reader) ([]Package, error) {
+	var pkgs []Package
+	if err := json.NewDecoder(r).Decode(&pkgs); err != nil {
+		return nil, fmt.Errorf("decoding the descriptor: %v", err)
+	}
+	return pkgs, nil
+}
+
+// Registry holds bindings by import path and name, like env.Packages and
+// env.PackageTypes.
+type Registry struct {
+	Packages     map[string]map[string]reflect.Value
+	PackageTypes map[string]map[string]reflect.Type
+}
+
+// Load registers the symbols of pkgs found in from into to. The functions
+// must be registered by values of kind func. The symbols missing from from
+// and the functions of other kinds are all reported, and nothing is
+// registered then.
+func Load(pkgs []Package, from, to Registry) error {
+	var problems []string
+	for _, pkg := range pkgs {
+		for _, name := range values(pkg) {
+			if _, ok := from.Packages[pkg.Path][name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s isn't registered", pkg.Path, name))
+			}
+		}
+		for _, name := range pkg.Functions {
+			if v, ok := from.Packages[pkg.Path][name]; ok && v.Kind() != reflect.Func {
+				problems = append(problems, fmt.Sprintf("%s.%s is a function, registered as a %s", pkg.Path, name, v.Kind()))
+			}
+		}
+		for _, name := range pkg.Types {
+			if from.PackageTypes[pkg.Path][name] == nil {
+				problems = append(problems, fmt.Sprintf("type %s.%s isn't registered", pkg.Path, name))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("loading the descriptor:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+
+	for _, pkg := range pkgs {
+		if to.Packages[pkg.Path] == nil {
+			to.Packages[pkg.Path] = make(map[string]reflect.Value)
+		}
+		for _, name := range values(pkg) {
+			to.Packages[pkg.Path][name] = from.Packages[pkg.Path][name]
+		}
+		if to.PackageTypes[pkg.Path] == nil {
+			to.PackageTypes[pkg.Path] = make(map[string]reflect.Type)
+		}
+		for _, name := range pkg.Types {
+			to.PackageTypes[pkg.Path][name] = from.PackageTypes[pkg.Path][name]
+		}
+	}
+	return nil
+}
+
+// values returns the names of the constants, variables and functions of
+// pkg, registered into Packages.
+func values(pkg Package) []string {
+	var names []string
+	names = append(names, pkg.Constants...)
+	names = append(names, pkg.Variables...)
+	return append(names, pkg.Functions...)
+}
@@ -0,0 +1,95 @@
+package loader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestLoad checks that Load registers the symbols of the descriptor, and
+// only them, and reports every problem of the registry at once.
+func TestLoad(t *testing.T) {
+	from := Registry{
+		Packages: map[string]map[string]reflect.Value{
+			"strings": {
+				"ToUpper": reflect.ValueOf(strings.ToUpper),
+				"ToLower": reflect.ValueOf(strings.ToLower),
+				"NotFunc": reflect.ValueOf(1),
+			},
+		},
+		PackageTypes: map[string]map[string]reflect.Type{
+			"strings": {
+				"Builder": reflect.TypeOf(strings.Builder{}),
+				"Reader":  reflect.TypeOf(strings.Reader{}),
+			},
+		},
+	}
+	for _, tt := range []struct {
+		name       string
+		descriptor string
+		values     []string
+		types      []string
+		err        string
+	}{
+		{
+			name:       "subset",
+			descriptor: `[{"path": "strings", "name": "strings", "functions": ["ToUpper"], "types": ["Builder"]}]`,
+			values:     []string{"ToUpper"},
+			types:      []string{"Builder"},
+		},
+		{
+			name:       "constant",
+			descriptor: `[{"path": "strings", "name": "strings", "constants": ["NotFunc"]}]`,
+			values:     []string{"NotFunc"},
+		},
+		{
+			name:       "problems",
+			descriptor: `[{"path": "strings", "name": "strings", "functions": ["ToUpper", "Missing", "NotFunc"], "types": ["Gone"]}, {"path": "bytes", "name": "bytes", "variables": ["MinRead"]}]`,
+			err:        "loading the descriptor:\n\tstrings.Missing isn't registered\n\tstrings.NotFunc is a function, registered as a int\n\ttype strings.Gone isn't registered\n\tbytes.MinRead isn't registered",
+		},
+		{
+			name:       "syntax",
+			descriptor: `[{"path": "strings"`,
+			err:        "decoding the descriptor: unexpected EOF",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			to := Registry{
+				Packages:     make(map[string]map[string]reflect.Value),
+				PackageTypes: make(map[string]map[string]reflect.Type),
+			}
+			pkgs, err := Decode(strings.NewReader(tt.descriptor))
+			if err == nil {
+				err = Load(pkgs, from, to)
+			}
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got the error %v, want %q", err, tt.err)
+				}
+				if len(to.Packages) > 0 || len(to.PackageTypes) > 0 {
+					t.Errorf("registered %v and %v despite the error", to.Packages, to.PackageTypes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.values {
+				if _, ok := to.Packages["strings"][name]; !ok {
+					t.Errorf("%s not loaded", name)
+				}
+			}
+			if len(to.Packages["strings"]) != len(tt.values) {
+				t.Errorf("got the values %v, want %q", to.Packages["strings"], tt.values)
+			}
+			for _, name := range tt.types {
+				if to.PackageTypes["strings"][name] != from.PackageTypes["strings"][name] {
+					t.Errorf("type %s not loaded", name)
+				}
+			}
+			if len(to.PackageTypes["strings"]) != len(tt.types) {
+				t.Errorf("got the types %v, want %q", to.PackageTypes["strings"], tt.types)
+			}
+		})
+	}
+}
@@ -1,21 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"go/format"
+	"go/parser"
+	"go/token"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"unicode"
 )
 
-const template = `
+const fileTemplate = `
 // Code generated by anko-package-gen2 %s. DO NOT EDIT.
 
-package packages
+package %s
 
 import (
 	"reflect"
@@ -23,29 +28,448 @@ import (
 	"github.com/mattn/anko/env"
 
 %s)
+%s%s`
 
+const initFuncTemplate = `
 func init() {
 %s}
-%s`
+`
+
+// lazyFuncTemplate replaces initFuncTemplate with -lazy.
+const lazyFuncTemplate = `
+var load%[1]sPackages = map[string]func(){
+%[2]s}
+
+// Load%[1]s registers the package path in env, if it's one of the bindings
+// and isn't registered yet, and reports whether it's one of the bindings.
+func Load%[1]s(path string) bool {
+	load, ok := load%[1]sPackages[path]
+	if ok && env.Packages[path] == nil && env.PackageTypes[path] == nil {
+		load()
+	}
+	return ok
+}
+`
+
+// registerFuncTemplate replaces initFuncTemplate with -register.
+const registerFuncTemplate = `
+// Register%[1]s registers the packages in env, failing if one of them is
+// registered already.
+func Register%[1]s() error {
+	for _, path := range []string{
+%[2]s	} {
+		if env.Packages[path] != nil || env.PackageTypes[path] != nil {
+			return %[3]s.Errorf("anko package %%s is registered already", path)
+		}
+	}
+%[4]s	return nil
+}
+`
 
 var (
-	pkg  = flag.String("pkg", "", "Package")
-	ver  = flag.String("v", "", "Version")
-	name = flag.String("name", "", "Name")
-	o    = flag.String("o", "anko-packages", "Output dir")
+	pkg       = flag.String("pkg", "", "Package, optionally with its version as path@version")
+	ver       = flag.String("v", "", "Version")
+	name      = flag.String("name", "", "Name")
+	o         = flag.String("o", "anko-packages", "Output dir, or - to only print the generated files")
+	pkgClause = flag.String("package", "packages", "Package name of the generated file")
+	conf      = flag.String("config", "", "Config file (JSON)")
+	ovl       = flag.String("overlay", "", "Overlay file (JSON, as accepted by go build -overlay)")
+
+	compact                = flag.Bool("compact", false, "Omit section comments")
+	constructors           = flag.Bool("constructors", false, "Group constructors (New* functions) under their own comment")
+	groupConstants         = flag.Bool("group-constants", false, "Group constants by their declared type")
+	skipDeprecatedPackages = flag.Bool("skip-deprecated-packages", false, "Skip packages whose documentation marks them deprecated")
+	emitNew                = flag.Bool("new", false, "Emit zero-value constructors of struct types into env.PackageNew")
+	newOpaque              = flag.Bool("new-opaque", false, "With -new, include structs without exported fields")
+	nonASCII               = flag.String("non-ascii", "keep", "Handling of non-ASCII identifiers: keep, skip or ascii (escape the key)")
+	outFormat              = flag.String("format", "go", "Output format: go, or json (experimental) for a descriptor of the bound symbols")
+	maxSymbols             = flag.Int("max-symbols", 0, "Fail when a package exports more symbols (0 for no limit)")
+	warnMaxSymbols         = flag.Bool("warn-max-symbols", false, "Only warn when a package exceeds -max-symbols")
+	checkImports           = flag.Bool("check-imports", false, "Warn about imports of the source packages that don't resolve")
+	noAsm                  = flag.Bool("no-asm", false, "Skip functions implemented in assembly (declared without a body)")
+	typecheck              = flag.Bool("typecheck", false, "Type-check the source packages for precise symbol classification")
+	classifyVars           = flag.Bool("classify-vars", false, "Register function-valued variables as functions and note variables computed at init")
+	headerFile             = flag.String("header-file", "", "File prepended verbatim to the generated file (license, build constraints)")
+	footerFile             = flag.String("footer-file", "", "File appended verbatim to the generated file")
+	converters             = flag.Bool("converters", false, "Emit converters from numbers to the named numeric types having constants into env.PackageConverters")
+	baseline               = flag.String("baseline", "", "File of approved symbols (path.Name per line), fail on symbols not in it")
+	updateBaseline         = flag.Bool("update-baseline", false, "Record the exported symbols as approved in the -baseline file")
+	withDocs               = flag.Bool("with-docs", false, "Emit documentation comments, such as function signatures, above the entries")
+	verify                 = flag.String("verify", "", "Compare the keys registered by a binary (JSON dump) with the source instead of generating")
+	instantiateAny         = flag.Bool("instantiate-any", false, "Export generic types with a single any type parameter at their [any] instantiation")
+	platformList           = flag.String("platforms", "", "Comma-separated GOOS/GOARCH list, platform-specific symbols go to build-tagged files")
+	jobs                   = flag.Int("j", 1, "Number of packages held parsed at once, the next ones parsed while one is generated")
+	quiet                  = flag.Bool("quiet", false, "Suppress informational output, keeping errors")
+	requireNonempty        = flag.Bool("require-nonempty", false, "Fail when no symbols are exported")
+	coverageFile           = flag.String("coverage", "", "Write a JSON report of the exported symbols bound or dropped, per package")
+	noCgo                  = flag.Bool("no-cgo", false, "Skip cgo files, selecting their !cgo fallbacks")
+	withValues             = flag.Bool("with-values", false, "Note the literal value of constants")
+	stability              = flag.String("stability", "beta", "Exported API level: stable (no deprecated or experimental), beta (no deprecated) or all")
+	betaMarker             = flag.String("beta-marker", "Beta:", "Doc marker of beta API, excluded like Experimental: at -stability stable")
+	groupErrors            = flag.Bool("error-types", false, "Group the types implementing error (with an Error() string method) under their own comment")
+	std                    = flag.Bool("std", false, "Generate the standard library packages of GOROOT instead of -pkg")
+	emitString             = flag.String("emit-string", "", "Write the generated code as a raw string constant of this name instead")
+	pointerTypes           = flag.Bool("pointer-types", false, "Also register *T, as TPtr, for the types whose methods all have pointer receivers")
+	emitGenerate           = flag.Bool("emit-generate", false, "Write generate.go to the output dir with the go:generate directive of this run")
+	externalTest           = flag.Bool("external-test", false, "Asks for the symbols of the external foo_test packages, which fails explaining why they can't be bound")
+	forceExport            = flag.String("force-export", "", "Comma-separated unexported names asked to be bound, which fails explaining why it's impossible")
+	skipComplex            = flag.Bool("skip-complex", false, "Skip complex constants, for Anko VMs without complex support")
+	evalSymlinks           = flag.Bool("eval-symlinks", true, "Resolve the symlinks of the module directory before walking it")
+	groupFallible          = flag.Bool("group-fallible", false, "Group the functions returning an error last under their own comment")
+	sinceVersion           = flag.String("since-version", "", "Only generate the symbols added since this version of the module, downloaded to the module cache if missing")
+	packageName            = flag.String("package-name", "", "Package clause name to export in each directory, instead of the first one not main or _test")
+	typeNames              = flag.Bool("type-names", false, "Emit env.TypeNames entries mapping each exported type to its \"path.Name\"")
+	noInternalTypes        = flag.Bool("no-internal-types", false, "Skip the functions and variables whose type uses a type of an internal package")
+	warnCase               = flag.Bool("warn-case", false, "Warn about exported names differing only by case")
+	shardCount             = flag.Int("shard", 1, "Split the symbols of each package alphabetically across this many files")
+	arraysByValue          = flag.Bool("arrays-by-value", false, "Register fixed-size array variables by value instead of by address")
+	resolve                = flag.Bool("resolve", false, "Generate the packages given as arguments, import paths or patterns located with go list, instead of -pkg")
+	skipPanicStubs         = flag.Bool("skip-panic-stubs", false, "Skip the functions whose body only panics")
+	byConstraint           = flag.Bool("by-constraint", false, "Register the symbols of build-constrained files from files with the same constraints, compiling on every target")
+	keepLinkname           = flag.Bool("keep-linkname", false, "Keep the bodiless functions pulled from other packages with //go:linkname")
+	withPositions          = flag.Bool("with-positions", false, "Emit the source file and line of the symbols above the entries")
+	iotaValues             = flag.Bool("iota-values", false, "Note the value of the constants defined with iota")
+	allowMain              = flag.Bool("allow-main", false, "Export a main package when the directory has no other package")
+	importNameFlag         = flag.Bool("import-names", false, "Also register each package under the last element of its path, for import(\"name\") in scripts")
+	minGo                  = flag.String("min-go", "", "Minimum Go version of the target, like 1.21, evaluating the goX.Y build constraints against it instead of the host")
+	check                  = flag.Bool("check", false, "Compare the generated files with the ones in the output dir instead of writing them, failing with a diff when they differ")
+	register               = flag.Bool("register", false, "Emit a Register<Name>() error function, failing on packages registered already, instead of an init function")
+	strictSignatures       = flag.Bool("strict-signatures", false, "Skip the functions whose signature uses a type scripts can't name (unexported, unregistered or internal)")
+	skipVariadicAny        = flag.Bool("skip-variadic-any", false, "Skip the functions with a ...any (or ...interface{}) param, for Anko VMs mishandling them")
+	summary                = flag.Bool("summary", false, "Print the number of symbols of each kind bound per package, and the totals, to stderr")
+	lazy                   = flag.Bool("lazy", false, "Emit a Load<Name>(path) function registering a package on demand instead of an init function registering all")
+	emitDeprecated         = flag.Bool("emit-deprecated-separately", false, "Bind the deprecated symbols into env.DeprecatedPackages and env.DeprecatedPackageTypes instead of dropping them")
+	kinds                  = flag.String("kinds", "const,var,type,func", "Comma-separated kinds of symbols to export, among const, var, type and func")
+	knownBuiltins          = flag.String("known-builtins", "", "Comma-separated import paths bound elsewhere, or anko for the ones of github.com/mattn/anko/packages, warning when generating them")
+	typesForAll            = flag.Bool("emit-types-for-all", false, "Register the type of every constant, variable and function into env.PackageTypes too")
+	withDeps               = flag.String("with-deps", "", "Write a JSON report of the constants of other packages the bound constants refer to, like other.Max in const Limit = other.Max")
+	indexFile              = flag.String("index", "", "Update a JSON index of the bound symbols of the generated packages in this file, for API search")
+	envByValue             = flag.Bool("env-vars-by-value", false, "Register the variables initialized from the environment, like os.Getenv, by value instead of by address")
+	validateConfig         = flag.Bool("validate-config", false, "Check the config, overlay, template, header and footer files, reporting all their problems, and exit without generating")
+	splitKinds             = flag.Bool("split-by-kind", false, "Split the constants, variables, types and functions into their own files, like <name>_const.go")
+	useGoimports           = flag.Bool("goimports", false, "Run the generated Go files through goimports, if found in PATH, after gofmt")
+	requireTag             = flag.String("require-tag", "", "Only export the declarations of the files requiring this build tag, like //go:build anko")
+	noteChannels           = flag.Bool("note-channels", false, "Note the direction of the channels returned by functions")
+	archive                = flag.String("archive", "", "Generate the packages of a module from its .zip or .tar.gz archive, read without extraction, instead of the module cache")
+	denyByDefault          = flag.Bool("deny-by-default", false, "Only export the symbols approved in the -baseline file, dropping the others instead of failing")
+	intersection           = flag.String("intersection", "", "Only export the symbols the package also exports at this other version of the module, so the bindings build with both")
+	symbolTable            = flag.Bool("symbol-table", false, "Emit the values of each package as a table sorted by name, searched by Lookup<Name>(path, name), instead of an env.Packages map")
+	bestEffort             = flag.Bool("best-effort", false, "Warn about the syntax errors of the source files and export the declarations that parse, instead of failing")
+	valueKind              = flag.String("value-kind", "reflect", "Type of the values of the env.Packages maps: reflect (reflect.Value) or interface (interface{}), for the Anko forks using the bare values")
+	changedSince           = flag.String("changed-since", "", "Only generate packages with Go files changed since the git ref")
+	tmpl                   = flag.String("template", "", "Template file (text/template) for the init function of each package")
+)
+
+// importReplacements holds the -replace-import old=new pairs.
+type importReplacements [][2]string
+
+func (r *importReplacements) String() string {
+	s := make([]string, len(*r))
+	for i, pair := range *r {
+		s[i] = pair[0] + "=" + pair[1]
+	}
+	return strings.Join(s, ",")
+}
+
+func (r *importReplacements) Set(value string) error {
+	i := strings.IndexByte(value, '=')
+	if i <= 0 || i == len(value)-1 {
+		return fmt.Errorf("want old=new, got %q", value)
+	}
+	*r = append(*r, [2]string{value[:i], value[i+1:]})
+	return nil
+}
+
+// apply rewrites the import path with the first replacement of it or of one
+// of its parents.
+func (r importReplacements) apply(path string) string {
+	for _, pair := range r {
+		if path == pair[0] || strings.HasPrefix(path, pair[0]+"/") {
+			return pair[1] + path[len(pair[0]):]
+		}
+	}
+	return path
+}
+
+var replaceImports importReplacements
+
+// ankoPackages are the import paths bound by github.com/mattn/anko/packages,
+// for -known-builtins anko.
+var ankoPackages = []string{
+	"bytes", "encoding/json", "errors", "flag", "fmt", "io", "io/ioutil", "log",
+	"math", "math/big", "math/rand", "net", "net/http", "net/url", "os", "os/exec",
+	"os/signal", "path", "path/filepath", "regexp", "runtime", "sort", "strconv",
+	"strings", "sync", "time", "unicode",
+}
+
+// builtins holds the import paths given to -known-builtins.
+var builtins = make(map[string]bool)
+
+// exportKinds holds the kinds of symbols selected by -kinds.
+var exportKinds = make(map[string]bool)
+
+func init() {
+	flag.Var(&replaceImports, "replace-import", "Rewrite the import paths old, and below, to new, as old=new (repeatable)")
+}
+
+// Exit codes, errors exit with 1 through log.Fatal.
+const (
+	exitUsage = 2 // invalid arguments
+	exitEmpty = 3 // nothing exported with -require-nonempty
 )
 
 func main() {
 	flag.Parse()
 
-	if *pkg == "" {
-		log.Fatal("Missing required argument: pkg (Package)")
+	// -pkg path@version
+	if i := strings.LastIndexByte(*pkg, '@'); i >= 0 {
+		if *ver != "" && *ver != (*pkg)[i+1:] {
+			usageError("Invalid argument: pkg " + *pkg + " and v " + *ver + " give different versions")
+		}
+		// set, rather than assigned, so that -emit-generate records -v too
+		path, version := (*pkg)[:i], (*pkg)[i+1:]
+		flag.Set("pkg", path)
+		flag.Set("v", version)
+	}
+
+	if *validateConfig {
+		os.Exit(validateConfigFiles())
+	}
+
+	if *conf != "" {
+		if err := loadConfig(*conf); err != nil {
+			log.Fatal(err)
+		}
+	}
+	listed := *std || *resolve || len(cfg.Packages) > 0 || *archive != ""
+
+	if *pkg == "" && !listed {
+		usageError("Missing required argument: pkg (Package)")
+	}
+	if *ver == "" && !listed {
+		usageError("Missing required argument: v (Version)")
 	}
-	if *ver == "" {
-		log.Fatal("Missing required argument: v (Version)")
+	if *resolve && flag.NArg() == 0 {
+		usageError("Missing required argument: import paths to resolve")
 	}
 	if *name == "" {
-		log.Fatal("Missing required argument: name")
+		usageError("Missing required argument: name")
+	}
+
+	if !token.IsIdentifier(*pkgClause) {
+		usageError("Invalid argument: package must be an identifier")
+	}
+
+	switch *outFormat {
+	case "go", "json":
+	default:
+		usageError("Invalid argument: format must be go or json")
+	}
+
+	if *emitString != "" {
+		if !token.IsIdentifier(*emitString) {
+			usageError("Invalid argument: emit-string must be an identifier")
+		}
+		if *platformList != "" {
+			usageError("Invalid argument: emit-string can't be used with platforms")
+		}
+	}
+
+	if *forceExport != "" {
+		for _, item := range strings.Split(*forceExport, ",") {
+			if token.IsExported(item) {
+				usageError(fmt.Sprintf("Invalid argument: force-export: %s is exported, and bound unless dropped (see -coverage)", item))
+			}
+		}
+		log.Printf("force-export %s: unexported identifiers can't be bound: the generated package can't refer to them, "+
+			"and reflect can only reach package-level declarations through such references. Export them, or export a wrapper from the package", *forceExport)
+		os.Exit(exitUsage)
+	}
+
+	if *externalTest {
+		log.Print("external-test: the symbols of an external foo_test package can't be bound: it's only built by go test, " +
+			"and no other package, the generated one included, can import it. Move the helpers scripts need into the package, " +
+			"or into a package of their own")
+		os.Exit(exitUsage)
+	}
+
+	if *check && *o == "-" {
+		usageError("Invalid argument: check compares with the files of the output dir, o can't be -")
+	}
+
+	if *packageName == "main" {
+		log.Print("warning: package-name main: Go doesn't allow importing main packages, the generated file won't build")
+	}
+	if *allowMain {
+		log.Print("warning: allow-main: Go doesn't allow importing main packages, bindings of one won't build")
+	}
+
+	if *byConstraint {
+		switch {
+		case *platformList != "":
+			usageError("Invalid argument: by-constraint can't be used with platforms")
+		case *shardCount > 1:
+			usageError("Invalid argument: by-constraint can't be used with shard")
+		case *emitString != "":
+			usageError("Invalid argument: by-constraint can't be used with emit-string")
+		}
+	}
+
+	if *jobs < 1 {
+		usageError("Invalid argument: j must be at least 1")
+	}
+	if *jobs > 1 && (*platformList != "" || *byConstraint) {
+		usageError("Invalid argument: j can't be used with platforms or by-constraint, which parse each package once per build context")
+	}
+
+	if *emitDeprecated {
+		switch {
+		case *platformList != "" || *byConstraint || *shardCount > 1:
+			usageError("Invalid argument: emit-deprecated-separately can't be used with platforms, by-constraint or shard")
+		case *tmpl != "":
+			usageError("Invalid argument: emit-deprecated-separately can't be used with template")
+		}
+	}
+
+	if *lazy {
+		switch {
+		case *platformList != "" || *byConstraint || *shardCount > 1:
+			usageError("Invalid argument: lazy can't be used with platforms, by-constraint or shard")
+		case *register || *importNameFlag:
+			usageError("Invalid argument: lazy can't be used with register or import-names")
+		}
+	}
+
+	if *symbolTable {
+		switch {
+		case *platformList != "" || *byConstraint || *shardCount > 1 || *splitKinds:
+			usageError("Invalid argument: symbol-table can't be used with platforms, by-constraint, shard or split-by-kind")
+		case *tmpl != "":
+			usageError("Invalid argument: symbol-table can't be used with template")
+		case *lazy || *importNameFlag:
+			usageError("Invalid argument: symbol-table can't be used with lazy or import-names")
+		}
+	}
+
+	if *splitKinds {
+		switch {
+		case *shardCount > 1:
+			usageError("Invalid argument: split-by-kind can't be used with shard")
+		case *platformList != "" || *byConstraint:
+			usageError("Invalid argument: split-by-kind can't be used with platforms or by-constraint")
+		case *emitString != "" || *tmpl != "":
+			usageError("Invalid argument: split-by-kind can't be used with emit-string or template")
+		case *emitNew || *converters || *typeNames || *typesForAll:
+			usageError("Invalid argument: split-by-kind can't be used with new, converters, type-names or emit-types-for-all")
+		case *lazy || *emitDeprecated:
+			usageError("Invalid argument: split-by-kind can't be used with lazy or emit-deprecated-separately")
+		}
+	}
+
+	if *shardCount > 1 {
+		switch {
+		case *platformList != "":
+			usageError("Invalid argument: shard can't be used with platforms")
+		case *emitString != "":
+			usageError("Invalid argument: shard can't be used with emit-string")
+		case *tmpl != "":
+			usageError("Invalid argument: shard can't be used with template")
+		case *emitNew || *converters || *typeNames:
+			usageError("Invalid argument: shard can't be used with new, converters or type-names")
+		}
+	}
+
+	if *knownBuiltins != "" {
+		for _, path := range strings.Split(*knownBuiltins, ",") {
+			if path == "anko" {
+				for _, path := range ankoPackages {
+					builtins[path] = true
+				}
+				continue
+			}
+			builtins[path] = true
+		}
+	}
+
+	for _, kind := range strings.Split(*kinds, ",") {
+		switch kind {
+		case "const", "var", "type", "func":
+			exportKinds[kind] = true
+		default:
+			usageError("Invalid argument: kinds must list const, var, type or func")
+		}
+	}
+
+	switch *stability {
+	case "stable", "beta", "all":
+	default:
+		usageError("Invalid argument: stability must be stable, beta or all")
+	}
+
+	switch *valueKind {
+	case "reflect":
+	case "interface":
+		switch {
+		case *platformList != "" || *byConstraint:
+			usageError("Invalid argument: value-kind interface can't be used with platforms or by-constraint")
+		case *symbolTable || *tmpl != "":
+			usageError("Invalid argument: value-kind interface can't be used with symbol-table or template")
+		}
+	default:
+		usageError("Invalid argument: value-kind must be reflect or interface")
+	}
+
+	switch *nonASCII {
+	case "keep", "skip", "ascii":
+	default:
+		usageError("Invalid argument: non-ascii must be keep, skip or ascii")
+	}
+
+	// selects the !cgo fallbacks of the files skipped by parseDir
+	if *noCgo {
+		buildContext.CgoEnabled = false
+	}
+	if *denyByDefault {
+		switch {
+		case *baseline == "":
+			usageError("Missing required argument: baseline, the approved symbols of deny-by-default")
+		case *updateBaseline:
+			usageError("Invalid argument: deny-by-default can't be used with update-baseline")
+		}
+		var err error
+		if approvedSymbols, err = readBaseline(*baseline); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *requireTag != "" {
+		if !isBuildTag(*requireTag) {
+			usageError("Invalid argument: require-tag must be a build tag")
+		}
+		buildContext.BuildTags = append(buildContext.BuildTags, *requireTag)
+	}
+	if *minGo != "" {
+		tags, err := releaseTags(*minGo)
+		if err != nil {
+			usageError("Invalid argument: min-go: " + err.Error())
+		}
+		buildContext.ReleaseTags = tags
+	}
+
+	if *ovl != "" {
+		if err := loadOverlay(*ovl); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *tmpl != "" {
+		if err := loadTemplate(*tmpl); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := readManualEntries(filepath.Join(*o, *name+".go")); err != nil {
+		log.Fatal(err)
 	}
 
 	_pkg := *pkg
@@ -57,57 +481,496 @@ func main() {
 
 	_name := strings.Title(*name)
 
+	var platforms []platform
+	var platformImports, platformSrcs []string
+	if *platformList != "" {
+		var err error
+		platforms, err = parsePlatforms(*platformList)
+		if err != nil {
+			log.Fatal(err)
+		}
+		platformImports = make([]string, len(platforms))
+		platformSrcs = make([]string, len(platforms))
+	}
+	inits := make(map[string]struct{})
+	var shardImports, shardSrcs []string
+	_, splitInits := splitFiles(initSuffix(_name))
+	if len(splitInits) > 0 {
+		shardImports = make([]string, len(splitInits))
+		shardSrcs = make([]string, len(splitInits))
+	}
+	// reserved for the split and platform files, not to be derived from a
+	// package; the constraint files are named once all are known
+	for _, s := range splitInits {
+		inits[s] = struct{}{}
+	}
+	if platforms != nil {
+		inits[initSuffix(_name)+"Platform"] = struct{}{}
+	}
+
 	importBuf := ""
+	for _, path := range cfg.Imports {
+		qualify(path, importName(path))
+		importBuf += importSpec(path)
+	}
 	initBuf := ""
 	srcBuf := ""
+	loaderBuf := ""
 
 	goMod, err := goEnv("GOMODCACHE")
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = filepath.Walk(filepath.Join(goMod, _pkg+"@"+*ver), func(path string, f os.FileInfo, err error) error {
+	seen := make(map[string]string)
+	var exported []string
+	// generateDir adds the bindings of the package path in dir, relative to
+	// the source root.
+	generateDir := func(root, _path, _dir, _init string) {
+		_path = replaceImports.apply(_path)
+		dir := filepath.Join(root, _dir)
+		if *changedSince != "" {
+			ok, err := changedPackage(dir, *changedSince)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if !ok {
+				return
+			}
+		}
+		if prev, ok := seen[_path]; ok {
+			infof("warning: %s is generated from %s already, skipping %s", _path, prev, dir)
+			return
+		}
+		if builtins[_path] {
+			infof("warning: %s is bound by the known builtins already: with both imported, the init running last replaces the other's bindings", _path)
+		}
+		_init = uniqueSuffix(inits, initSuffix(_init))
+		var src string
+		var err error
+		// bound is set when some code registers the package, which
+		// -register and -import-names list then
+		bound := false
+		if platforms != nil {
+			var srcs []string
+			src, srcs, err = exportPlatforms(root, _path, _dir, _init, initSuffix(_name), platforms)
+			for i, s := range srcs {
+				if s != "" {
+					bound = true
+					platformImports[i] += importSpec(_path)
+					platformSrcs[i] += s
+				}
+			}
+		} else if *byConstraint {
+			src, err = exportConstraints(root, _path, _dir, _init, initSuffix(_name))
+		} else {
+			var shards []string
+			src, shards, err = exportDeclaration(root, _path, _dir, _init, initSuffix(_name))
+			for i, s := range shards {
+				if s != "" {
+					bound = true
+					seen[_path] = dir
+					shardImports[i] += importSpec(_path)
+					shardSrcs[i] += s
+				}
+			}
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if bound || src != "" {
+			exported = append(exported, _path)
+		}
+		if src != "" {
+			seen[_path] = dir
+			importBuf += importSpec(_path)
+			initBuf += fmt.Sprintf("\tinit%s()\n", _init)
+			loaderBuf += fmt.Sprintf("\t%q: init%s,\n", _path, _init)
+			srcBuf += src
+		}
+	}
+	// exportDir queues the package path in dir, generated once all are
+	// listed so that -j parses the next ones ahead.
+	type packageDir struct{ root, path, dir, init string }
+	var queue []packageDir
+	exportDir := func(root, _path, _dir, _init string) {
+		queue = append(queue, packageDir{root, _path, _dir, _init})
+	}
+
+	if len(cfg.Packages) > 0 {
+		for _, p := range cfg.Packages {
+			_init := p.Init
+			if _init == "" {
+				_init = _name + strings.ReplaceAll(strings.Title(p.Path), "/", "")
+			}
+			exportDir(p.Dir, p.Path, ".", _init)
+		}
+	} else if *resolve {
+		pkgs, err := resolvePackages(flag.Args())
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, p := range pkgs {
+			exportDir(p.Dir, p.ImportPath, ".", _name+strings.ReplaceAll(strings.Title(p.ImportPath), "/", ""))
+		}
+	} else if *archive != "" {
+		// the files are under the archive, which can't be a directory
+		root, err := filepath.Abs(*archive)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dirs, modPath, err := loadArchive(*archive, root)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *pkg != "" {
+			modPath = *pkg
+		}
+		if modPath == "" {
+			usageError("Missing required argument: pkg (Package), the archive has no go.mod")
+		}
+		for _, dir := range dirs {
+			// skipped like the internal directories of the module walk
+			rel := filepath.ToSlash(dir)
+			if strings.HasSuffix(rel, "internal") || strings.Contains(rel, "internal/") {
+				continue
+			}
+			_path, _init := modPath, _name
+			if rel != "." {
+				_path += "/" + rel
+				_init += strings.ReplaceAll(strings.Title("/"+rel), "/", "")
+			}
+			exportDir(root, _path, dir, _init)
+		}
+	} else if *std {
+		goRoot, err := goEnv("GOROOT")
+		if err != nil {
+			log.Fatal(err)
+		}
+		paths, err := stdPackages()
 		if err != nil {
-			return err
+			log.Fatal(err)
+		}
+		for _, _path := range paths {
+			exportDir(filepath.Join(goRoot, "src"), _path, filepath.FromSlash(_path), _name+strings.ReplaceAll(strings.Title(_path), "/", ""))
+		}
+	} else {
+		root := filepath.Join(goMod, _pkg+"@"+*ver)
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			log.Fatalf("%s@%s isn't in the module cache, download it with: go mod download %s@%s", *pkg, *ver, *pkg, *ver)
 		}
 
-		if strings.HasSuffix(f.Name(), "internal") {
-			return filepath.SkipDir
+		sinceModule = root
+		if *intersection != "" {
+			if platforms != nil || *byConstraint {
+				usageError("Invalid argument: intersection can't be used with platforms or by-constraint")
+			}
+			intersectModule = filepath.Join(goMod, _pkg+"@"+*intersection)
+			if _, err := os.Stat(intersectModule); os.IsNotExist(err) {
+				log.Fatalf("%s@%s isn't in the module cache, download it with: go mod download %s@%s", *pkg, *intersection, *pkg, *intersection)
+			}
 		}
 
-		if f.IsDir() {
-			_dir := strings.Replace(path, goMod, "", 1)[1:]
-			_path := strings.Replace(strings.Replace(strings.ReplaceAll(_dir, "\\", "/"), "@"+*ver, "", 1), _pkg, *pkg, 1)
-			__init := strings.Split(_path, *pkg)
-			_init := _name
-			if len(__init) > 1 {
-				_init += strings.ReplaceAll(strings.Title(__init[1]), "/", "")
+		if *sinceVersion != "" {
+			if platforms != nil {
+				usageError("Invalid argument: since-version can't be used with platforms")
 			}
-			src, err := exportDeclaration(goMod, _path, _dir, _init)
+			sinceTree, err = downloadModule(filepath.Join(goMod, _pkg+"@"+*sinceVersion), *pkg, *sinceVersion)
 			if err != nil {
 				log.Fatal(err)
 			}
-			if src != "" {
-				importBuf += fmt.Sprintf("\t\"%s\"\n", _path)
-				initBuf += fmt.Sprintf("\tinit%s()\n", _init)
-				srcBuf += src
+		}
+
+		// walk the real directory, which filepath.Walk doesn't follow to
+		// when root is a symlink, but derive the paths from root
+		walkRoot := root
+		if *evalSymlinks {
+			walkRoot, err = filepath.EvalSymlinks(root)
+			if err != nil {
+				log.Fatal(err)
 			}
 		}
+		err = filepath.Walk(walkRoot, func(path string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(walkRoot, path)
+			if err != nil {
+				return err
+			}
+			path = filepath.Join(root, rel)
+
+			if strings.HasSuffix(f.Name(), "internal") {
+				return filepath.SkipDir
+			}
 
-		return nil
-	})
+			if f.IsDir() {
+				_dir := strings.Replace(path, goMod, "", 1)[1:]
+				_path := strings.Replace(strings.Replace(strings.ReplaceAll(_dir, "\\", "/"), "@"+*ver, "", 1), _pkg, *pkg, 1)
+				__init := strings.Split(_path, *pkg)
+				_init := _name
+				if len(__init) > 1 {
+					_init += strings.ReplaceAll(strings.Title(__init[1]), "/", "")
+				}
+				exportDir(goMod, _path, _dir, _init)
+			}
+
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	dirs := make([]string, len(queue))
+	for i, p := range queue {
+		dirs[i] = filepath.Join(p.root, p.dir)
+	}
+	done := parseAhead(dirs)
+	for i, p := range queue {
+		generateDir(p.root, p.path, p.dir, p.init)
+		done(i)
+	}
+	if *maxSymbols > 0 {
+		logLargest(5)
+	}
+	if *summary {
+		if err := writeSummary(os.Stderr); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *indexFile != "" {
+		if err := writeIndex(*indexFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *withDeps != "" {
+		if err := writeDeps(*withDeps); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *coverageFile != "" {
+		b, err := marshalCoverage()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := writeFile(*coverageFile, b); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *requireNonempty && len(descriptors) == 0 {
+		if n := filteredCount(); n > 0 {
+			log.Printf("no symbols exported for %s/%s, %d are only exported on other platforms", buildContext.GOOS, buildContext.GOARCH, n)
+			os.Exit(exitEmpty)
+		}
+		log.Print("no symbols exported")
+		os.Exit(exitEmpty)
+	}
+	if *verify != "" {
+		if err := verifyBindings(*verify); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *baseline != "" {
+		if err := checkBaseline(*baseline, *updateBaseline); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *outFormat == "json" {
+		src, err := marshalDescriptors()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := writeOutput(*name+".json", src); err != nil {
+			log.Fatal(err)
+		}
+		exitOutdated()
+		return
+	}
+
+	if platforms != nil {
+		initBuf += fmt.Sprintf("\tinit%sPlatform()\n", initSuffix(_name))
+		srcBuf += fmt.Sprintf(platformHelpersTemplate, initSuffix(_name), valueType())
+	}
+	var constraintInits []string
+	if len(constraints.exprs) > 0 {
+		for i := range constraints.exprs {
+			s := uniqueSuffix(inits, fmt.Sprintf("%sConstraint%d", initSuffix(_name), i+1))
+			constraintInits = append(constraintInits, s)
+			initBuf += fmt.Sprintf("\tinit%s()\n", s)
+		}
+		srcBuf += fmt.Sprintf(platformHelpersTemplate, initSuffix(_name), valueType())
+	}
+	if shardSrcs != nil {
+		for _, s := range splitInits {
+			initBuf += fmt.Sprintf("\tinit%s()\n", s)
+		}
+		srcBuf += fmt.Sprintf(platformHelpersTemplate, initSuffix(_name), valueType())
+	}
+	if *importNameFlag {
+		initBuf += importNames(exported)
+	}
+
+	initFunc := fmt.Sprintf(initFuncTemplate, initBuf)
+	if *register {
+		q := qualify("fmt", "fmt")
+		if _, ok := seen["fmt"]; !ok && !contains(cfg.Imports, "fmt") {
+			importBuf += importSpec("fmt")
+		}
+		paths := ""
+		for _, path := range exported {
+			paths += fmt.Sprintf("\t\t%q,\n", path)
+		}
+		initFunc = fmt.Sprintf(registerFuncTemplate, initSuffix(_name), paths, q, initBuf)
+	}
+	if *lazy {
+		initFunc = fmt.Sprintf(lazyFuncTemplate, initSuffix(_name), loaderBuf)
+	}
+	if *symbolTable {
+		q := qualify("sort", "sort")
+		if _, ok := seen["sort"]; !ok && !contains(cfg.Imports, "sort") {
+			importBuf += importSpec("sort")
+		}
+		srcBuf += fmt.Sprintf(symbolTableTemplate, tableSuffix(), q)
+	}
+	src, err := format.Source([]byte(fmt.Sprintf(fileTemplate[1:], runArgs(), *pkgClause, importBuf, initFunc, srcBuf)))
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	src, err := format.Source([]byte(fmt.Sprintf(template[1:], strings.Join(os.Args[1:], " "), importBuf, initBuf, srcBuf)))
+	src, err = addHeaderFooter(src)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *emitString != "" {
+		src, err = wrapString(*emitString, src)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 	// print and save code
-	fmt.Println(string(src))
-	os.MkdirAll(*o, 0777)
-	os.WriteFile(filepath.Join(*o, *name+".go"), src, 0644)
+	if err := writeOutput(*name+".go", src); err != nil {
+		log.Fatal(err)
+	}
+
+	if *emitGenerate {
+		if err := writeGenerateFile(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if len(constraints.exprs) > 0 {
+		if err := writeConstraintFiles(constraintInits); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if shardSrcs != nil {
+		if err := writeSplitFiles(initSuffix(_name), shardImports, shardSrcs); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if platforms != nil {
+		if err := writePlatformFiles(platforms, initSuffix(_name), platformImports, platformSrcs); err != nil {
+			log.Fatal(err)
+		}
+	}
+	exitOutdated()
+}
+
+// exitOutdated exits with status 1 when -check found outdated files.
+func exitOutdated() {
+	if outdated {
+		os.Exit(1)
+	}
+}
+
+// isBuildTag reports whether s is a valid build tag, made of letters,
+// digits, underscores and dots.
+func isBuildTag(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// releaseTags returns the release tags a toolchain of the Go version v,
+// like "1.21" or "go1.21.3", satisfies: go1.1 through go1.<minor of v>, so
+// go1.1 through go1.21 for both. The patch version is ignored.
+func releaseTags(v string) ([]string, error) {
+	s := strings.TrimPrefix(v, "go")
+	if !strings.HasPrefix(s, "1.") {
+		return nil, fmt.Errorf("%q isn't a Go 1 version", v)
+	}
+	s = s[len("1."):]
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s = s[:i]
+	}
+	minor, err := strconv.Atoi(s)
+	if err != nil || minor < 0 {
+		return nil, fmt.Errorf("%q isn't a Go 1 version", v)
+	}
+	tags := make([]string, 0, minor)
+	for i := 1; i <= minor; i++ {
+		tags = append(tags, "go1."+strconv.Itoa(i))
+	}
+	return tags, nil
+}
+
+func usageError(msg string) {
+	log.Print(msg)
+	os.Exit(exitUsage)
+}
+
+// infof logs informational output such as warnings, unless -quiet is set.
+func infof(format string, a ...interface{}) {
+	if !*quiet {
+		log.Printf(format, a...)
+	}
+}
+
+// initSuffix turns s into a valid identifier suffix for the init function,
+// dropping the characters that can't appear in an identifier and
+// capitalizing the letter following them, e.g. "Go-junit.report" becomes
+// "GoJunitReport".
+func initSuffix(s string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			if upper {
+				r = unicode.ToUpper(r)
+				upper = false
+			}
+			if b.Len() == 0 && !unicode.IsLetter(r) {
+				b.WriteByte('X')
+			}
+			b.WriteRune(r)
+		default:
+			upper = true
+		}
+	}
+	return b.String()
+}
+
+// uniqueSuffix returns s, or s followed by the smallest number from 2 not
+// used yet, as different packages may derive the same init suffix, e.g.
+// "a/b-c" and "a/b/c", or the one of a shard, platform or constraint file.
+// The returned suffix is added to used.
+func uniqueSuffix(used map[string]struct{}, s string) string {
+	suffix := s
+	for i := 2; ; i++ {
+		if _, ok := used[suffix]; !ok {
+			break
+		}
+		suffix = s + strconv.Itoa(i)
+	}
+	used[suffix] = struct{}{}
+	return suffix
 }
 
 func goEnv(name string) (string, error) {
@@ -117,3 +980,151 @@ func goEnv(name string) (string, error) {
 	}
 	return strings.TrimSpace(string(output)), nil
 }
+
+// changedPackage reports whether Go files of dir, not of its
+// subdirectories, changed since the git ref. dir must be in a git work
+// tree, which the module cache and archives aren't.
+func changedPackage(dir, ref string) (bool, error) {
+	cmd := exec.Command("git", "rev-parse", "--is-inside-work-tree")
+	cmd.Dir = dir
+	if output, err := cmd.Output(); err != nil || strings.TrimSpace(string(output)) != "true" {
+		return false, fmt.Errorf("changed-since: %s isn't in a git work tree, generate the packages of a checkout with -resolve or the packages of -config", dir)
+	}
+	cmd = exec.Command("git", "diff", "--name-only", "--relative", ref, "--", ".")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("git diff %s: %v", ref, err)
+	}
+	for _, name := range strings.Split(string(output), "\n") {
+		if strings.HasSuffix(name, ".go") && !strings.Contains(name, "/") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// stdPackages returns the standard library packages that can be bound, as
+// listed by go list std, leaving out the internal and vendored packages and
+// unsafe, whose functions are builtins without a value.
+func stdPackages() ([]string, error) {
+	output, err := exec.Command("go", "list", "std").Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list std: %v", err)
+	}
+	var paths []string
+	for _, path := range strings.Fields(string(output)) {
+		if path == "unsafe" || strings.HasPrefix(path, "vendor/") || path == "internal" || strings.HasPrefix(path, "internal/") ||
+			strings.HasSuffix(path, "/internal") || strings.Contains(path, "/internal/") {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// listedPackage is the part of the go list -json output of a package used
+// by -resolve.
+type listedPackage struct {
+	ImportPath string
+	Dir        string
+}
+
+// resolvePackages runs go list on the import paths or patterns and returns
+// the packages found, leaving out the internal ones.
+func resolvePackages(patterns []string) ([]listedPackage, error) {
+	output, err := exec.Command("go", append([]string{"list", "-json"}, patterns...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %v", err)
+	}
+	var pkgs []listedPackage
+	dec := json.NewDecoder(bytes.NewReader(output))
+	for dec.More() {
+		var p listedPackage
+		if err := dec.Decode(&p); err != nil {
+			return nil, err
+		}
+		if elems := strings.Split(p.ImportPath, "/"); contains(elems, "internal") {
+			continue
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+func contains(s []string, x string) bool {
+	for _, item := range s {
+		if item == x {
+			return true
+		}
+	}
+	return false
+}
+
+// listErrors runs go list in dir and returns the errors of the packages that
+// can't be found.
+func listErrors(dir string, imports []string) ([]string, error) {
+	args := append([]string{"list", "-e", "-find", "-f", "{{if .Error}}{{.ImportPath}}: {{.Error}}{{end}}"}, imports...)
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var errs []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			errs = append(errs, line)
+		}
+	}
+	return errs, nil
+}
+
+// wrapString returns a file declaring the generated code src as the raw
+// string constant name. Backquotes, which can't appear in a raw string, are
+// concatenated as interpreted strings.
+func wrapString(name string, src []byte) ([]byte, error) {
+	lit := "`" + strings.ReplaceAll(string(src), "`", "` + \"`\" + `") + "`"
+	code := fmt.Sprintf("// Code generated by anko-package-gen2 %s. DO NOT EDIT.\n\npackage %s\n\nconst %s = %s\n",
+		runArgs(), *pkgClause, name, lit)
+	if _, err := parser.ParseFile(token.NewFileSet(), "", code, 0); err != nil {
+		return nil, fmt.Errorf("wrapping as a string: %v", err)
+	}
+	return []byte(code), nil
+}
+
+// addHeaderFooter wraps src with the -header-file and -footer-file contents
+// and checks the result is still valid Go.
+func addHeaderFooter(src []byte) ([]byte, error) {
+	if *headerFile == "" && *footerFile == "" {
+		return src, nil
+	}
+	header, err := readLines(*headerFile)
+	if err != nil {
+		return nil, err
+	}
+	footer, err := readLines(*footerFile)
+	if err != nil {
+		return nil, err
+	}
+	out := append(append(header, src...), footer...)
+	if _, err := format.Source(out); err != nil {
+		return nil, fmt.Errorf("invalid header or footer: %v", err)
+	}
+	return out, nil
+}
+
+// readLines reads the file, if any, making sure it ends with a newline.
+func readLines(name string) ([]byte, error) {
+	if name == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		b = append(b, '\n')
+	}
+	return b, nil
+}
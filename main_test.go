@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// generator is the binary built by TestMain, run by the tests like users
+// do: main keeps its settings in flags and globals.
+var generator string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "anko-package-gen2")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	generator = filepath.Join(dir, "anko-package-gen2")
+	if runtime.GOOS == "windows" {
+		generator += ".exe"
+	}
+	if output, err := exec.Command("go", "build", "-o", generator, ".").CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "building the generator: %v\n%s", err, output)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testdataMod is the module cache of the fixture modules of testdata. The
+// files are walked so that go test caches the results for them, read by
+// the generator only.
+func testdataMod(t testing.TB) string {
+	dir, err := filepath.Abs(filepath.Join("testdata", "mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	readFiles(t, dir)
+	return dir
+}
+
+// writeModule writes the files of a module example.com/<name> at v1.0.0
+// into a new module cache, adding its go.mod, and returns the cache.
+func writeModule(t testing.TB, name string, files map[string]string) string {
+	cache := t.TempDir()
+	dir := filepath.Join(cache, "example.com", name+"@v1.0.0")
+	files["go.mod"] = "module example.com/" + name + "\n\ngo 1.21\n"
+	writeFiles(t, dir, files)
+	return cache
+}
+
+func writeFiles(t testing.TB, dir string, files map[string]string) {
+	for name, src := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// run is a run of the generator, in a new working directory.
+type run struct {
+	dir            string
+	stdout, stderr string
+	err            error
+}
+
+// exitCode returns the exit status of a run that failed with err, or 0.
+func exitCode(err error) int {
+	if exit, ok := err.(*exec.ExitError); ok {
+		return exit.ExitCode()
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+// runGenerator runs the generator with args in a new working directory
+// holding files, at the module cache cache, for linux/amd64 unless env
+// says otherwise.
+func runGenerator(t testing.TB, cache string, files map[string]string, env []string, args ...string) *run {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, files)
+	return runIn(dir, cache, env, args...)
+}
+
+// runIn runs the generator with args in the working directory dir.
+func runIn(dir, cache string, env []string, args ...string) *run {
+	cmd := exec.Command(generator, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOMODCACHE="+cache, "GOOS=linux", "GOARCH=amd64", "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	cmd.Env = append(cmd.Env, env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return &run{dir: dir, stdout: stdout.String(), stderr: stderr.String(), err: err}
+}
+
+// generate runs the generator on the module example.com/<mod> of cache,
+// failing the test on an error, and returns the written files by name.
+func generate(t testing.TB, cache, mod string, files map[string]string, args ...string) map[string]string {
+	t.Helper()
+	r := runGenerator(t, cache, files, nil, append([]string{"-pkg", "example.com/" + mod, "-v", "v1.0.0", "-name", mod, "-quiet"}, args...)...)
+	if r.err != nil {
+		t.Fatalf("generating %s %s: %v\n%s", mod, strings.Join(args, " "), r.err, r.stderr)
+	}
+	return r.output(t)
+}
+
+// output returns the files the run wrote to anko-packages by name.
+func (r *run) output(t testing.TB) map[string]string {
+	t.Helper()
+	return readFiles(t, filepath.Join(r.dir, "anko-packages"))
+}
+
+func readFiles(t testing.TB, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// entry is an entry of a generated map literal.
+type entry struct {
+	key, value string
+	group      string // the section or group comment above the entry
+}
+
+// mapEntries returns the entries of the literals assigned to
+// env.<m>["path"] in the files, or given to the add<Name><m>("path", ...)
+// helpers of -platforms, in order.
+func mapEntries(t testing.TB, files map[string]string, m, path string) []entry {
+	t.Helper()
+	var entries []entry
+	for _, name := range sortedNames(files) {
+		if !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, name, files[name], parser.ParseComments)
+		if err != nil {
+			t.Fatalf("parsing %s: %v", name, err)
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			var lit *ast.CompositeLit
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				if len(n.Lhs) == 1 && isMapIndex(n.Lhs[0], m, path) {
+					lit, _ = n.Rhs[0].(*ast.CompositeLit)
+				}
+			case *ast.CallExpr:
+				if id, ok := n.Fun.(*ast.Ident); ok && strings.HasPrefix(id.Name, "add") && strings.HasSuffix(id.Name, m) && len(n.Args) == 2 && unquote(n.Args[0]) == path {
+					lit, _ = n.Args[1].(*ast.CompositeLit)
+				}
+			}
+			if lit != nil {
+				entries = append(entries, literalEntries(fset, file, files[name], lit)...)
+			}
+			return true
+		})
+	}
+	return entries
+}
+
+func isMapIndex(expr ast.Expr, m, path string) bool {
+	index, ok := expr.(*ast.IndexExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := index.X.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == m && unquote(index.Index) == path
+}
+
+func unquote(expr ast.Expr) string {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return ""
+	}
+	s, _ := strconv.Unquote(lit.Value)
+	return s
+}
+
+// literalEntries returns the entries of lit, with their group: the text of
+// the last section or group header above them.
+func literalEntries(fset *token.FileSet, file *ast.File, src string, lit *ast.CompositeLit) []entry {
+	var comments []*ast.Comment
+	for _, g := range file.Comments {
+		if g.Pos() > lit.Lbrace && g.End() < lit.Rbrace {
+			comments = append(comments, g.List...)
+		}
+	}
+	var entries []entry
+	group := ""
+	lbrace := fset.Position(lit.Lbrace).Line
+	prev := lbrace
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		for len(comments) > 0 && comments[0].Pos() < kv.Pos() {
+			// the headers follow the brace or a blank line, while the
+			// docs of -with-docs directly precede the entries
+			if line := fset.Position(comments[0].Pos()).Line; line == lbrace+1 && prev == lbrace || line > prev+1 {
+				group = strings.TrimSpace(strings.TrimPrefix(comments[0].Text, "//"))
+			}
+			prev = fset.Position(comments[0].End()).Line
+			comments = comments[1:]
+		}
+		prev = fset.Position(kv.End()).Line
+		entries = append(entries, entry{
+			key:   unquote(kv.Key),
+			value: src[fset.Position(kv.Value.Pos()).Offset:fset.Position(kv.Value.End()).Offset],
+			group: group,
+		})
+	}
+	return entries
+}
+
+// values returns the values of the entries by key.
+func values(entries []entry) map[string]string {
+	m := make(map[string]string, len(entries))
+	for _, e := range entries {
+		m[e.key] = e.value
+	}
+	return m
+}
+
+func keys(entries []entry) []string {
+	s := make([]string, len(entries))
+	for i, e := range entries {
+		s[i] = e.key
+	}
+	return s
+}
+
+func sortedNames(files map[string]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compile builds the generated Go files as the package of a consumer
+// module, with the env stub of testdata/<env> as github.com/mattn/anko,
+// and the modules of cache it imports, for each GOOS.
+func compile(t testing.TB, files map[string]string, env, cache string, modules []string, goos ...string) {
+	t.Helper()
+	dir := consumer(t, files, env, cache, modules)
+	if len(goos) == 0 {
+		goos = []string{"linux"}
+	}
+	for _, goos := range goos {
+		cmd := exec.Command("go", "vet", "./...")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH=amd64", "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("building the generated files for %s: %v\n%s", goos, err, output)
+		}
+	}
+}
+
+// execute runs the program main of the consumer module holding the
+// generated files, which it imports as consumer/packages, and returns its
+// output.
+func execute(t testing.TB, files map[string]string, env, cache string, modules []string, main string) string {
+	t.Helper()
+	dir := consumer(t, files, env, cache, modules)
+	writeFiles(t, dir, map[string]string{"main.go": main})
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("running the consumer: %v\n%s", err, output)
+	}
+	return string(output)
+}
+
+// consumer writes the consumer module of compile and execute, and returns
+// its directory.
+func consumer(t testing.TB, files map[string]string, env, cache string, modules []string) string {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+	stub, err := filepath.Abs(filepath.Join("testdata", env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gomod := "module consumer\n\ngo 1.21\n\nrequire github.com/mattn/anko v0.0.0\n\nreplace github.com/mattn/anko => " + stub + "\n"
+	for _, mod := range modules {
+		gomod += fmt.Sprintf("\nrequire example.com/%[1]s v1.0.0\n\nreplace example.com/%[1]s => %[2]s\n", mod, filepath.Join(cache, "example.com", mod+"@v1.0.0"))
+	}
+	dir := t.TempDir()
+	module := map[string]string{"go.mod": gomod}
+	for name, src := range files {
+		if strings.HasSuffix(name, ".go") {
+			module["packages/"+name] = src
+		}
+	}
+	writeFiles(t, dir, module)
+	return dir
+}
+
+// TestExportedPackages checks that -register and -import-names only list
+// the packages with generated code: a package exporting nothing has no init
+// to call, nor its import name to claim.
+func TestExportedPackages(t *testing.T) {
+	cache := writeModule(t, "reg", map[string]string{
+		"util/util.go":     "package util\n\nfunc Do() {}\n",
+		"old/util/util.go": "package util\n\nfunc do() {}\n",
+		"split/split.go":   "package split\n\nconst A = 1\n\nvar Z = 2\n",
+	})
+	for _, args := range [][]string{
+		{"-register", "-import-names"},
+		{"-register", "-import-names", "-shard", "2"},
+		{"-register", "-import-names", "-split-by-kind"},
+	} {
+		files := generate(t, cache, "reg", nil, args...)
+		src := files["reg.go"]
+		for _, path := range []string{"example.com/reg/util", "example.com/reg/split"} {
+			if !strings.Contains(src, strconv.Quote(path)+",") {
+				t.Errorf("%s: %s isn't registered:\n%s", strings.Join(args, " "), path, src)
+			}
+		}
+		if strings.Contains(src, `"example.com/reg/old/util"`) {
+			t.Errorf("%s: the empty example.com/reg/old/util is registered:\n%s", strings.Join(args, " "), src)
+		}
+		if !strings.Contains(src, `env.Packages["util"]`) {
+			t.Errorf("%s: the import name util isn't registered:\n%s", strings.Join(args, " "), src)
+		}
+		compile(t, files, "anko", cache, []string{"reg"})
+	}
+}
+
+// TestChangedSince checks that -changed-since only generates the packages
+// of a git checkout with Go files changed since the ref, and fails clearly
+// on the module cache, which isn't a checkout.
+func TestChangedSince(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":            "module example.com/checkout\n\ngo 1.21\n",
+		"same/same.go":      "package same\n\nfunc Same() {}\n",
+		"edited/edited.go":  "package edited\n\nfunc Edited() {}\n",
+		"outer/outer.go":    "package outer\n\nfunc Outer() {}\n",
+		"outer/inner/in.go": "package inner\n\nfunc Inner() {}\n",
+		"packages.json":     `{"packages": [{"dir": "same", "path": "example.com/checkout/same"}, {"dir": "edited", "path": "example.com/checkout/edited"}, {"dir": "outer", "path": "example.com/checkout/outer"}]}`,
+	})
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+		}
+	}
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	writeFiles(t, dir, map[string]string{
+		"edited/edited.go":  "package edited\n\nfunc Edited() {}\n\nfunc Added() {}\n",
+		"outer/inner/in.go": "package inner\n\nfunc Inner() {}\n\nfunc Added() {}\n",
+	})
+
+	cache := t.TempDir()
+	for _, args := range [][]string{
+		{"-resolve", "./..."},
+		{"-config", "packages.json"},
+	} {
+		r := runIn(dir, cache, nil, append([]string{"-name", "checkout", "-quiet", "-changed-since", "HEAD"}, args...)...)
+		if r.err != nil {
+			t.Fatalf("%s: %v\n%s", strings.Join(args, " "), r.err, r.stderr)
+		}
+		src := r.output(t)["checkout.go"]
+		for path, want := range map[string]bool{
+			"example.com/checkout/same":   false,
+			"example.com/checkout/edited": true,
+			// the changed files are in a subdirectory
+			"example.com/checkout/outer": false,
+		} {
+			if got := strings.Contains(src, strconv.Quote(path)); got != want {
+				t.Errorf("%s: %s generated = %v, want %v:\n%s", strings.Join(args, " "), path, got, want, src)
+			}
+		}
+		if got := strings.Contains(src, `"example.com/checkout/outer/inner"`); got != (args[0] == "-resolve") {
+			t.Errorf("%s: example.com/checkout/outer/inner generated = %v:\n%s", strings.Join(args, " "), got, src)
+		}
+	}
+
+	cache = writeModule(t, "cached", map[string]string{"cached.go": "package cached\n\nfunc F() {}\n"})
+	r := runGenerator(t, cache, nil, nil, "-pkg", "example.com/cached", "-v", "v1.0.0", "-name", "cached", "-changed-since", "HEAD")
+	if r.err == nil || !strings.Contains(r.stderr, "isn't in a git work tree") {
+		t.Errorf("error %v on the module cache, want it isn't a work tree:\n%s", r.err, r.stderr)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// manualEntries holds the hand-added entries of a previously generated file,
+// keyed by map ("Packages", "PackageTypes", ...) and then import path. An
+// entry is hand-added when its line ends with a comment starting with
+// "manual", e.g. `"Extra": reflect.ValueOf(extra), // manual`.
+var manualEntries = make(map[string]map[string][]manualEntry)
+
+type manualEntry struct {
+	key  string // map key
+	text string // source of the entry, including its comment
+}
+
+// readManualEntries collects the hand-added entries of the generated file,
+// if it exists, so regeneration preserves them.
+func readManualEntries(filename string) error {
+	src, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	comments := make(map[int]*ast.Comment)
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			comments[fset.Position(c.Pos()).Line] = c
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+			return true
+		}
+		m, path, ok := envIndex(assign.Lhs[0])
+		if !ok {
+			return true
+		}
+		lit, ok := assign.Rhs[0].(*ast.CompositeLit)
+		if !ok {
+			return true
+		}
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			key, ok := stringLit(kv.Key)
+			if !ok {
+				continue
+			}
+			c := comments[fset.Position(kv.End()).Line]
+			if c == nil || c.Pos() < kv.End() || !strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(c.Text, "//")), "manual") {
+				continue
+			}
+			text := string(src[fset.Position(kv.Pos()).Offset:fset.Position(kv.End()).Offset]) + ", " + c.Text
+			if manualEntries[m] == nil {
+				manualEntries[m] = make(map[string][]manualEntry)
+			}
+			manualEntries[m][path] = append(manualEntries[m][path], manualEntry{key: key, text: text})
+		}
+		return false
+	})
+	return nil
+}
+
+// envIndex matches env.<Map>["path"].
+func envIndex(expr ast.Expr) (m, path string, ok bool) {
+	index, ok := expr.(*ast.IndexExpr)
+	if !ok {
+		return "", "", false
+	}
+	sel, ok := index.X.(*ast.SelectorExpr)
+	if !ok {
+		return "", "", false
+	}
+	if x, ok := sel.X.(*ast.Ident); !ok || x.Name != "env" {
+		return "", "", false
+	}
+	path, ok = stringLit(index.Index)
+	return sel.Sel.Name, path, ok
+}
+
+func stringLit(expr ast.Expr) (string, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+// dropManual drops the symbols overridden by hand-added entries.
+func dropManual(m, path string, syms map[string]*symbol) {
+	for _, e := range manualEntries[m][path] {
+		if sym := syms[e.key]; sym != nil {
+			sym.dropped = "manual entry"
+		}
+	}
+}
+
+// manualText returns the hand-added entries of a map, one per line.
+func manualText(m, path string) string {
+	var b strings.Builder
+	for _, e := range manualEntries[m][path] {
+		b.WriteString(tabs + e.text + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// overlay maps absolute file names to contents that replace the files on
+// disk, like the Overlay of go/packages. Files that don't exist on disk are
+// added to their directory and a nil content hides the file.
+var overlay map[string][]byte
+
+// loadOverlay reads a JSON file in the format accepted by go build -overlay.
+func loadOverlay(name string) error {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	var v struct {
+		Replace map[string]string
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	overlay = make(map[string][]byte, len(v.Replace))
+	for from, to := range v.Replace {
+		from, err := filepath.Abs(from)
+		if err != nil {
+			return err
+		}
+		if to == "" {
+			overlay[from] = nil
+			continue
+		}
+		src, err := os.ReadFile(to)
+		if err != nil {
+			return err
+		}
+		overlay[from] = src
+	}
+	return nil
+}
+
+func openFile(path string) (io.ReadCloser, error) {
+	if src, ok := overlay[path]; ok {
+		if src == nil {
+			return nil, os.ErrNotExist
+		}
+		return io.NopCloser(bytes.NewReader(src)), nil
+	}
+	return os.Open(path)
+}
+
+func readFile(path string) ([]byte, error) {
+	if src, ok := overlay[path]; ok {
+		if src == nil {
+			return nil, os.ErrNotExist
+		}
+		return src, nil
+	}
+	return os.ReadFile(path)
+}
+
+// readDirNames lists the file names of dir, including overlay files. A dir
+// that only exists in the overlay, like the ones of -archive, lists them.
+func readDirNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !overlayDir(dir) {
+		return nil, err
+	}
+	seen := make(map[string]struct{}, len(entries))
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if src, ok := overlay[filepath.Join(dir, e.Name())]; ok && src == nil {
+			continue
+		}
+		seen[e.Name()] = struct{}{}
+		names = append(names, e.Name())
+	}
+	for path, src := range overlay {
+		if src == nil || filepath.Dir(path) != dir {
+			continue
+		}
+		if _, ok := seen[filepath.Base(path)]; !ok {
+			names = append(names, filepath.Base(path))
+		}
+	}
+	// in a stable order, like os.ReadDir, rather than the one of the map
+	sort.Strings(names)
+	return names, nil
+}
+
+// overlayDir reports whether the overlay adds files to dir.
+func overlayDir(dir string) bool {
+	for path, src := range overlay {
+		if src != nil && filepath.Dir(path) == dir {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"runtime"
+	"strings"
+)
+
+const (
+	// helpers of the main file adding platform-specific symbols
+	platformHelpersTemplate = `
+func add%[1]sPackages(path string, m map[string]%[2]s) {
+	if env.Packages[path] == nil {
+		env.Packages[path] = make(map[string]%[2]s)
+	}
+	for k, v := range m {
+		env.Packages[path][k] = v
+	}
+}
+
+func add%[1]sPackageTypes(path string, m map[string]reflect.Type) {
+	if env.PackageTypes[path] == nil {
+		env.PackageTypes[path] = make(map[string]reflect.Type)
+	}
+	for k, v := range m {
+		env.PackageTypes[path][k] = v
+	}
+}
+`
+
+	platformFileTemplate = `
+//go:build %s
+
+// Code generated by anko-package-gen2 %s. DO NOT EDIT.
+
+package %s
+
+import (
+	"reflect"
+
+%s)
+
+func init%sPlatform() {
+%s}
+`
+
+	otherFileTemplate = `
+//go:build %s
+
+// Code generated by anko-package-gen2 %s. DO NOT EDIT.
+
+package %s
+
+func init%sPlatform() {}
+`
+
+	platformPackagesTemplate = `	add%sPackages("%s", map[string]%s{
+%s	})
+`
+
+	platformPackageTypesTemplate = `	add%sPackageTypes("%s", map[string]reflect.Type{
+%s	})
+`
+)
+
+// platform is a GOOS/GOARCH pair given to -platforms.
+type platform struct {
+	goos, goarch string
+}
+
+func (p platform) String() string {
+	return p.goos + "/" + p.goarch
+}
+
+// constraint returns the build constraint selecting the platform.
+func (p platform) constraint() string {
+	return p.goos + " && " + p.goarch
+}
+
+func parsePlatforms(s string) ([]platform, error) {
+	var platforms []platform
+	for _, item := range strings.Split(s, ",") {
+		i := strings.IndexByte(item, '/')
+		if i <= 0 || i == len(item)-1 {
+			return nil, fmt.Errorf("invalid platform %q, want GOOS/GOARCH", item)
+		}
+		platforms = append(platforms, platform{item[:i], item[i+1:]})
+	}
+	return platforms, nil
+}
+
+// otherConstraint selects every platform not listed.
+func otherConstraint(platforms []platform) string {
+	s := make([]string, len(platforms))
+	for i, p := range platforms {
+		s[i] = "!(" + p.constraint() + ")"
+	}
+	return strings.Join(s, " && ")
+}
+
+// exportPlatforms collects the package for each platform. The symbols
+// defined on every platform are generated like exportDeclaration does,
+// while the others are returned per platform, registered by the build
+// tagged platform files.
+func exportPlatforms(root, path, dir, init, fileName string, platforms []platform) (string, []string, error) {
+	goos, goarch, cgo := buildContext.GOOS, buildContext.GOARCH, buildContext.CgoEnabled
+	defer func() {
+		buildContext.GOOS, buildContext.GOARCH, buildContext.CgoEnabled = goos, goarch, cgo
+	}()
+	decls := make([]*declaration, len(platforms))
+	for i, p := range platforms {
+		buildContext.GOOS, buildContext.GOARCH = p.goos, p.goarch
+		// like go build, cgo is disabled when cross-compiling unless
+		// CGO_ENABLED=1 asks for it
+		buildContext.CgoEnabled = cgo && (p.goos == runtime.GOOS && p.goarch == runtime.GOARCH || os.Getenv("CGO_ENABLED") == "1")
+		d, err := collectDeclaration(root, path, dir, init)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %v", p, err)
+		}
+		if d != nil && d.skipped != "" {
+			d = nil
+		}
+		decls[i] = d
+	}
+
+	var common, union *declaration
+	for _, d := range decls {
+		if d == nil {
+			continue
+		}
+		if common == nil {
+			// the common symbols are declared by the source of any platform
+			common = &declaration{path: d.path, name: d.name, init: d.init, fset: d.fset, files: d.files}
+			union = &declaration{path: d.path, name: d.name, init: d.init}
+		}
+		union.merge(d)
+	}
+	if common == nil {
+		return "", make([]string, len(platforms)), nil
+	}
+	for k, syms := range union.kinds() {
+		*common.kinds()[k] = filterSymbols(*syms, func(sym *symbol) bool {
+			for _, d := range decls {
+				if d == nil || !hasSymbol(*d.kinds()[k], sym.name) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	if !union.empty() {
+		if err := union.record(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	code := make([]string, len(platforms))
+	for i, d := range decls {
+		if d == nil {
+			continue
+		}
+		only := &declaration{path: d.path, name: d.name}
+		for k, syms := range d.kinds() {
+			*only.kinds()[k] = filterSymbols(*syms, func(sym *symbol) bool {
+				return !hasSymbol(*common.kinds()[k], sym.name)
+			})
+			for _, sym := range *only.kinds()[k] {
+				sym.notes = append(sym.notes, "defined on "+definingPlatforms(platforms, decls, k, sym.name))
+			}
+		}
+		code[i] = only.addCode(fileName)
+	}
+
+	if common.empty() {
+		return "", code, nil
+	}
+	src, err := common.generate()
+	return src, code, err
+}
+
+// addCode returns the code adding the symbols of d to the binding maps
+// through the helpers of platformHelpersTemplate named after fileName.
+func (d *declaration) addCode(fileName string) string {
+	bindKeys(boundKeys.Packages, d.path, d.constants, d.variables, d.functions)
+	bindKeys(boundKeys.PackageTypes, d.path, d.types, funcTypes(d.functions))
+	name := qualify(d.path, d.name)
+	buf := new(bytes.Buffer)
+	writeEntries(buf, valueFormat("const"), name, d.constants)
+	writeEntries(buf, valueFormat("var"), name, d.variables)
+	writeEntries(buf, valueFormat("func"), name, d.functions)
+	var b strings.Builder
+	if buf.Len() > 0 {
+		fmt.Fprintf(&b, platformPackagesTemplate, fileName, d.path, valueType(), buf.String())
+	}
+	buf.Reset()
+	writeEntries(buf, typeFormat, name, d.types)
+	for _, fn := range d.functions {
+		if fn.funcType {
+			fmt.Fprintf(buf, funcTypeFormat+"\n", fn.name, name, fn.expr)
+		}
+	}
+	if buf.Len() > 0 {
+		fmt.Fprintf(&b, platformPackageTypesTemplate, fileName, d.path, buf.String())
+	}
+	return b.String()
+}
+
+// kinds returns pointers to the constants, variables, types and functions.
+func (d *declaration) kinds() [4]*[]*symbol {
+	return [4]*[]*symbol{&d.constants, &d.variables, &d.types, &d.functions}
+}
+
+// merge adds the symbols of other missing from d, keeping them sorted.
+func (d *declaration) merge(other *declaration) {
+	for k, syms := range other.kinds() {
+		dst := d.kinds()[k]
+		m := symbolMap(*dst)
+		for _, sym := range *syms {
+			if _, ok := m[sym.name]; !ok {
+				m[sym.name] = sym
+			}
+		}
+		*dst = sortSymbols(m)
+	}
+}
+
+// definingPlatforms lists the platforms defining the symbol name of the kind
+// k, in the order of -platforms.
+func definingPlatforms(platforms []platform, decls []*declaration, k int, name string) string {
+	var s []string
+	for i, d := range decls {
+		if d != nil && hasSymbol(*d.kinds()[k], name) {
+			s = append(s, platforms[i].String())
+		}
+	}
+	return strings.Join(s, ", ")
+}
+
+func hasSymbol(syms []*symbol, name string) bool {
+	for _, sym := range syms {
+		if sym.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func filterSymbols(syms []*symbol, keep func(*symbol) bool) []*symbol {
+	var s []*symbol
+	for _, sym := range syms {
+		if keep(sym) {
+			s = append(s, sym)
+		}
+	}
+	return s
+}
+
+func symbolMap(groups ...[]*symbol) map[string]*symbol {
+	m := make(map[string]*symbol)
+	for _, syms := range groups {
+		for _, sym := range syms {
+			m[sym.name] = sym
+		}
+	}
+	return m
+}
+
+// writePlatformFiles writes a build-tagged file per platform registering its
+// specific symbols, and a file for the other platforms registering none.
+func writePlatformFiles(platforms []platform, suffix string, imports, srcs []string) error {
+	args := runArgs()
+	for i, p := range platforms {
+		code := fmt.Sprintf(platformFileTemplate[1:], p.constraint(), args, *pkgClause, imports[i], suffix, srcs[i])
+		if srcs[i] == "" {
+			code = fmt.Sprintf(otherFileTemplate[1:], p.constraint(), args, *pkgClause, suffix)
+		}
+		src, err := format.Source([]byte(code))
+		if err != nil {
+			return err
+		}
+		if err := writeOutput(*name+"_"+p.goos+"_"+p.goarch+".go", src); err != nil {
+			return err
+		}
+	}
+	src, err := format.Source([]byte(fmt.Sprintf(otherFileTemplate[1:], otherConstraint(platforms), args, *pkgClause, suffix)))
+	if err != nil {
+		return err
+	}
+	return writeOutput(*name+"_other.go", src)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+)
+
+const (
+	shardFileTemplate = `
+// Code generated by anko-package-gen2 %s. DO NOT EDIT.
+
+package %s
+
+import (
+%s%s)
+
+func init%s() {
+%s}
+`
+
+	emptyShardFileTemplate = `
+// Code generated by anko-package-gen2 %s. DO NOT EDIT.
+
+package %s
+
+func init%s() {}
+`
+)
+
+// shard splits the symbols of d, sorted by name across kinds, into n
+// alphabetical ranges of about the same size. d keeps the first range and
+// the others are returned.
+func (d *declaration) shard(n int) []*declaration {
+	var all []*symbol
+	for _, syms := range d.kinds() {
+		all = append(all, *syms...)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].name < all[j].name
+	})
+	index := make(map[*symbol]int)
+	for i, sym := range all {
+		index[sym] = i * n / len(all)
+	}
+	shards := make([]*declaration, n)
+	for i := range shards {
+		shards[i] = &declaration{path: d.path, name: d.name, init: d.init}
+	}
+	for k, syms := range d.kinds() {
+		for _, sym := range *syms {
+			dst := shards[index[sym]].kinds()[k]
+			*dst = append(*dst, sym)
+		}
+	}
+	for k, syms := range shards[0].kinds() {
+		*d.kinds()[k] = *syms
+	}
+	return shards[1:]
+}
+
+// kindFiles are the suffixes of the files of -split-by-kind, in the order
+// of declaration.kinds.
+var kindFiles = [4]string{"const", "var", "types", "func"}
+
+// splitByKind moves the symbols of d into a declaration per kind, returned
+// in the order of kindFiles.
+func (d *declaration) splitByKind() []*declaration {
+	split := make([]*declaration, len(kindFiles))
+	for k, syms := range d.kinds() {
+		split[k] = &declaration{path: d.path, name: d.name, init: d.init}
+		*split[k].kinds()[k] = *syms
+		*syms = nil
+	}
+	return split
+}
+
+// splitFiles returns the names of the files and of the init functions,
+// without their init prefix, of the code split off the main file: the
+// shards after the first as <name>_shard<N>.go, or with -split-by-kind the
+// kinds as <name>_const.go and so on.
+func splitFiles(suffix string) (files, inits []string) {
+	if *splitKinds {
+		for _, kind := range kindFiles {
+			files = append(files, *name+"_"+kind+".go")
+			inits = append(inits, suffix+strings.Title(kind))
+		}
+		return files, inits
+	}
+	for n := 2; n <= *shardCount; n++ {
+		files = append(files, fmt.Sprintf("%s_shard%d.go", *name, n))
+		inits = append(inits, fmt.Sprintf("%sShard%d", suffix, n))
+	}
+	return files, inits
+}
+
+// writeSplitFiles writes the files of splitFiles.
+func writeSplitFiles(suffix string, imports, srcs []string) error {
+	args := runArgs()
+	files, inits := splitFiles(suffix)
+	for i := range srcs {
+		code := fmt.Sprintf(shardFileTemplate[1:], args, *pkgClause, reflectImport(srcs[i]), imports[i], inits[i], srcs[i])
+		if srcs[i] == "" {
+			code = fmt.Sprintf(emptyShardFileTemplate[1:], args, *pkgClause, inits[i])
+		}
+		src, err := format.Source([]byte(code))
+		if err != nil {
+			return err
+		}
+		if err := writeOutput(files[i], src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reflectImport returns the import of reflect for the file of src, or ""
+// when src doesn't use it: with -value-kind interface, the files of
+// constants, variables and functions hold bare values.
+func reflectImport(src string) string {
+	if !strings.Contains(src, "reflect.") {
+		return ""
+	}
+	return "\t\"reflect\"\n\n"
+}
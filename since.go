@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// sinceTree holds the module at the -since-version version, from the module
+// cache, and sinceModule the directory of the module being generated, for
+// -intersection too.
+var sinceTree, sinceModule string
+
+// downloadModule returns the directory of the module path at version, dir
+// in the module cache, downloading it with go mod download when missing.
+func downloadModule(dir, path, version string) (string, error) {
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+	output, err := exec.Command("go", "mod", "download", "-json", path+"@"+version).Output()
+	// the error is reported in the JSON output too
+	var m struct {
+		Dir   string
+		Error string
+	}
+	if jsonErr := json.Unmarshal(output, &m); jsonErr == nil && m.Error != "" {
+		return "", fmt.Errorf("go mod download %s@%s: %s", path, version, m.Error)
+	}
+	if err != nil {
+		return "", fmt.Errorf("go mod download %s@%s: %v", path, version, err)
+	}
+	if m.Dir == "" {
+		return "", fmt.Errorf("go mod download %s@%s: no directory", path, version)
+	}
+	return m.Dir, nil
+}
+
+// keepAdded removes from d the symbols the package in dir already exported
+// at -since-version, none when the package didn't exist then.
+func keepAdded(d *declaration, root, dir string) error {
+	rel, err := filepath.Rel(sinceModule, filepath.Join(root, dir))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(sinceTree, rel)); os.IsNotExist(err) {
+		return nil
+	}
+	old, err := collectDeclaration(sinceTree, d.path, rel, d.init)
+	if err != nil || old == nil {
+		return err
+	}
+	for k, syms := range d.kinds() {
+		*syms = filterSymbols(*syms, func(sym *symbol) bool {
+			return !hasSymbol(*old.kinds()[k], sym.name)
+		})
+	}
+	return nil
+}
+
+// intersectModule holds the module at the -intersection version, from the
+// module cache.
+var intersectModule string
+
+// keepCommon removes from d the symbols the package in dir doesn't export
+// at -intersection under the same kind, all of them when the package
+// doesn't exist there.
+func keepCommon(d *declaration, root, dir string) error {
+	rel, err := filepath.Rel(sinceModule, filepath.Join(root, dir))
+	if err != nil {
+		return err
+	}
+	other := &declaration{}
+	if _, err := os.Stat(filepath.Join(intersectModule, rel)); err == nil {
+		if other, err = collectDeclaration(intersectModule, d.path, rel, d.init); err != nil {
+			return err
+		}
+		if other == nil {
+			other = &declaration{}
+		}
+	}
+	for k, syms := range d.kinds() {
+		*syms = filterSymbols(*syms, func(sym *symbol) bool {
+			return hasSymbol(*other.kinds()[k], sym.name)
+		})
+	}
+	return nil
+}
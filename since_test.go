@@ -0,0 +1,91 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeProxy writes a GOPROXY directory serving the module example.com/<name>
+// at version with the files, and returns its file:// URL.
+func writeProxy(t *testing.T, dir, name, version string, files map[string]string) string {
+	t.Helper()
+	path := "example.com/" + name
+	gomod := "module " + path + "\n\ngo 1.21\n"
+	files["go.mod"] = gomod
+	v := filepath.Join(dir, "example.com", name, "@v")
+	writeFiles(t, v, map[string]string{
+		"list":            version + "\n",
+		version + ".info": `{"Version": "` + version + `"}`,
+		version + ".mod":  gomod,
+	})
+	f, err := os.Create(filepath.Join(v, version+".zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for name, src := range files {
+		zw, err := w.Create(path + "@" + version + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := zw.Write([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return "file://" + filepath.ToSlash(dir)
+}
+
+// TestSinceVersion checks that -since-version only generates the symbols
+// added since the other version of the module, downloaded through the
+// module proxy when it isn't in the module cache.
+func TestSinceVersion(t *testing.T) {
+	proxy := writeProxy(t, t.TempDir(), "since", "v1.0.0", map[string]string{
+		"since.go":   "package since\n\nconst Old = 1\n\nfunc Kept() {}\n\ntype Config struct{}\n",
+		"sub/sub.go": "package sub\n\nfunc Sub() {}\n",
+	})
+	cache := t.TempDir()
+	writeFiles(t, filepath.Join(cache, "example.com", "since@v1.1.0"), map[string]string{
+		"go.mod":       "module example.com/since\n\ngo 1.21\n",
+		"since.go":     "package since\n\nconst Old = 1\n\nconst New = 2\n\nfunc Kept() {}\n\nfunc Added() {}\n\ntype Config struct{}\n\ntype Option int\n",
+		"sub/sub.go":   "package sub\n\nfunc Sub() {}\n",
+		"fresh/new.go": "package fresh\n\nfunc Fresh() {}\n",
+	})
+	env := []string{"GOPROXY=" + proxy, "GOSUMDB=off", "GOFLAGS=-mod=mod -modcacherw"}
+	r := runGenerator(t, cache, nil, env, "-pkg", "example.com/since", "-v", "v1.1.0", "-name", "since", "-quiet", "-since-version", "v1.0.0")
+	if r.err != nil {
+		t.Fatalf("%v\n%s", r.err, r.stderr)
+	}
+	files := r.output(t)
+	tests := []struct {
+		m, path string
+		want    []string
+	}{
+		{"Packages", "example.com/since", []string{"New", "Added"}},
+		{"PackageTypes", "example.com/since", []string{"Option"}},
+		{"Packages", "example.com/since/sub", nil},
+		// a package added since
+		{"Packages", "example.com/since/fresh", []string{"Fresh"}},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(keys(mapEntries(t, files, tt.m, tt.path)), ","); got != strings.Join(tt.want, ",") {
+			t.Errorf("env.%s[%q] has %s, want %s", tt.m, tt.path, got, strings.Join(tt.want, ","))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cache, "example.com", "since@v1.0.0")); err != nil {
+		t.Errorf("v1.0.0 isn't downloaded to the module cache: %v", err)
+	}
+
+	r = runGenerator(t, cache, nil, env, "-pkg", "example.com/since", "-v", "v1.1.0", "-name", "since", "-quiet", "-since-version", "v0.9.0")
+	if r.err == nil || !strings.Contains(r.stderr, "go mod download example.com/since@v0.9.0") {
+		t.Errorf("error %v for a missing version:\n%s", r.err, r.stderr)
+	}
+}
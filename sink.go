@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// sink receives the generated files, named relative to the output. The
+// files aren't keyed by import path: one binds all the packages of a run.
+type sink interface {
+	Write(file string, src []byte) error
+}
+
+// dirSink saves the files into the directory.
+type dirSink string
+
+func (dir dirSink) Write(file string, src []byte) error {
+	if err := os.MkdirAll(string(dir), 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(string(dir), file), src, 0644)
+}
+
+// stdoutSink prints the files, for -o -.
+type stdoutSink struct{}
+
+func (stdoutSink) Write(file string, src []byte) error {
+	_, err := fmt.Printf("// %s\n\n%s\n", file, src)
+	return err
+}
+
+// output returns the sink selected by -o and -check.
+func output() sink {
+	switch {
+	case *check:
+		return checkSink(*o)
+	case *o == "-":
+		return stdoutSink{}
+	default:
+		return dirSink(*o)
+	}
+}
+
+// writeFile saves a file given by a flag, like the -index, -coverage and
+// -baseline files, outside of the output dir. -check compares it with the
+// one on disk instead, reporting it out of date without writing it.
+func writeFile(filename string, b []byte) error {
+	if *check {
+		return checkSink("").Write(filename, b)
+	}
+	return os.WriteFile(filename, b, 0644)
+}
+
+// writeOutput prints, unless -quiet, and saves a generated file.
+func writeOutput(file string, src []byte) error {
+	if *useGoimports && strings.HasSuffix(file, ".go") {
+		var err error
+		if src, err = goimports(file, src); err != nil {
+			return err
+		}
+	}
+	if _, ok := output().(dirSink); ok && !*quiet {
+		fmt.Println(string(src))
+	}
+	return output().Write(file, src)
+}
+
+// goimportsMissing is set once the missing goimports has been warned about.
+var goimportsMissing bool
+
+// goimports returns src run through goimports, for -goimports, or src as
+// formatted by gofmt already if goimports isn't installed.
+func goimports(file string, src []byte) ([]byte, error) {
+	path, err := exec.LookPath("goimports")
+	if err != nil {
+		if !goimportsMissing {
+			goimportsMissing = true
+			infof("warning: goimports: not found in PATH, keeping the output of gofmt")
+		}
+		return src, nil
+	}
+	cmd := exec.Command(path)
+	cmd.Stdin = bytes.NewReader(src)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("goimports %s: %v: %s", file, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
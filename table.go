@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// symbolTableTemplate declares the tables of -symbol-table and their
+	// lookup function, once per file.
+	symbolTableTemplate = `
+// %[1]sSymbol is a value of a package, in tables sorted by name.
+type %[1]sSymbol struct {
+	Name  string
+	Value reflect.Value
+}
+
+// %[1]sSymbols holds the value table of each package, by import path.
+var %[1]sSymbols = make(map[string][]%[1]sSymbol)
+
+// Lookup%[1]s returns the value name of the package path, found by binary
+// search in its table, and reports whether there is one.
+func Lookup%[1]s(path, name string) (reflect.Value, bool) {
+	table := %[1]sSymbols[path]
+	i := %[2]s.Search(len(table), func(i int) bool { return table[i].Name >= name })
+	if i < len(table) && table[i].Name == name {
+		return table[i].Value, true
+	}
+	return reflect.Value{}, false
+}
+`
+
+	symbolsTemplate = `	%sSymbols["%s"] = []%sSymbol{
+%s	}
+`
+
+	// {"Compare", reflect.ValueOf(bytes.Compare)},
+	tableFormat = tabs + `{"%s", reflect.ValueOf(%s)},`
+)
+
+// writeSymbolTable returns the table of the constants, variables and
+// functions of the package path, for -symbol-table, or "" if it has none.
+// The values share one table sorted by name, so the sections and groups of
+// the map literal are left out.
+func writeSymbolTable(path, name string, groups ...[]*symbol) string {
+	var all []*symbol
+	for _, syms := range groups {
+		all = append(all, syms...)
+	}
+	if len(all) == 0 {
+		return ""
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].name < all[j].name
+	})
+	buf := new(bytes.Buffer)
+	for _, sym := range all {
+		writeEntry(buf, tableFormat, name, sym)
+	}
+	suffix := tableSuffix()
+	return fmt.Sprintf(symbolsTemplate, suffix, path, suffix, buf.String())
+}
+
+// tableSuffix returns the suffix of the type, table and lookup function
+// names of -symbol-table, derived from -name like the init functions.
+func tableSuffix() string {
+	return initSuffix(strings.Title(*name))
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// userTemplate replaces the built-in init function template when set with
+// -template.
+var userTemplate *template.Template
+
+// templateData is passed to the user template for each package.
+type templateData struct {
+	Path string // import path
+	Name string // package name
+	Init string // init function suffix
+
+	Constants []templateSymbol
+	Variables []templateSymbol
+	Functions []templateSymbol
+	Types     []templateSymbol
+}
+
+type templateSymbol struct {
+	Name  string   // map key
+	Expr  string   // expression in the package, to qualify by Name
+	Notes []string // notes about the symbol
+	Addr  bool     // registered by address
+	Conv  string   // type the value is converted to, e.g. uint64 for untyped constants overflowing int
+	Ptr   bool     // the pointer type is registered, for types
+	Ref   string   // reference as the built-in template writes it, e.g. uint64(math.MaxUint64) or &os.Args
+}
+
+func loadTemplate(name string) error {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	userTemplate, err = template.New(name).Parse(string(b))
+	return err
+}
+
+func templateSymbols(name string, syms []*symbol) []templateSymbol {
+	s := make([]templateSymbol, len(syms))
+	for i, sym := range syms {
+		s[i] = templateSymbol{Name: sym.name, Expr: sym.expr, Notes: sym.notes, Addr: sym.addr, Conv: sym.conv, Ptr: sym.ptr, Ref: reference(name, sym)}
+	}
+	return s
+}
+
+// executeTemplate generates the code of a package with the user template and
+// checks that the result is valid Go declarations, which compile against the
+// package parsed into files.
+func executeTemplate(path, name, init string, constants, vars, types, fns []*symbol, fset *token.FileSet, files []*ast.File) (string, error) {
+	// the keys the template registers are up to it, -verify assumes the
+	// symbols
+	bindKeys(boundKeys.Packages, path, constants, vars, fns)
+	bindKeys(boundKeys.PackageTypes, path, types)
+	buf := new(bytes.Buffer)
+	err := userTemplate.Execute(buf, templateData{
+		Path:      path,
+		Name:      name,
+		Init:      init,
+		Constants: templateSymbols(name, constants),
+		Variables: templateSymbols(name, vars),
+		Functions: templateSymbols(name, fns),
+		Types:     templateSymbols(name, types),
+	})
+	if err != nil {
+		return "", err
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", "package p\n"+buf.String(), 0); err != nil {
+		return "", fmt.Errorf("template output for %s is not valid Go: %v", path, err)
+	}
+	if err := checkTemplateOutput(path, name, buf.String(), fset, files); err != nil {
+		return "", fmt.Errorf("template output for %s doesn't compile: %v", path, err)
+	}
+	return buf.String(), nil
+}
+
+// checkTemplateOutput type-checks src, the template output for the package
+// path imported as name, in a file importing the packages of the generated
+// one. The package is checked from its files, and the other imports from
+// source. The ones that aren't found, like github.com/mattn/anko/env
+// outside of its module, are left empty: the members of the forks are
+// unknown, so only the references to them aren't checked.
+func checkTemplateOutput(path, name, src string, fset *token.FileSet, files []*ast.File) error {
+	imports := []string{"reflect", "github.com/mattn/anko/env"}
+	imports = append(imports, cfg.Imports...)
+	var b strings.Builder
+	b.WriteString("package p\n\nimport (\n")
+	for _, p := range imports {
+		fmt.Fprintf(&b, "\t%q\n", p)
+	}
+	fmt.Fprintf(&b, "\t%s %q\n)\n\n%s", name, path, src)
+	out, err := parser.ParseFile(fset, "template output", b.String(), 0)
+	if err != nil {
+		return err
+	}
+
+	stubs := make(map[string]bool)
+	var problems []string
+	conf := types.Config{
+		Importer: importerFunc(func(p string) (*types.Package, error) {
+			if p == path {
+				conf := types.Config{Importer: sourceImporter(), FakeImportC: true, IgnoreFuncBodies: true, Error: func(error) {}}
+				pkg, _ := conf.Check(path, fset, files, nil)
+				return pkg, nil
+			}
+			if pkg, err := sourceImporter().Import(p); err == nil {
+				return pkg, nil
+			}
+			pkg := types.NewPackage(p, importName(p))
+			pkg.MarkComplete()
+			stubs[pkg.Name()] = true
+			return pkg, nil
+		}),
+		Error: func(err error) {
+			te, ok := err.(types.Error)
+			if !ok {
+				problems = append(problems, err.Error())
+				return
+			}
+			// the imports are used by the rest of the generated file
+			if te.Soft && strings.Contains(te.Msg, "imported and not used") {
+				return
+			}
+			if strings.HasPrefix(te.Msg, "undefined: ") {
+				if i := strings.IndexByte(te.Msg, '.'); i > 0 && stubs[te.Msg[len("undefined: "):i]] {
+					return
+				}
+			}
+			if pos := te.Fset.Position(te.Pos); pos.Filename == "template output" {
+				// the line in src, after the package clause and imports
+				problems = append(problems, fmt.Sprintf("line %d: %s", pos.Line-len(imports)-6, te.Msg))
+			}
+		},
+	}
+	conf.Check("p", fset, []*ast.File{out}, nil)
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
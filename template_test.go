@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestTemplate checks that the output of -template is type-checked against
+// the package, and that the symbols carry the conversions, addresses and
+// pointer types of the built-in template.
+func TestTemplate(t *testing.T) {
+	cache := writeModule(t, "templated", map[string]string{
+		"templated.go": `package templated
+
+const MaxSize = 1 << 64 - 1
+
+var Table [4]byte
+
+type Cursor struct{}
+
+func (c *Cursor) Next() bool { return false }
+`,
+	})
+	const refs = `func init{{.Init}}() {
+	env.Packages["{{.Path}}"] = map[string]reflect.Value{
+{{- range .Constants}}
+		"{{.Name}}": reflect.ValueOf({{.Ref}}),
+{{- end}}
+{{- range .Variables}}
+		"{{.Name}}": reflect.ValueOf({{.Ref}}),
+{{- end}}
+	}
+	env.PackageTypes["{{.Path}}"] = map[string]reflect.Type{
+{{- range .Types}}
+		"{{.Name}}": reflect.TypeOf((*{{.Ref}})(nil)).Elem(),
+{{- end}}
+	}
+}
+`
+	tests := []struct {
+		name string
+		tmpl string
+		err  string // expected in the error, "" if the output compiles
+	}{
+		{"references", refs, ""},
+		{
+			"conversions and addresses",
+			`func init{{.Init}}() {
+	env.Packages["{{.Path}}"] = map[string]reflect.Value{
+{{- range .Constants}}
+		"{{.Name}}": reflect.ValueOf({{with .Conv}}{{.}}({{end}}{{$.Name}}.{{.Expr}}{{with .Conv}}){{end}}),
+{{- end}}
+{{- range .Variables}}
+		"{{.Name}}": reflect.ValueOf({{if .Addr}}&{{end}}{{$.Name}}.{{.Expr}}),
+{{- end}}
+	}
+	env.PackageTypes["{{.Path}}"] = map[string]reflect.Type{
+{{- range .Types}}
+		"{{.Name}}": reflect.TypeOf((*{{if .Ptr}}*{{end}}{{$.Name}}.{{.Expr}})(nil)).Elem(),
+{{- end}}
+	}
+}
+`, "",
+		},
+		{
+			"missing conversion",
+			`func init{{.Init}}() {
+{{- range .Constants}}
+	env.Packages["{{$.Path}}"]["{{.Name}}"] = reflect.ValueOf({{$.Name}}.{{.Expr}})
+{{- end}}
+}
+`, "line 2: cannot use templated.MaxSize",
+		},
+		{
+			"undefined symbol",
+			`func init{{.Init}}() {
+	env.Packages["{{.Path}}"] = map[string]reflect.Value{"Missing": reflect.ValueOf({{.Name}}.Missing)}
+}
+`, "line 2: undefined: templated.Missing",
+		},
+		{
+			"fork maps",
+			`func init{{.Init}}() {
+	env.Values("{{.Path}}", map[string]interface{}{
+{{- range .Variables}}
+		"{{.Name}}": {{.Ref}},
+{{- end}}
+	})
+}
+`, "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []string{"-pkg", "example.com/templated", "-v", "v1.0.0", "-name", "templated", "-quiet", "-pointer-types", "-template", "init.tmpl"}
+			r := runGenerator(t, cache, map[string]string{"init.tmpl": tt.tmpl}, nil, args...)
+			if tt.err == "" {
+				if r.err != nil {
+					t.Fatalf("%v\n%s", r.err, r.stderr)
+				}
+				files := r.output(t)
+				if tt.name != "fork maps" {
+					compile(t, files, "anko", cache, []string{"templated"})
+				}
+				return
+			}
+			if r.err == nil || !strings.Contains(r.stderr, "template output for example.com/templated doesn't compile: "+tt.err) {
+				t.Errorf("error %v, want %q:\n%s", r.err, tt.err, r.stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+// Package env declares the maps of the anko forks holding bare values, as
+// targeted by -value-kind interface.
+package env
+
+import "reflect"
+
+var (
+	Packages          = map[string]map[string]interface{}{}
+	PackageTypes      = map[string]map[string]reflect.Type{}
+	PackageNew        = map[string]map[string]interface{}{}
+	PackageConverters = map[string]map[string]interface{}{}
+	TypeNames         = map[reflect.Type]string{}
+
+	DeprecatedPackages     = map[string]map[string]interface{}{}
+	DeprecatedPackageTypes = map[string]map[string]reflect.Type{}
+)
@@ -0,0 +1,16 @@
+// Package env declares the maps of the anko env package the generated
+// bindings register into, with the ones of the forks the flags target.
+package env
+
+import "reflect"
+
+var (
+	Packages          = map[string]map[string]reflect.Value{}
+	PackageTypes      = map[string]map[string]reflect.Type{}
+	PackageNew        = map[string]map[string]reflect.Value{}
+	PackageConverters = map[string]map[string]reflect.Value{}
+	TypeNames         = map[reflect.Type]string{}
+
+	DeprecatedPackages     = map[string]map[string]reflect.Value{}
+	DeprecatedPackageTypes = map[string]map[string]reflect.Type{}
+)
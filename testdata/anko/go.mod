@@ -0,0 +1,3 @@
+module github.com/mattn/anko
+
+go 1.16
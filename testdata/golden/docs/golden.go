@@ -0,0 +1,77 @@
+// Code generated by anko-package-gen2 -pkg example.com/golden -v v1.0.0 -name golden -quiet -config config.json -with-docs -iota-values -with-values. DO NOT EDIT.
+
+package packages
+
+import (
+	"reflect"
+
+	"github.com/mattn/anko/env"
+
+	"example.com/golden"
+	"example.com/golden/generic"
+)
+
+func init() {
+	initGolden()
+	initGoldenGeneric()
+}
+
+func initGolden() {
+	env.Packages["example.com/golden"] = map[string]reflect.Value{
+		// constants
+		"Big":      reflect.ValueOf(uint64(golden.Big)),
+		"GB":       reflect.ValueOf(golden.GB),       // = 1073741824
+		"Greeting": reflect.ValueOf(golden.Greeting), // = "hello"
+		"KB":       reflect.ValueOf(golden.KB),       // = 1024
+		"MB":       reflect.ValueOf(golden.MB),       // = 1048576
+		"Monday":   reflect.ValueOf(golden.Monday),   // = 1
+		"Sunday":   reflect.ValueOf(golden.Sunday),   // = 0
+		"Tuesday":  reflect.ValueOf(golden.Tuesday),  // = 2
+
+		// variables
+		"Default":   reflect.ValueOf(golden.Default),
+		"ErrClosed": reflect.ValueOf(golden.ErrClosed),
+		"Output":    reflect.ValueOf(golden.Output),
+
+		// functions
+		// func Epoll() int
+		"Epoll": reflect.ValueOf(golden.Epoll),
+		// func Join(sep string, elems ...string) string
+		"Join": reflect.ValueOf(golden.Join),
+		// func Native() string
+		"Native": reflect.ValueOf(golden.Native),
+		// func New(name string) *Buffer
+		"New": reflect.ValueOf(golden.New),
+		// func Parse(s string) (Size, error)
+		"Parse": reflect.ValueOf(golden.Parse),
+	}
+	env.PackageTypes["example.com/golden"] = map[string]reflect.Type{
+		// methods have pointer receivers: use &Buffer{} or New to obtain a pointer
+		// *Buffer implements io.Writer
+		"Buffer": reflect.TypeOf((*golden.Buffer)(nil)).Elem(),
+		// type Bytes = []byte
+		"Bytes":   reflect.TypeOf((*golden.Bytes)(nil)).Elem(),
+		"Reader":  reflect.TypeOf((*golden.Reader)(nil)).Elem(),
+		"Size":    reflect.TypeOf((*golden.Size)(nil)).Elem(),
+		"Weekday": reflect.TypeOf((*golden.Weekday)(nil)).Elem(),
+	}
+}
+
+func initGoldenGeneric() {
+	env.Packages["example.com/golden/generic"] = map[string]reflect.Value{
+		// constants
+
+		// variables
+
+		// functions
+		// func Format(e Entry) string
+		"Format":     reflect.ValueOf(generic.Format),
+		"SumFloat64": reflect.ValueOf(generic.Sum[float64]),
+		"SumInt":     reflect.ValueOf(generic.Sum[int]),
+	}
+	env.PackageTypes["example.com/golden/generic"] = map[string]reflect.Type{
+		// implements fmt.Stringer
+		"Entry":   reflect.TypeOf((*generic.Entry)(nil)).Elem(),
+		"IntList": reflect.TypeOf((*generic.List[int])(nil)).Elem(),
+	}
+}
@@ -0,0 +1,73 @@
+// Code generated by anko-package-gen2 -pkg example.com/golden -v v1.0.0 -name golden -quiet -config config.json -group-constants -constructors -group-fallible -error-types. DO NOT EDIT.
+
+package packages
+
+import (
+	"reflect"
+
+	"github.com/mattn/anko/env"
+
+	"example.com/golden"
+	"example.com/golden/generic"
+)
+
+func init() {
+	initGolden()
+	initGoldenGeneric()
+}
+
+func initGolden() {
+	env.Packages["example.com/golden"] = map[string]reflect.Value{
+		// constants
+		"Big":      reflect.ValueOf(uint64(golden.Big)),
+		"GB":       reflect.ValueOf(golden.GB),
+		"Greeting": reflect.ValueOf(golden.Greeting),
+		"KB":       reflect.ValueOf(golden.KB),
+		"MB":       reflect.ValueOf(golden.MB),
+
+		// constants of type Weekday
+		"Monday":  reflect.ValueOf(golden.Monday),
+		"Sunday":  reflect.ValueOf(golden.Sunday),
+		"Tuesday": reflect.ValueOf(golden.Tuesday),
+
+		// variables
+		"Default":   reflect.ValueOf(golden.Default),
+		"ErrClosed": reflect.ValueOf(golden.ErrClosed),
+		"Output":    reflect.ValueOf(golden.Output),
+
+		// functions
+		"Epoll":  reflect.ValueOf(golden.Epoll),
+		"Join":   reflect.ValueOf(golden.Join),
+		"Native": reflect.ValueOf(golden.Native),
+
+		// constructors
+		"New": reflect.ValueOf(golden.New),
+
+		// fallible
+		"Parse": reflect.ValueOf(golden.Parse),
+	}
+	env.PackageTypes["example.com/golden"] = map[string]reflect.Type{
+		"Buffer":  reflect.TypeOf((*golden.Buffer)(nil)).Elem(),
+		"Bytes":   reflect.TypeOf((*golden.Bytes)(nil)).Elem(),
+		"Reader":  reflect.TypeOf((*golden.Reader)(nil)).Elem(),
+		"Size":    reflect.TypeOf((*golden.Size)(nil)).Elem(),
+		"Weekday": reflect.TypeOf((*golden.Weekday)(nil)).Elem(),
+	}
+}
+
+func initGoldenGeneric() {
+	env.Packages["example.com/golden/generic"] = map[string]reflect.Value{
+		// constants
+
+		// variables
+
+		// functions
+		"Format":     reflect.ValueOf(generic.Format),
+		"SumFloat64": reflect.ValueOf(generic.Sum[float64]),
+		"SumInt":     reflect.ValueOf(generic.Sum[int]),
+	}
+	env.PackageTypes["example.com/golden/generic"] = map[string]reflect.Type{
+		"Entry":   reflect.TypeOf((*generic.Entry)(nil)).Elem(),
+		"IntList": reflect.TypeOf((*generic.List[int])(nil)).Elem(),
+	}
+}
@@ -0,0 +1,67 @@
+// Code generated by anko-package-gen2 -pkg example.com/golden -v v1.0.0 -name golden -quiet -config config.json -value-kind interface. DO NOT EDIT.
+
+package packages
+
+import (
+	"reflect"
+
+	"github.com/mattn/anko/env"
+
+	"example.com/golden"
+	"example.com/golden/generic"
+)
+
+func init() {
+	initGolden()
+	initGoldenGeneric()
+}
+
+func initGolden() {
+	env.Packages["example.com/golden"] = map[string]interface{}{
+		// constants
+		"Big":      uint64(golden.Big),
+		"GB":       golden.GB,
+		"Greeting": golden.Greeting,
+		"KB":       golden.KB,
+		"MB":       golden.MB,
+		"Monday":   golden.Monday,
+		"Sunday":   golden.Sunday,
+		"Tuesday":  golden.Tuesday,
+
+		// variables
+		"Default":   golden.Default,
+		"ErrClosed": golden.ErrClosed,
+		"Output":    golden.Output,
+
+		// functions
+		"Epoll":  golden.Epoll,
+		"Join":   golden.Join,
+		"Native": golden.Native,
+		"New":    golden.New,
+		"Parse":  golden.Parse,
+	}
+	env.PackageTypes["example.com/golden"] = map[string]reflect.Type{
+		"Buffer":  reflect.TypeOf((*golden.Buffer)(nil)).Elem(),
+		"Bytes":   reflect.TypeOf((*golden.Bytes)(nil)).Elem(),
+		"Reader":  reflect.TypeOf((*golden.Reader)(nil)).Elem(),
+		"Size":    reflect.TypeOf((*golden.Size)(nil)).Elem(),
+		"Weekday": reflect.TypeOf((*golden.Weekday)(nil)).Elem(),
+	}
+}
+
+func initGoldenGeneric() {
+	env.Packages["example.com/golden/generic"] = map[string]interface{}{
+		// constants
+
+		// variables
+
+		// functions
+		"Format":     generic.Format,
+		"SumFloat64": generic.Sum[float64],
+		"SumInt":     generic.Sum[int],
+	}
+	env.PackageTypes["example.com/golden/generic"] = map[string]reflect.Type{
+		"Entry":   reflect.TypeOf((*generic.Entry)(nil)).Elem(),
+		"IntList": reflect.TypeOf((*generic.List[int])(nil)).Elem(),
+	}
+}
@@ -0,0 +1,17 @@
+//go:build linux && amd64
+
+// Code generated by anko-package-gen2 -pkg example.com/golden -v v1.0.0 -name golden -quiet -config config.json -platforms linux/amd64,windows/amd64. DO NOT EDIT.
+
+package packages
+
+import (
+	"reflect"
+
+	"example.com/golden"
+)
+
+func initGoldenPlatform() {
+	addGoldenPackages("example.com/golden", map[string]reflect.Value{
+		"Epoll": reflect.ValueOf(golden.Epoll), // defined on linux/amd64
+	})
+}
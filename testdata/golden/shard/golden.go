@@ -0,0 +1,74 @@
+// Code generated by anko-package-gen2 -pkg example.com/golden -v v1.0.0 -name golden -quiet -config config.json -shard 2. DO NOT EDIT.
+
+package packages
+
+import (
+	"reflect"
+
+	"github.com/mattn/anko/env"
+
+	"example.com/golden"
+	"example.com/golden/generic"
+)
+
+func init() {
+	initGolden()
+	initGoldenGeneric()
+	initGoldenShard2()
+}
+
+func initGolden() {
+	env.Packages["example.com/golden"] = map[string]reflect.Value{
+		// constants
+		"Big":      reflect.ValueOf(uint64(golden.Big)),
+		"GB":       reflect.ValueOf(golden.GB),
+		"Greeting": reflect.ValueOf(golden.Greeting),
+		"KB":       reflect.ValueOf(golden.KB),
+		"MB":       reflect.ValueOf(golden.MB),
+
+		// variables
+		"Default":   reflect.ValueOf(golden.Default),
+		"ErrClosed": reflect.ValueOf(golden.ErrClosed),
+
+		// functions
+		"Epoll": reflect.ValueOf(golden.Epoll),
+		"Join":  reflect.ValueOf(golden.Join),
+	}
+	env.PackageTypes["example.com/golden"] = map[string]reflect.Type{
+		"Buffer": reflect.TypeOf((*golden.Buffer)(nil)).Elem(),
+		"Bytes":  reflect.TypeOf((*golden.Bytes)(nil)).Elem(),
+	}
+}
+
+func initGoldenGeneric() {
+	env.Packages["example.com/golden/generic"] = map[string]reflect.Value{
+		// constants
+
+		// variables
+
+		// functions
+		"Format": reflect.ValueOf(generic.Format),
+	}
+	env.PackageTypes["example.com/golden/generic"] = map[string]reflect.Type{
+		"Entry":   reflect.TypeOf((*generic.Entry)(nil)).Elem(),
+		"IntList": reflect.TypeOf((*generic.List[int])(nil)).Elem(),
+	}
+}
+
+func addGoldenPackages(path string, m map[string]reflect.Value) {
+	if env.Packages[path] == nil {
+		env.Packages[path] = make(map[string]reflect.Value)
+	}
+	for k, v := range m {
+		env.Packages[path][k] = v
+	}
+}
+
+func addGoldenPackageTypes(path string, m map[string]reflect.Type) {
+	if env.PackageTypes[path] == nil {
+		env.PackageTypes[path] = make(map[string]reflect.Type)
+	}
+	for k, v := range m {
+		env.PackageTypes[path][k] = v
+	}
+}
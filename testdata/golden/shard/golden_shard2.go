@@ -0,0 +1,31 @@
+// Code generated by anko-package-gen2 -pkg example.com/golden -v v1.0.0 -name golden -quiet -config config.json -shard 2. DO NOT EDIT.
+
+package packages
+
+import (
+	"reflect"
+
+	"example.com/golden"
+	"example.com/golden/generic"
+)
+
+func initGoldenShard2() {
+	addGoldenPackages("example.com/golden", map[string]reflect.Value{
+		"Monday":  reflect.ValueOf(golden.Monday),
+		"Sunday":  reflect.ValueOf(golden.Sunday),
+		"Tuesday": reflect.ValueOf(golden.Tuesday),
+		"Output":  reflect.ValueOf(golden.Output),
+		"Native":  reflect.ValueOf(golden.Native),
+		"New":     reflect.ValueOf(golden.New),
+		"Parse":   reflect.ValueOf(golden.Parse),
+	})
+	addGoldenPackageTypes("example.com/golden", map[string]reflect.Type{
+		"Reader":  reflect.TypeOf((*golden.Reader)(nil)).Elem(),
+		"Size":    reflect.TypeOf((*golden.Size)(nil)).Elem(),
+		"Weekday": reflect.TypeOf((*golden.Weekday)(nil)).Elem(),
+	})
+	addGoldenPackages("example.com/golden/generic", map[string]reflect.Value{
+		"SumFloat64": reflect.ValueOf(generic.Sum[float64]),
+		"SumInt":     reflect.ValueOf(generic.Sum[int]),
+	})
+}
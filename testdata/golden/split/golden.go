@@ -0,0 +1,34 @@
+// Code generated by anko-package-gen2 -pkg example.com/golden -v v1.0.0 -name golden -quiet -config config.json -split-by-kind. DO NOT EDIT.
+
+package packages
+
+import (
+	"reflect"
+
+	"github.com/mattn/anko/env"
+)
+
+func init() {
+	initGoldenConst()
+	initGoldenVar()
+	initGoldenTypes()
+	initGoldenFunc()
+}
+
+func addGoldenPackages(path string, m map[string]reflect.Value) {
+	if env.Packages[path] == nil {
+		env.Packages[path] = make(map[string]reflect.Value)
+	}
+	for k, v := range m {
+		env.Packages[path][k] = v
+	}
+}
+
+func addGoldenPackageTypes(path string, m map[string]reflect.Type) {
+	if env.PackageTypes[path] == nil {
+		env.PackageTypes[path] = make(map[string]reflect.Type)
+	}
+	for k, v := range m {
+		env.PackageTypes[path][k] = v
+	}
+}
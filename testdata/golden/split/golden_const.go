@@ -0,0 +1,22 @@
+// Code generated by anko-package-gen2 -pkg example.com/golden -v v1.0.0 -name golden -quiet -config config.json -split-by-kind. DO NOT EDIT.
+
+package packages
+
+import (
+	"reflect"
+
+	"example.com/golden"
+)
+
+func initGoldenConst() {
+	addGoldenPackages("example.com/golden", map[string]reflect.Value{
+		"Big":      reflect.ValueOf(uint64(golden.Big)),
+		"GB":       reflect.ValueOf(golden.GB),
+		"Greeting": reflect.ValueOf(golden.Greeting),
+		"KB":       reflect.ValueOf(golden.KB),
+		"MB":       reflect.ValueOf(golden.MB),
+		"Monday":   reflect.ValueOf(golden.Monday),
+		"Sunday":   reflect.ValueOf(golden.Sunday),
+		"Tuesday":  reflect.ValueOf(golden.Tuesday),
+	})
+}
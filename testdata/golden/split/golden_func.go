@@ -0,0 +1,25 @@
+// Code generated by anko-package-gen2 -pkg example.com/golden -v v1.0.0 -name golden -quiet -config config.json -split-by-kind. DO NOT EDIT.
+
+package packages
+
+import (
+	"reflect"
+
+	"example.com/golden"
+	"example.com/golden/generic"
+)
+
+func initGoldenFunc() {
+	addGoldenPackages("example.com/golden", map[string]reflect.Value{
+		"Epoll":  reflect.ValueOf(golden.Epoll),
+		"Join":   reflect.ValueOf(golden.Join),
+		"Native": reflect.ValueOf(golden.Native),
+		"New":    reflect.ValueOf(golden.New),
+		"Parse":  reflect.ValueOf(golden.Parse),
+	})
+	addGoldenPackages("example.com/golden/generic", map[string]reflect.Value{
+		"Format":     reflect.ValueOf(generic.Format),
+		"SumFloat64": reflect.ValueOf(generic.Sum[float64]),
+		"SumInt":     reflect.ValueOf(generic.Sum[int]),
+	})
+}
@@ -0,0 +1,24 @@
+// Code generated by anko-package-gen2 -pkg example.com/golden -v v1.0.0 -name golden -quiet -config config.json -split-by-kind. DO NOT EDIT.
+
+package packages
+
+import (
+	"reflect"
+
+	"example.com/golden"
+	"example.com/golden/generic"
+)
+
+func initGoldenTypes() {
+	addGoldenPackageTypes("example.com/golden", map[string]reflect.Type{
+		"Buffer":  reflect.TypeOf((*golden.Buffer)(nil)).Elem(),
+		"Bytes":   reflect.TypeOf((*golden.Bytes)(nil)).Elem(),
+		"Reader":  reflect.TypeOf((*golden.Reader)(nil)).Elem(),
+		"Size":    reflect.TypeOf((*golden.Size)(nil)).Elem(),
+		"Weekday": reflect.TypeOf((*golden.Weekday)(nil)).Elem(),
+	})
+	addGoldenPackageTypes("example.com/golden/generic", map[string]reflect.Type{
+		"Entry":   reflect.TypeOf((*generic.Entry)(nil)).Elem(),
+		"IntList": reflect.TypeOf((*generic.List[int])(nil)).Elem(),
+	})
+}
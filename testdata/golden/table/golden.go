@@ -0,0 +1,78 @@
+// Code generated by anko-package-gen2 -pkg example.com/golden -v v1.0.0 -name golden -quiet -config config.json -symbol-table. DO NOT EDIT.
+
+package packages
+
+import (
+	"reflect"
+
+	"github.com/mattn/anko/env"
+
+	"example.com/golden"
+	"example.com/golden/generic"
+	"sort"
+)
+
+func init() {
+	initGolden()
+	initGoldenGeneric()
+}
+
+func initGolden() {
+	GoldenSymbols["example.com/golden"] = []GoldenSymbol{
+		{"Big", reflect.ValueOf(uint64(golden.Big))},
+		{"Default", reflect.ValueOf(golden.Default)},
+		{"Epoll", reflect.ValueOf(golden.Epoll)},
+		{"ErrClosed", reflect.ValueOf(golden.ErrClosed)},
+		{"GB", reflect.ValueOf(golden.GB)},
+		{"Greeting", reflect.ValueOf(golden.Greeting)},
+		{"Join", reflect.ValueOf(golden.Join)},
+		{"KB", reflect.ValueOf(golden.KB)},
+		{"MB", reflect.ValueOf(golden.MB)},
+		{"Monday", reflect.ValueOf(golden.Monday)},
+		{"Native", reflect.ValueOf(golden.Native)},
+		{"New", reflect.ValueOf(golden.New)},
+		{"Output", reflect.ValueOf(golden.Output)},
+		{"Parse", reflect.ValueOf(golden.Parse)},
+		{"Sunday", reflect.ValueOf(golden.Sunday)},
+		{"Tuesday", reflect.ValueOf(golden.Tuesday)},
+	}
+	env.PackageTypes["example.com/golden"] = map[string]reflect.Type{
+		"Buffer":  reflect.TypeOf((*golden.Buffer)(nil)).Elem(),
+		"Bytes":   reflect.TypeOf((*golden.Bytes)(nil)).Elem(),
+		"Reader":  reflect.TypeOf((*golden.Reader)(nil)).Elem(),
+		"Size":    reflect.TypeOf((*golden.Size)(nil)).Elem(),
+		"Weekday": reflect.TypeOf((*golden.Weekday)(nil)).Elem(),
+	}
+}
+
+func initGoldenGeneric() {
+	GoldenSymbols["example.com/golden/generic"] = []GoldenSymbol{
+		{"Format", reflect.ValueOf(generic.Format)},
+		{"SumFloat64", reflect.ValueOf(generic.Sum[float64])},
+		{"SumInt", reflect.ValueOf(generic.Sum[int])},
+	}
+	env.PackageTypes["example.com/golden/generic"] = map[string]reflect.Type{
+		"Entry":   reflect.TypeOf((*generic.Entry)(nil)).Elem(),
+		"IntList": reflect.TypeOf((*generic.List[int])(nil)).Elem(),
+	}
+}
+
+// GoldenSymbol is a value of a package, in tables sorted by name.
+type GoldenSymbol struct {
+	Name  string
+	Value reflect.Value
+}
+
+// GoldenSymbols holds the value table of each package, by import path.
+var GoldenSymbols = make(map[string][]GoldenSymbol)
+
+// LookupGolden returns the value name of the package path, found by binary
+// search in its table, and reports whether there is one.
+func LookupGolden(path, name string) (reflect.Value, bool) {
+	table := GoldenSymbols[path]
+	i := sort.Search(len(table), func(i int) bool { return table[i].Name >= name })
+	if i < len(table) && table[i].Name == name {
+		return table[i].Value, true
+	}
+	return reflect.Value{}, false
+}
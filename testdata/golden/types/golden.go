@@ -0,0 +1,112 @@
+// Code generated by anko-package-gen2 -pkg example.com/golden -v v1.0.0 -name golden -quiet -config config.json -emit-types-for-all -pointer-types -type-names -new -converters. DO NOT EDIT.
+
+package packages
+
+import (
+	"reflect"
+
+	"github.com/mattn/anko/env"
+
+	"example.com/golden"
+	"example.com/golden/generic"
+)
+
+func init() {
+	initGolden()
+	initGoldenGeneric()
+}
+
+func initGolden() {
+	env.Packages["example.com/golden"] = map[string]reflect.Value{
+		// constants
+		"Big":      reflect.ValueOf(uint64(golden.Big)),
+		"GB":       reflect.ValueOf(golden.GB),
+		"Greeting": reflect.ValueOf(golden.Greeting),
+		"KB":       reflect.ValueOf(golden.KB),
+		"MB":       reflect.ValueOf(golden.MB),
+		"Monday":   reflect.ValueOf(golden.Monday),
+		"Sunday":   reflect.ValueOf(golden.Sunday),
+		"Tuesday":  reflect.ValueOf(golden.Tuesday),
+
+		// variables
+		"Default":   reflect.ValueOf(golden.Default),
+		"ErrClosed": reflect.ValueOf(golden.ErrClosed),
+		"Output":    reflect.ValueOf(golden.Output),
+
+		// functions
+		"Epoll":  reflect.ValueOf(golden.Epoll),
+		"Join":   reflect.ValueOf(golden.Join),
+		"Native": reflect.ValueOf(golden.Native),
+		"New":    reflect.ValueOf(golden.New),
+		"Parse":  reflect.ValueOf(golden.Parse),
+	}
+	env.PackageTypes["example.com/golden"] = map[string]reflect.Type{
+		"Buffer":    reflect.TypeOf((*golden.Buffer)(nil)).Elem(),
+		"BufferPtr": reflect.TypeOf((**golden.Buffer)(nil)).Elem(),
+		"Bytes":     reflect.TypeOf((*golden.Bytes)(nil)).Elem(),
+		"Reader":    reflect.TypeOf((*golden.Reader)(nil)).Elem(),
+		"Size":      reflect.TypeOf((*golden.Size)(nil)).Elem(),
+		"Weekday":   reflect.TypeOf((*golden.Weekday)(nil)).Elem(),
+
+		// types of the constants
+		"Big":      reflect.TypeOf(uint64(golden.Big)),
+		"GB":       reflect.TypeOf(golden.GB),
+		"Greeting": reflect.TypeOf(golden.Greeting),
+		"KB":       reflect.TypeOf(golden.KB),
+		"MB":       reflect.TypeOf(golden.MB),
+		"Monday":   reflect.TypeOf(golden.Monday),
+		"Sunday":   reflect.TypeOf(golden.Sunday),
+		"Tuesday":  reflect.TypeOf(golden.Tuesday),
+
+		// types of the variables
+		"Default":   reflect.TypeOf(&golden.Default).Elem(),
+		"ErrClosed": reflect.TypeOf(&golden.ErrClosed).Elem(),
+		"Output":    reflect.TypeOf(&golden.Output).Elem(),
+
+		// types of the functions
+		"Epoll":  reflect.TypeOf(golden.Epoll),
+		"Join":   reflect.TypeOf(golden.Join),
+		"Native": reflect.TypeOf(golden.Native),
+		"New":    reflect.TypeOf(golden.New),
+		"Parse":  reflect.TypeOf(golden.Parse),
+	}
+	env.PackageNew["example.com/golden"] = map[string]reflect.Value{
+		"Buffer": reflect.ValueOf(func() interface{} { return new(golden.Buffer) }),
+	}
+	env.PackageConverters["example.com/golden"] = map[string]reflect.Value{
+		"Weekday": reflect.ValueOf(func(x int64) golden.Weekday { return golden.Weekday(x) }),
+	}
+	env.TypeNames[reflect.TypeOf((*golden.Buffer)(nil)).Elem()] = "example.com/golden.Buffer"
+	env.TypeNames[reflect.TypeOf((**golden.Buffer)(nil)).Elem()] = "example.com/golden.BufferPtr"
+	env.TypeNames[reflect.TypeOf((*golden.Bytes)(nil)).Elem()] = "example.com/golden.Bytes"
+	env.TypeNames[reflect.TypeOf((*golden.Reader)(nil)).Elem()] = "example.com/golden.Reader"
+	env.TypeNames[reflect.TypeOf((*golden.Size)(nil)).Elem()] = "example.com/golden.Size"
+	env.TypeNames[reflect.TypeOf((*golden.Weekday)(nil)).Elem()] = "example.com/golden.Weekday"
+}
+
+func initGoldenGeneric() {
+	env.Packages["example.com/golden/generic"] = map[string]reflect.Value{
+		// constants
+
+		// variables
+
+		// functions
+		"Format":     reflect.ValueOf(generic.Format),
+		"SumFloat64": reflect.ValueOf(generic.Sum[float64]),
+		"SumInt":     reflect.ValueOf(generic.Sum[int]),
+	}
+	env.PackageTypes["example.com/golden/generic"] = map[string]reflect.Type{
+		"Entry":   reflect.TypeOf((*generic.Entry)(nil)).Elem(),
+		"IntList": reflect.TypeOf((*generic.List[int])(nil)).Elem(),
+
+		// types of the functions
+		"Format":     reflect.TypeOf(generic.Format),
+		"SumFloat64": reflect.TypeOf(generic.Sum[float64]),
+		"SumInt":     reflect.TypeOf(generic.Sum[int]),
+	}
+	env.PackageNew["example.com/golden/generic"] = map[string]reflect.Value{
+		"Entry": reflect.ValueOf(func() interface{} { return new(generic.Entry) }),
+	}
+	env.TypeNames[reflect.TypeOf((*generic.Entry)(nil)).Elem()] = "example.com/golden/generic.Entry"
+	env.TypeNames[reflect.TypeOf((*generic.List[int])(nil)).Elem()] = "example.com/golden/generic.IntList"
+}
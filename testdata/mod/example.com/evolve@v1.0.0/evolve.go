@@ -0,0 +1,18 @@
+// Package evolve is the fixture of -intersection at v1.0.0: v1.1.0 removes
+// Removed and Legacy, adds Added and Fresh, and turns the constant Mode into
+// a function.
+package evolve
+
+const Version = "1.0"
+
+const Mode = 1
+
+type Config struct{ Name string }
+
+type Legacy struct{}
+
+var Default = Config{Name: "default"}
+
+func Stable() string { return "stable" }
+
+func Removed() {}
@@ -0,0 +1,16 @@
+// Package evolve is the fixture of -intersection at v1.1.0.
+package evolve
+
+const Version = "1.1"
+
+type Config struct{ Name string }
+
+type Fresh struct{}
+
+var Default = Config{Name: "default"}
+
+func Mode() int { return 1 }
+
+func Stable() string { return "stable" }
+
+func Added() {}
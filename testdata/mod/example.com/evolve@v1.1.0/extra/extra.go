@@ -0,0 +1,4 @@
+// Package extra is only in v1.1.0 of the fixture of -intersection.
+package extra
+
+func New() {}
@@ -0,0 +1,40 @@
+// Package generic declares generic types and functions, exported through
+// the instantiations of the config.
+package generic
+
+import "strconv"
+
+// Pair holds a key and a value.
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// String formats the pair.
+func (p Pair[K, V]) String() string { return "pair" }
+
+// Number is a constraint.
+type Number interface {
+	~int | ~float64
+}
+
+// Sum adds xs.
+func Sum[T Number](xs ...T) T {
+	var s T
+	for _, x := range xs {
+		s += x
+	}
+	return s
+}
+
+// List is a generic slice.
+type List[T any] []T
+
+// Len returns the length of l.
+func (l List[T]) Len() int { return len(l) }
+
+// Entry aliases an instantiation of Pair.
+type Entry = Pair[string, int]
+
+// Format formats an entry.
+func Format(e Entry) string { return e.Key + "=" + strconv.Itoa(e.Value) }
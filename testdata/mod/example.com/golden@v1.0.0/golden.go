@@ -0,0 +1,75 @@
+// Package golden is the fixture of the golden tests.
+package golden
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// Weekday is a day of the week.
+type Weekday int
+
+// The days, from iota.
+const (
+	Sunday Weekday = iota
+	Monday
+	Tuesday
+)
+
+// The sizes, from iota in an expression.
+const (
+	KB = 1 << (10 * (iota + 1))
+	MB
+	GB
+)
+
+// Big overflows int.
+const Big = 1 << 63
+
+const Greeting = "hello"
+
+// Default is the default buffer.
+var Default = New("default")
+
+// ErrClosed is returned on a closed buffer.
+var ErrClosed = errors.New("closed")
+
+// Output is assigned by the program.
+var Output io.Writer
+
+// Buffer is a named buffer.
+type Buffer struct {
+	Name string
+	data []byte
+}
+
+// Write appends p.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	return len(p), nil
+}
+
+// Size is a size in bytes.
+type Size uint64
+
+// Reader aliases io.Reader.
+type Reader = io.Reader
+
+// Bytes aliases a slice type.
+type Bytes = []byte
+
+// New returns a buffer.
+func New(name string) *Buffer {
+	return &Buffer{Name: name}
+}
+
+// Join joins elems.
+func Join(sep string, elems ...string) string {
+	return strings.Join(elems, sep)
+}
+
+// Parse parses a size.
+func Parse(s string) (Size, error) {
+	return 0, errors.New("not implemented")
+}
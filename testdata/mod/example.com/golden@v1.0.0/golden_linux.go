@@ -0,0 +1,9 @@
+//go:build linux
+
+package golden
+
+// Native names the implementation.
+func Native() string { return "linux" }
+
+// Epoll only exists on linux.
+func Epoll() int { return 0 }
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package golden
+
+// Native names the implementation.
+func Native() string { return "other" }
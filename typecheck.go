@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// typeCheck type-checks pak with go/types when -typecheck is set, importing
+// dependencies from source. Type errors are only logged: the partial
+// information is still more precise than the syntax alone. It returns nil
+// when type checking is disabled.
+func typeCheck(fset *token.FileSet, path string, pak *ast.Package) *types.Info {
+	if !*typecheck {
+		return nil
+	}
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	nerrs := 0
+	conf := types.Config{
+		Importer:    importer.ForCompiler(fset, "source", nil),
+		FakeImportC: true,
+		Error: func(err error) {
+			if nerrs == 0 {
+				infof("warning: %s: type checking: %v", path, err)
+			}
+			nerrs++
+		},
+	}
+	conf.Check(path, fset, sortedFiles(pak), info)
+	if nerrs > 1 {
+		infof("warning: %s: %d more type errors", path, nerrs-1)
+	}
+	return info
+}
+
+// checkInstantiations fails on the configured instantiations of the generic
+// functions of pak whose type arguments don't satisfy the constraints of
+// the type parameters, or refer to other packages, as the generated code
+// wouldn't compile.
+func checkInstantiations(fset *token.FileSet, path string, pak *ast.Package, instances map[string]string, functions map[string]*symbol) error {
+	var exprs []string
+	for expr, name := range instances {
+		if sym := functions[name]; sym != nil && sym.expr == expr {
+			exprs = append(exprs, expr)
+		}
+	}
+	if len(exprs) == 0 {
+		return nil
+	}
+	sort.Strings(exprs)
+	conf := types.Config{
+		Importer:         sourceImporter(),
+		FakeImportC:      true,
+		IgnoreFuncBodies: true,
+		Error:            func(error) {},
+	}
+	pkg, _ := conf.Check(path, fset, sortedFiles(pak), nil)
+	var problems []string
+	for _, expr := range exprs {
+		if sel := qualifiedIdent(expr); sel != "" {
+			problems = append(problems, fmt.Sprintf("%s: instantiation %s: %s is of another package, which the generated file doesn't import", path, expr, sel))
+			continue
+		}
+		fn := functions[expr[:strings.IndexByte(expr, '[')]]
+		if _, err := types.Eval(fset, pkg, fn.node.Pos(), expr); err != nil {
+			// the position is the one of the expression, not of the source
+			if te, ok := err.(types.Error); ok {
+				err = errors.New(te.Msg)
+			}
+			problems = append(problems, fmt.Sprintf("%s: instantiation %s: %v", path, expr, err))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// qualifiedIdent returns the first identifier of another package, like
+// time.Duration, in the instantiation expr, or "".
+func qualifiedIdent(expr string) string {
+	x, err := parser.ParseExpr(expr)
+	if err != nil {
+		return ""
+	}
+	sel := ""
+	ast.Inspect(x, func(n ast.Node) bool {
+		if s, ok := n.(*ast.SelectorExpr); ok && sel == "" {
+			if id, ok := s.X.(*ast.Ident); ok {
+				sel = id.Name + "." + s.Sel.Name
+			}
+		}
+		return sel == ""
+	})
+	return sel
+}
+
+// objectType returns the type of the object defined by id, if known.
+func objectType(info *types.Info, id *ast.Ident) types.Type {
+	if info == nil {
+		return nil
+	}
+	if obj := info.Defs[id]; obj != nil {
+		return obj.Type()
+	}
+	return nil
+}
+
+// localConstants returns the package-level constants of pak by name. The
+// constant expressions are evaluated without imports first, and only when
+// a constant depends on another package, like `const Limit = other.Max`,
+// with the imports type-checked from source. The function bodies, most of
+// the checking time, are skipped. It returns nil without checking when no
+// constant needs evaluating.
+func localConstants(fset *token.FileSet, path string, pak *ast.Package, constants map[string]*symbol) map[string]*types.Const {
+	if !needsEvaluation(constants) {
+		return nil
+	}
+	files := sortedFiles(pak)
+	m, unknown := checkConstants(fset, path, files, importerFunc(func(path string) (*types.Package, error) {
+		return nil, fmt.Errorf("not imported")
+	}))
+	if unknown {
+		m, _ = checkConstants(fset, path, files, sourceImporter())
+	}
+	return m
+}
+
+// needsEvaluation reports whether the value of one of the constants is
+// needed: to convert an untyped integer overflowing int, to skip a complex
+// one with -skip-complex, or to note a value with -iota-values. Constants
+// given by a literal, like most of them, are told apart by the syntax.
+func needsEvaluation(constants map[string]*symbol) bool {
+	for _, c := range constants {
+		if c.dropped != "" {
+			continue
+		}
+		vs, ok := c.node.(*ast.ValueSpec)
+		if !ok || *iotaValues && usesIota(vs) {
+			return true
+		}
+		var lit *ast.BasicLit
+		for i, id := range vs.Names {
+			if id.Name == c.expr && i < len(vs.Values) {
+				lit, _ = vs.Values[i].(*ast.BasicLit)
+			}
+		}
+		if c.typ != nil {
+			// never an untyped integer, but maybe of a complex type
+			if id, ok := c.typ.(*ast.Ident); *skipComplex && (!ok || !nonComplexTypes[id.Name]) {
+				return true
+			}
+			continue
+		}
+		if lit == nil {
+			return true
+		}
+		switch lit.Kind {
+		case token.INT:
+			if _, err := strconv.ParseInt(lit.Value, 0, 64); err != nil {
+				return true
+			}
+		case token.IMAG:
+			if *skipComplex {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nonComplexTypes holds the predeclared types constants can have, but
+// complex64 and complex128.
+var nonComplexTypes = map[string]bool{
+	"bool": true, "string": true, "byte": true, "rune": true, "float32": true, "float64": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+}
+
+// checkConstants returns the constants of files that imp allows
+// evaluating, and whether exported ones are left.
+func checkConstants(fset *token.FileSet, path string, files []*ast.File, imp types.Importer) (map[string]*types.Const, bool) {
+	conf := types.Config{
+		Importer:         imp,
+		FakeImportC:      true,
+		IgnoreFuncBodies: true,
+		Error:            func(error) {},
+	}
+	pkg, _ := conf.Check(path, fset, files, nil)
+	scope := pkg.Scope()
+	m := make(map[string]*types.Const, scope.Len())
+	unknown := false
+	for _, name := range scope.Names() {
+		c, ok := scope.Lookup(name).(*types.Const)
+		switch {
+		case !ok:
+		case c.Val().Kind() == constant.Unknown:
+			unknown = unknown || c.Exported()
+		default:
+			m[name] = c
+		}
+	}
+	return m, unknown
+}
+
+var srcImporter types.Importer
+
+// sourceImporter returns the importer type-checking the imports from
+// source, shared by the packages so that each import is checked once.
+func sourceImporter() types.Importer {
+	if srcImporter == nil {
+		srcImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+	}
+	return srcImporter
+}
+
+// bigConstants returns the conversions making the untyped integer constants
+// that overflow int, like math.MaxUint64, registrable, e.g. "uint64".
+func bigConstants(consts map[string]*types.Const) map[string]string {
+	m := make(map[string]string)
+	for name, c := range consts {
+		if c.Type() != types.Typ[types.UntypedInt] {
+			continue
+		}
+		if _, exact := constant.Int64Val(c.Val()); exact {
+			continue
+		}
+		if _, exact := constant.Uint64Val(c.Val()); exact {
+			m[name] = "uint64"
+		}
+	}
+	return m
+}
+
+// isComplex reports whether the type of c is complex, e.g. for 1i.
+func isComplex(c *types.Const) bool {
+	b, ok := c.Type().Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsComplex != 0
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
+
+// sortedFiles returns the files of pak sorted by name. pak.Files is a map,
+// so the features recording the first occurrence of something, like the
+// position of a symbol, iterate over these instead.
+func sortedFiles(pak *ast.Package) []*ast.File {
+	names := make([]string, 0, len(pak.Files))
+	for name := range pak.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	files := make([]*ast.File, len(names))
+	for i, name := range names {
+		files[i] = pak.Files[name]
+	}
+	return files
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+// TestNeedsEvaluation checks that the packages are only type-checked for
+// their constants when a value matters to what is generated.
+func TestNeedsEvaluation(t *testing.T) {
+	for _, test := range []struct {
+		src         string
+		skipComplex bool
+		iotaValues  bool
+		want        bool
+	}{
+		{src: `const A, B = 1, "b"`},
+		{src: `const A = 'a'`},
+		{src: `const A = 1.5`},
+		{src: `const A = 0x7fff_ffff_ffff_ffff`},
+		{src: `const A = 1 << 63`, want: true},
+		{src: `const A = 18446744073709551615`, want: true},
+		{src: `const A = other.Max`, want: true},
+		{src: "const (\n\tA = 1\n\tB\n)", want: true},
+		{src: `const A uint64 = 1 << 63`},
+		{src: "type Weekday int\n\nconst (\n\tSunday Weekday = iota\n\tMonday\n)"},
+		{src: "type Weekday int\n\nconst (\n\tSunday Weekday = iota\n\tMonday\n)", iotaValues: true, want: true},
+		{src: `const A = 1i`},
+		{src: `const A = 1i`, skipComplex: true, want: true},
+		{src: `const A complex128 = 1`, skipComplex: true, want: true},
+		{src: `const A Size = 1`, skipComplex: true, want: true},
+		{src: `const A, B int = 1, 2`, skipComplex: true},
+		{src: "const a = 1 << 63\n\nconst A = 1"},
+	} {
+		file, err := parser.ParseFile(token.NewFileSet(), "p.go", "package p\n\n"+test.src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		constants := make(map[string]*symbol)
+		for _, decl := range file.Decls {
+			if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.CONST {
+				exportValues(decl, constants)
+			}
+		}
+		*skipComplex, *iotaValues = test.skipComplex, test.iotaValues
+		if got := needsEvaluation(constants); got != test.want {
+			t.Errorf("needsEvaluation(%q) with -skip-complex=%v -iota-values=%v = %v, want %v", test.src, test.skipComplex, test.iotaValues, got, test.want)
+		}
+	}
+	*skipComplex, *iotaValues = false, false
+}
+
+func BenchmarkLocalConstants(b *testing.B) {
+	dir := writeLargePackage(b, 1000)
+	writeFiles(b, dir, map[string]string{"big.go": "package large\n\nconst Big = 1 << 63\n"})
+	fset, packages, err := parseDir(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	pak := packages["large"]
+	constants := make(map[string]*symbol)
+	for _, file := range sortedFiles(pak) {
+		for _, decl := range file.Decls {
+			if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.CONST {
+				exportValues(decl, constants)
+			}
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		localConstants(fset, "example.com/large", pak, constants)
+	}
+}
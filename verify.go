@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// registeredKeys is the dump of the keys registered in a running
+// environment, read by -verify:
+//
+//	{"Packages": {"path": ["Name", ...]}, "PackageTypes": {"path": ["Name", ...]}}
+type registeredKeys struct {
+	Packages     map[string][]string
+	PackageTypes map[string][]string
+}
+
+// boundKeys holds the keys the generated code registers into env.Packages
+// and env.PackageTypes, by path. -verify compares the dump with them rather
+// than with the exported symbols: function_types, -emit-types-for-all,
+// -pointer-types and the manual entries add keys of their own, and the
+// values of -symbol-table aren't in env.Packages.
+var boundKeys = registeredKeys{
+	Packages:     make(map[string][]string),
+	PackageTypes: make(map[string][]string),
+}
+
+// bindKeys records the keys of the symbols in the map m of boundKeys.
+func bindKeys(m map[string][]string, path string, groups ...[]*symbol) {
+	for _, syms := range groups {
+		for _, sym := range syms {
+			m[path] = append(m[path], sym.name)
+		}
+	}
+}
+
+// bindManualKeys records the keys of the hand-added entries of the path.
+func bindManualKeys(path string) {
+	for _, e := range manualEntries["Packages"][path] {
+		boundKeys.Packages[path] = append(boundKeys.Packages[path], e.key)
+	}
+	for _, e := range manualEntries["PackageTypes"][path] {
+		boundKeys.PackageTypes[path] = append(boundKeys.PackageTypes[path], e.key)
+	}
+}
+
+// funcTypes returns the functions whose type is registered too, by
+// function_types.
+func funcTypes(fns []*symbol) []*symbol {
+	return filterSymbols(fns, func(fn *symbol) bool {
+		return fn.funcType
+	})
+}
+
+// verifyBindings compares the keys registered by a compiled binary with the
+// keys the source currently generates with the flags and config of the run,
+// reporting the drift.
+func verifyBindings(name string) error {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	var keys registeredKeys
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return err
+	}
+	drift := 0
+	for _, d := range descriptors {
+		drift += diffKeys("env.Packages", d.Path, boundKeys.Packages[d.Path], keys.Packages[d.Path])
+		drift += diffKeys("env.PackageTypes", d.Path, boundKeys.PackageTypes[d.Path], keys.PackageTypes[d.Path])
+	}
+	if drift > 0 {
+		return fmt.Errorf("%d registered keys differ from the source", drift)
+	}
+	return nil
+}
+
+func diffKeys(m, path string, want, got []string) int {
+	set := make(map[string]int)
+	for _, k := range want {
+		set[k]++
+	}
+	for _, k := range got {
+		set[k]--
+	}
+	names := make([]string, 0, len(set))
+	for k := range set {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	n := 0
+	for _, k := range names {
+		switch {
+		case set[k] > 0:
+			log.Printf("%s[%q]: %s is not registered", m, path, k)
+			n++
+		case set[k] < 0:
+			log.Printf("%s[%q]: %s is no longer in the source", m, path, k)
+			n++
+		}
+	}
+	return n
+}
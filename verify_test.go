@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestVerify checks that -verify compares the dump with the keys the run
+// generates, with the keys added by the flags and config, and only reports
+// the actual drift.
+func TestVerify(t *testing.T) {
+	cache := writeModule(t, "verified", map[string]string{
+		"verified.go": `package verified
+
+const Limit = 10
+
+var Count int
+
+type Conn struct{}
+
+func (c *Conn) Close() error { return nil }
+
+func Compare(a, b string) int { return 0 }
+`,
+	})
+	config := `{"function_types": {"example.com/verified": ["Compare"]}}`
+	const path = "example.com/verified"
+	tests := []struct {
+		name  string
+		args  []string
+		edit  func(keys *registeredKeys)
+		drift []string
+	}{
+		{"default", nil, nil, nil},
+		{"function types", []string{"-config", "config.json"}, nil, nil},
+		{"pointer types", []string{"-pointer-types"}, nil, nil},
+		{"types for all", []string{"-emit-types-for-all"}, nil, nil},
+		{"symbol table", []string{"-symbol-table"}, nil, nil},
+		{"manual entry", []string{"-manual"}, nil, nil},
+		{
+			"removed symbol", []string{"-pointer-types"},
+			func(keys *registeredKeys) {
+				keys.Packages[path] = append(keys.Packages[path], "Removed")
+			},
+			[]string{`env.Packages["example.com/verified"]: Removed is no longer in the source`},
+		},
+		{
+			"added symbol", []string{"-pointer-types"},
+			func(keys *registeredKeys) {
+				var kept []string
+				for _, k := range keys.PackageTypes[path] {
+					if k != "ConnPtr" {
+						kept = append(kept, k)
+					}
+				}
+				keys.PackageTypes[path] = kept
+			},
+			[]string{`env.PackageTypes["example.com/verified"]: ConnPtr is not registered`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := []string{"-pkg", path, "-v", "v1.0.0", "-name", "verified", "-quiet"}
+			args := tt.args
+			work := map[string]string{"config.json": config}
+			if len(args) == 1 && args[0] == "-manual" {
+				// a hand-added entry of the generated file is kept
+				args = nil
+				files := generate(t, cache, "verified", nil)
+				work["anko-packages/verified.go"] = strings.Replace(files["verified.go"], "\t\t\"Limit\":", "\t\t\"Extra\": reflect.ValueOf(verified.Limit), // manual\n\t\t\"Limit\":", 1)
+			}
+			r := runGenerator(t, cache, work, nil, append(base, args...)...)
+			if r.err != nil {
+				t.Fatalf("%v\n%s", r.err, r.stderr)
+			}
+			files := r.output(t)
+			// the dump of a binary built with the generated files
+			dump := registeredKeys{
+				Packages:     map[string][]string{path: keys(mapEntries(t, files, "Packages", path))},
+				PackageTypes: map[string][]string{path: keys(mapEntries(t, files, "PackageTypes", path))},
+			}
+			if tt.edit != nil {
+				tt.edit(&dump)
+			}
+			b, err := json.Marshal(dump)
+			if err != nil {
+				t.Fatal(err)
+			}
+			work["keys.json"] = string(b)
+			for name, src := range files {
+				work["anko-packages/"+name] = src
+			}
+			r = runGenerator(t, cache, work, nil, append(append(base, args...), "-verify", "keys.json")...)
+			if (r.err != nil) != (len(tt.drift) > 0) {
+				t.Errorf("verify error %v, want drift %q\n%s", r.err, tt.drift, r.stderr)
+			}
+			for _, d := range tt.drift {
+				if !strings.Contains(r.stderr, d) {
+					t.Errorf("%q isn't reported:\n%s", d, r.stderr)
+				}
+			}
+		})
+	}
+}